@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -14,10 +15,16 @@ import (
 
 func main() {
 	if len(os.Args) < 2 {
-		log.Fatal("Correct usage: go run ./cmd/client/main.go <poll-id>")
+		log.Fatal("Correct usage: go run ./cmd/client/main.go <poll-id> [api-key]")
 	}
 	pollID := os.Args[1]
 
+	// the API key picks the tenant, without one we're on the default tenant
+	opts := &websocket.DialOptions{HTTPHeader: http.Header{}}
+	if len(os.Args) > 2 {
+		opts.HTTPHeader.Set("X-API-Key", os.Args[2])
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -31,7 +38,7 @@ func main() {
 	}()
 
 	url := fmt.Sprintf("ws://localhost:8081/ws/votes/%s", pollID)
-	conn, _, err := websocket.Dial(ctx, url, nil)
+	conn, _, err := websocket.Dial(ctx, url, opts)
 	if err != nil {
 		log.Fatalf("Failed to connect: %v", err)
 	}
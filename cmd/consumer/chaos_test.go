@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/event"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+)
+
+/*
+TestChaos checks the consumer's -commit-after-processing mode: it publishes
+the votes of a fresh poll while it kills the consumer with SIGKILL at random
+points, then lets a last consumer catch up and checks the poll's tally and
+the DLQ.
+
+Every voter votes once and the first chaosDuplicates of them vote a second
+time, so the tally must have every voter exactly once and the DLQ a duplicate
+rejection for every second vote, however many times the consumer died. There
+are no Kafka transactions, so a rejection can be published more than once:
+the DLQ is checked by distinct vote IDs.
+
+It needs the Kafka the consumer uses, e.g.
+VOTES_TEST_KAFKA_BROKERS=localhost:9092, the consumer always goes to
+localhost:9092. The consumer runs on a bolt store in a scratch directory,
+with the votes and DLQ topics and the consumer group it always uses, so
+nothing else should consume the votes topic meanwhile.
+*/
+func TestChaos(t *testing.T) {
+	brokers := os.Getenv("VOTES_TEST_KAFKA_BROKERS")
+	if brokers == "" {
+		t.Skip("VOTES_TEST_KAFKA_BROKERS not set")
+	}
+	const (
+		chaosVoters     = 2000
+		chaosDuplicates = 100
+		kills           = 10
+		maxUptime       = 3 * time.Second
+		settle          = 20 * time.Second
+	)
+
+	ctx := t.Context()
+	dir := t.TempDir()
+	consumerBin := filepath.Join(dir, "consumer")
+	if out, err := exec.Command("go", "build", "-o", consumerBin, ".").CombinedOutput(); err != nil {
+		t.Fatalf("building the consumer: %v\n%s", err, out)
+	}
+	boltPath := filepath.Join(dir, "votes.db")
+	logFile, err := os.Create(filepath.Join(dir, "consumer.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	defer func() {
+		if t.Failed() {
+			out, _ := os.ReadFile(logFile.Name())
+			t.Logf("consumer logs:\n%s", out[max(0, len(out)-4096):])
+		}
+	}()
+
+	pollID := fmt.Sprintf("chaos-%d", time.Now().Unix())
+	options := []string{"a", "b", "c"}
+
+	brokerList := strings.Split(brokers, ",")
+	publisher, err := event.NewKafkaPublisher(brokerList, "votes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+
+	// votes go in while the consumer is being killed. They all have the
+	// poll as key, so the second votes land after the first ones
+	published := make(chan error, 1)
+	go func() {
+		published <- publishChaosVotes(ctx, publisher, pollID, options, chaosVoters, chaosDuplicates)
+	}()
+
+	consumerArgs := []string{"-store=bolt", "-bolt-path=" + boltPath, "-commit-after-processing", "-reconcile-interval=0"}
+	for i := 1; i <= kills; i++ {
+		cmd, err := startConsumer(consumerBin, consumerArgs, logFile)
+		if err != nil {
+			t.Fatalf("starting the consumer: %v", err)
+		}
+		uptime := time.Duration(rand.Int64N(int64(maxUptime)))
+		time.Sleep(uptime)
+		cmd.Process.Kill()
+		cmd.Wait()
+		t.Logf("Kill %d/%d after %s", i, kills, uptime.Round(time.Millisecond))
+	}
+
+	if err := <-published; err != nil {
+		t.Fatalf("publishing votes: %v", err)
+	}
+
+	cmd, err := startConsumer(consumerBin, consumerArgs, logFile)
+	if err != nil {
+		t.Fatalf("starting the consumer: %v", err)
+	}
+	time.Sleep(settle)
+	cmd.Process.Signal(syscall.SIGTERM)
+	cmd.Wait()
+
+	want := make(map[string]int, len(options))
+	for i := range chaosVoters {
+		want[options[i%len(options)]]++
+	}
+
+	s, err := store.NewBoltStore(boltPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetResults(ctx, pollID)
+	s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opt := range options {
+		if got[opt] != want[opt] {
+			t.Errorf("option %s has %d votes, want %d", opt, got[opt], want[opt])
+		}
+	}
+
+	dlq, distinct, err := countDLQ(ctx, brokerList, pollID)
+	if err != nil {
+		t.Fatalf("reading the DLQ: %v", err)
+	}
+	if distinct != chaosDuplicates {
+		t.Errorf("%d distinct votes in the DLQ (%d messages), want %d", distinct, dlq, chaosDuplicates)
+	}
+}
+
+func startConsumer(bin string, args []string, logFile *os.File) (*exec.Cmd, error) {
+	cmd := exec.Command(bin, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	return cmd, cmd.Start()
+}
+
+func publishChaosVotes(ctx context.Context, p event.VotePublisher, pollID string, options []string, voters, duplicates int) error {
+	vote := func(i int, option string) error {
+		v := model.Vote{PollID: pollID, UserID: fmt.Sprintf("chaos-user-%d", i), OptionID: option, Timestamp: time.Now()}
+		return p.PublishMessage(ctx, v, pollID)
+	}
+
+	for i := range voters {
+		if err := vote(i, options[i%len(options)]); err != nil {
+			return err
+		}
+	}
+	for i := range duplicates {
+		if err := vote(i, options[(i+1)%len(options)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countDLQ returns how many DLQ messages the poll has, and of how many votes
+func countDLQ(ctx context.Context, brokers []string, pollID string) (int, int, error) {
+	n := 0
+	votes := make(map[string]bool)
+	_, err := event.ReplayRejections(ctx, brokers, "invalid_votes", func(_ context.Context, v model.Vote, _ string) error {
+		if v.PollID == pollID {
+			n++
+			votes[v.VoteID] = true
+		}
+		return nil
+	})
+	return n, len(votes), err
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 
 	"github.com/Guizzs26/real_time_voting_analysis_system/internal/event"
@@ -9,6 +10,10 @@ import (
 )
 
 func main() {
+	apiKey := flag.String("api-key", "", "API key the votes are published with, picks the tenant on the consumer side")
+	channel := flag.String("channel", "simulator", "ingest channel the votes are stamped with")
+	flag.Parse()
+
 	kafkaBrokers := []string{"localhost:9092"}
 	topic := "votes"
 	concurrency := 50    // 50 goroutines publishing in parallel
@@ -16,7 +21,7 @@ func main() {
 
 	log.Println("Starting Producer in stress test mode...")
 
-	publisher, err := event.NewKafkaPublisher(kafkaBrokers, topic)
+	publisher, err := event.NewKafkaPublisher(kafkaBrokers, topic, event.WithAPIKey(*apiKey), event.WithChannel(*channel))
 	if err != nil {
 		log.Fatalf("Error creating Kafka publisher: %v", err)
 	}
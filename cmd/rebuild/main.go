@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/event"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/metrics"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/processing"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/tenant"
+)
+
+/*
+rebuild recomputes the Redis state from the votes topic, for when Redis was
+flushed or its tallies can't be trusted anymore.
+
+Every vote in the topic is replayed through the same VoteProcessor logic the
+consumer runs, into a fresh key namespace. The result is compared with the
+live state, and then each rebuilt poll is swapped in atomically.
+
+The replay can't tell when the live consumer read each vote, so poll windows
+and rate limits aren't checked again: a vote fails them when the live run
+sent it to the DLQ for them. For the same reason the rebuilt polls count as
+last voted in when they were rebuilt, which holds off their retention. Votes the live run held back aren't counted
+either: the ones still in quarantine, the ones a reviewer rejected and the
+ones sent to the review topic. Votes are told apart by VoteID, and those from
+producers that didn't send one by their voter. Any vote the rebuilt store
+fails fails the whole rebuild, rather than leaving it out of the tally.
+
+Stop the consumers before rebuilding: votes they process after the replay
+started are not in the rebuilt state, and the swap would drop them. The swap
+is atomic per poll, not across polls: when it fails halfway, the polls it
+logged as swapped are rebuilt and the others still live, and the namespace is
+kept so it can be looked into.
+*/
+func main() {
+	brokers := flag.String("brokers", "localhost:9092", "comma separated kafka brokers")
+	topic := flag.String("topic", "votes", "topic to replay")
+	redisAddr := flag.String("redis-url", "redis://localhost:6379/0", "redis URL")
+	redisMode := flag.String("redis-mode", "single", "redis deployment: single, cluster or sentinel")
+	historyBucket := flag.Duration("history-bucket", time.Minute, "history bucket width, same as the consumer's")
+	historyRetention := flag.Duration("history-retention", 7*24*time.Hour, "history retention, same as the consumer's")
+	dryRun := flag.Bool("dry-run", false, "only report the divergence, keep the live state")
+	tenantsFile := flag.String("tenants-file", "", "the consumer's JSON file of API key -> tenant ID, if it has one")
+	dlqTopic := flag.String("dlq-topic", "invalid_votes", "the consumer's DLQ, whose poll window and rate limit rejections are kept")
+	reviewTopic := flag.String("review-topic", "", "the consumer's review topic, if it has one, whose votes are left out")
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	live, err := store.OpenRedisStore(ctx, *redisMode, *redisAddr, store.WithHistory(*historyBucket, *historyRetention))
+	if err != nil {
+		log.Fatalf("Error creating state store (Redis): %v", err)
+	}
+	defer live.Close()
+
+	var resolver tenant.Resolver
+	if *tenantsFile != "" {
+		sr, err := tenant.LoadFile(*tenantsFile)
+		if err != nil {
+			log.Fatalf("Error loading tenants: %v", err)
+		}
+		resolver = sr
+	}
+	tenants := tenant.All(resolver)
+
+	brokerList := strings.Split(*brokers, ",")
+	held, err := heldVotes(ctx, live, tenants, brokerList, *reviewTopic)
+	if err != nil {
+		log.Fatalf("Error reading the votes held back from the tally: %v", err)
+	}
+	log.Printf("%d votes are held back from the tally", len(held))
+
+	rejected := make(map[string]string)
+	n, err := event.ReplayRejections(ctx, brokerList, *dlqTopic, func(_ context.Context, v model.Vote, rule string) error {
+		if rule != "" {
+			rejected[voteKey(v.TenantID, v.PollID, v.VoteID, v.UserID)] = rule
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Error reading the DLQ: %v", err)
+	}
+	log.Printf("Read %d rejected votes from '%s'", n, *dlqTopic)
+
+	ns := fmt.Sprintf("rebuild:%d:", time.Now().Unix())
+	rebuilt := live.WithNamespace(ns)
+
+	// nobody is subscribed to the hub, and the replay's DLQ only takes the
+	// votes the store failed, see replayPublisher
+	appMetrics := metrics.NewProcessorMetrics("voting_system", "rebuild")
+	processor := processing.NewVoteProcessor(nil, replayPublisher{}, appMetrics, rebuilt, nil, 1,
+		processing.WithValidator(liveRule{"window_open", rejected}),
+		processing.WithValidator(liveRule{"rate_limit", rejected}),
+	)
+
+	log.Printf("Replaying topic '%s' into namespace '%s'...", *topic, ns)
+	n, err = event.ReplayTopic(ctx, brokerList, *topic, resolver, func(ctx context.Context, v model.Vote) error {
+		if held[voteKey(v.TenantID, v.PollID, v.VoteID, v.UserID)] {
+			return nil
+		}
+		return processor.Process(ctx, v)
+	})
+	if err != nil {
+		log.Printf("Error replaying topic, dropping the partial rebuild: %v", err)
+		dropNamespace(live, ns)
+		os.Exit(1)
+	}
+	log.Printf("Replayed %d votes", n)
+
+	diverged := 0
+	for _, tenantID := range tenants {
+		n, err := reportDivergence(ctx, tenantID, live.ForTenant(tenantID), rebuilt.ForTenant(tenantID))
+		if err != nil {
+			log.Printf("Error comparing rebuilt and live state: %v", err)
+			dropNamespace(live, ns)
+			os.Exit(1)
+		}
+		diverged += n
+	}
+	log.Printf("%d polls diverge from the live state", diverged)
+
+	if *dryRun {
+		log.Println("Dry run, keeping the live state")
+		dropNamespace(live, ns)
+		return
+	}
+
+	swapped := 0
+	for _, tenantID := range tenants {
+		polls, err := live.Tenant(tenantID).SwapNamespace(ctx, ns)
+		swapped += len(polls)
+		for _, pollID := range polls {
+			log.Printf("Swapped poll %s", pollName(tenantID, pollID))
+		}
+		if err != nil {
+			log.Fatalf("Error swapping rebuilt state in after %d polls, keeping namespace '%s': %v", swapped, ns, err)
+		}
+	}
+	log.Printf("Swapped %d rebuilt polls into the live state", swapped)
+}
+
+// voteKey tells votes apart for the replay, by VoteID or by voter for the
+// votes without one
+func voteKey(tenantID, pollID, voteID, userID string) string {
+	if voteID == "" {
+		voteID = "user:" + userID
+	}
+	return tenantID + "\x00" + pollID + "\x00" + voteID
+}
+
+/*
+heldVotes returns the keys of the votes the live run didn't count and
+mustn't be counted by the replay: the ones still in quarantine, the ones
+whose last review rejected them, and the ones in the review topic when
+there's one.
+*/
+func heldVotes(ctx context.Context, live *store.RedisStore, tenants, brokers []string, reviewTopic string) (map[string]bool, error) {
+	held := make(map[string]bool)
+	for _, tenantID := range tenants {
+		s := live.ForTenant(tenantID)
+		quarantined, err := s.ListQuarantined(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range quarantined {
+			held[voteKey(tenantID, q.Vote.PollID, q.Vote.VoteID, q.Vote.UserID)] = true
+		}
+
+		reviews, err := s.ListReviews(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		// a vote held again after a decision failed has a record per try
+		slices.SortFunc(reviews, func(a, b store.ReviewRecord) int { return a.DecidedAt.Compare(b.DecidedAt) })
+		decided := make(map[string]store.ReviewDecision)
+		for _, rec := range reviews {
+			decided[voteKey(tenantID, rec.PollID, rec.VoteID, rec.UserID)] = rec.Decision
+		}
+		for key, decision := range decided {
+			if decision == store.ReviewRejected {
+				held[key] = true
+			}
+		}
+	}
+
+	if reviewTopic != "" {
+		_, err := event.ReplayRejections(ctx, brokers, reviewTopic, func(_ context.Context, v model.Vote, _ string) error {
+			held[voteKey(v.TenantID, v.PollID, v.VoteID, v.UserID)] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return held, nil
+}
+
+// liveRule stands in for a validator that goes by when the vote was read,
+// rejecting just the votes the live run's DLQ has for it
+type liveRule struct {
+	name     string
+	rejected map[string]string
+}
+
+func (r liveRule) Name() string { return r.name }
+
+func (r liveRule) Validate(_ context.Context, c processing.VoteCheck) (*processing.Rejection, error) {
+	v := c.Vote
+	if r.rejected[voteKey(v.TenantID, v.PollID, v.VoteID, v.UserID)] != r.name {
+		return nil, nil
+	}
+	return &processing.Rejection{Reason: "rejected_live", Err: fmt.Errorf("the live run rejected the vote for %s", r.name)}, nil
+}
+
+// reportDivergence logs every poll of the tenant whose live tally or voter
+// count differs from the rebuilt one, and returns how many there are
+func reportDivergence(ctx context.Context, tenantID string, live, rebuilt store.VoteStore) (int, error) {
+	pollIDs := make(map[string]bool)
+	for _, s := range []store.VoteStore{live, rebuilt} {
+		polls, err := s.ListPolls(ctx, time.Time{})
+		if err != nil {
+			return 0, err
+		}
+		for _, p := range polls {
+			pollIDs[p.PollID] = true
+		}
+	}
+
+	diverged := 0
+	for pollID := range pollIDs {
+		liveResults, err := live.GetResults(ctx, pollID)
+		if err != nil {
+			return 0, err
+		}
+		rebuiltResults, err := rebuilt.GetResults(ctx, pollID)
+		if err != nil {
+			return 0, err
+		}
+		liveVoters, err := live.CountVoters(ctx, pollID)
+		if err != nil {
+			return 0, err
+		}
+		rebuiltVoters, err := rebuilt.CountVoters(ctx, pollID)
+		if err != nil {
+			return 0, err
+		}
+
+		if maps.Equal(liveResults, rebuiltResults) && liveVoters == rebuiltVoters {
+			continue
+		}
+		diverged++
+
+		name := pollName(tenantID, pollID)
+		log.Printf("[DIVERGENCE] Poll %s: %d live voters, %d rebuilt", name, liveVoters, rebuiltVoters)
+		if rebuiltVoters == 0 {
+			log.Printf("[DIVERGENCE] Poll %s has no votes left in the topic, it won't be swapped", name)
+		}
+		options := maps.Clone(liveResults)
+		maps.Copy(options, rebuiltResults)
+		for optionID := range options {
+			if liveResults[optionID] != rebuiltResults[optionID] {
+				log.Printf("[DIVERGENCE]  Option %s: %d live, %d rebuilt", optionID, liveResults[optionID], rebuiltResults[optionID])
+			}
+		}
+	}
+
+	return diverged, nil
+}
+
+func dropNamespace(rs *store.RedisStore, ns string) {
+	n, err := rs.DropNamespace(context.Background(), ns)
+	if err != nil {
+		log.Printf("Error dropping namespace '%s': %v", ns, err)
+		return
+	}
+	log.Printf("Dropped %d keys of namespace '%s'", n, ns)
+}
+
+func pollName(tenantID, pollID string) string {
+	if tenantID == "" {
+		return pollID
+	}
+	return tenantID + "/" + pollID
+}
+
+/*
+replayPublisher takes the DLQ messages of the replay. The rejections went to
+the DLQ the first time around, so it drops them, but a vote the rebuilt store
+couldn't take fails the replay: leaving it out would change the tally.
+*/
+type replayPublisher struct{}
+
+func (replayPublisher) PublishMessage(_ context.Context, v model.Vote, _ string, headers ...event.Header) error {
+	for _, h := range headers {
+		if h.Key == event.RejectReasonHeader && h.Value == "store_unavailable" {
+			return fmt.Errorf("store failed vote from UserID %s in PollID %s", v.UserID, v.PollID)
+		}
+	}
+	return nil
+}
+
+func (replayPublisher) Close() error { return nil }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/event"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/processing"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestHeldVotes(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	s, err := store.NewRedisStore(ctx, "redis://"+mr.Addr()+"/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	votes := map[string]model.Vote{
+		"held":     {VoteID: "held", PollID: "p", UserID: "u1", OptionID: "a"},
+		"rejected": {VoteID: "rejected", PollID: "p", UserID: "u2", OptionID: "a"},
+		"approved": {VoteID: "approved", PollID: "p", UserID: "u3", OptionID: "a"},
+		// approving it failed the first time, and it was rejected after
+		"retried": {VoteID: "retried", PollID: "p", UserID: "u4", OptionID: "a"},
+	}
+	if err := s.QuarantineVote(ctx, store.QuarantinedVote{ID: "held", Vote: votes["held"], QuarantinedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	for i, d := range []struct {
+		id       string
+		decision store.ReviewDecision
+	}{
+		{"rejected", store.ReviewRejected},
+		{"approved", store.ReviewApproved},
+		{"retried", store.ReviewApproved},
+		{"retried", store.ReviewRejected},
+	} {
+		v := votes[d.id]
+		// decisions are on held votes, and a failed approval holds it again
+		if err := s.QuarantineVote(ctx, store.QuarantinedVote{ID: d.id, Vote: v, QuarantinedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+		rec := store.ReviewRecord{VoteID: v.VoteID, PollID: v.PollID, UserID: v.UserID, Decision: d.decision, DecidedAt: now.Add(time.Duration(i) * time.Second)}
+		if _, err := s.ResolveQuarantined(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	held, err := heldVotes(ctx, s, []string{""}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]bool{"held": true, "rejected": true, "approved": false, "retried": true} {
+		v := votes[id]
+		if got := held[voteKey("", v.PollID, v.VoteID, v.UserID)]; got != want {
+			t.Errorf("vote %s held = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestLiveRule(t *testing.T) {
+	ctx := context.Background()
+	rejected := map[string]string{voteKey("", "p", "v1", "u1"): "window_open"}
+
+	window := liveRule{"window_open", rejected}
+	rateLimit := liveRule{"rate_limit", rejected}
+	v := model.Vote{VoteID: "v1", PollID: "p", UserID: "u1"}
+
+	if r, _ := window.Validate(ctx, processing.VoteCheck{Vote: v}); r == nil {
+		t.Error("vote the live run rejected for window_open passed it")
+	}
+	if r, _ := rateLimit.Validate(ctx, processing.VoteCheck{Vote: v}); r != nil {
+		t.Errorf("vote the live run rejected for window_open failed rate_limit: %v", r.Err)
+	}
+	v.VoteID = "v2"
+	if r, _ := window.Validate(ctx, processing.VoteCheck{Vote: v}); r != nil {
+		t.Errorf("vote the live run counted failed window_open: %v", r.Err)
+	}
+}
+
+func TestReplayPublisherFailsStoreErrors(t *testing.T) {
+	ctx := context.Background()
+	v := model.Vote{PollID: "p", UserID: "u"}
+
+	if err := (replayPublisher{}).PublishMessage(ctx, v, "p", event.Header{Key: event.RejectReasonHeader, Value: "duplicate_vote"}); err != nil {
+		t.Errorf("rejection failed the replay: %v", err)
+	}
+	if err := (replayPublisher{}).PublishMessage(ctx, v, "p", event.Header{Key: event.RejectReasonHeader, Value: "store_unavailable"}); err == nil {
+		t.Error("vote the store failed didn't fail the replay")
+	}
+}
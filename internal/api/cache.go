@@ -0,0 +1,146 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpError lets a handler pick the status code of its error response
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string { return e.msg }
+
+type jsonHandler func(r *http.Request) (any, error)
+
+type cachedResponse struct {
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+/*
+responseCache keeps the encoded body and ETag of read-only responses for a
+short TTL, keyed by URL. Dashboards tend to poll the same few URLs every
+second or so: within the TTL they get the cached copy, and a client that sends
+back the ETag in If-None-Match gets a body-less 304 when nothing changed.
+
+URLs carry arbitrary poll IDs, so it keeps at most maxCachedResponses of them:
+once full it sweeps the expired ones, and when none are, drops the one that
+expires first.
+*/
+type responseCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cachedResponse
+}
+
+const maxCachedResponses = 1024
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{ttl: ttl, entries: make(map[string]cachedResponse)}
+}
+
+func (c *responseCache) get(key string) (cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return cachedResponse{}, false
+	}
+	return e, true
+}
+
+func (c *responseCache) put(key string, e cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxCachedResponses {
+		now := time.Now()
+		for k, old := range c.entries {
+			if now.After(old.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxCachedResponses {
+		var first string
+		for k, old := range c.entries {
+			if first == "" || old.expires.Before(c.entries[first].expires) {
+				first = k
+			}
+		}
+		delete(c.entries, first)
+	}
+	c.entries[key] = e
+}
+
+// cached serves fn through the response cache, with ETag/If-None-Match support
+func (h *Handler) cached(fn jsonHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// tenants can have polls with the same ID, so each gets its own entries
+		key := tenantOf(r) + " " + r.URL.RequestURI()
+
+		e, ok := h.cache.get(key)
+		if !ok {
+			v, err := fn(r)
+			if err != nil {
+				var he *httpError
+				if errors.As(err, &he) {
+					http.Error(w, he.msg, he.status)
+					return
+				}
+				log.Printf("Error handling %s: %v", key, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			body, err := json.Marshal(v)
+			if err != nil {
+				log.Printf("Error marshalling response for %s: %v", key, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			sum := sha256.Sum256(body)
+			e = cachedResponse{
+				body:    body,
+				etag:    `"` + hex.EncodeToString(sum[:16]) + `"`,
+				expires: time.Now().Add(h.cache.ttl),
+			}
+			h.cache.put(key, e)
+		}
+
+		w.Header().Set("ETag", e.etag)
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(h.cache.ttl.Seconds())))
+		if etagMatches(r.Header.Get("If-None-Match"), e.etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(e.body)
+	}
+}
+
+// etagMatches checks an If-None-Match header, which may list several ETags
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
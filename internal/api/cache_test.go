@@ -0,0 +1,36 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestResponseCacheBounded(t *testing.T) {
+	c := newResponseCache(time.Minute)
+	now := time.Now()
+
+	// none of them expire, the first one put expires first
+	for i := range maxCachedResponses + 10 {
+		c.put(fmt.Sprintf("/polls/p%d/results", i), cachedResponse{expires: now.Add(time.Minute + time.Duration(i)*time.Millisecond)})
+	}
+	if len(c.entries) != maxCachedResponses {
+		t.Fatalf("cache has %d entries, want %d", len(c.entries), maxCachedResponses)
+	}
+	if _, ok := c.get("/polls/p0/results"); ok {
+		t.Error("entry expiring first is still cached")
+	}
+	if _, ok := c.get(fmt.Sprintf("/polls/p%d/results", maxCachedResponses+9)); !ok {
+		t.Error("latest entry isn't cached")
+	}
+
+	// an expired entry goes before any live one
+	c.put("/polls/p10/results", cachedResponse{expires: now.Add(-time.Second)})
+	c.put("/polls/new/results", cachedResponse{expires: now.Add(time.Minute)})
+	if _, ok := c.entries["/polls/p10/results"]; ok {
+		t.Error("expired entry wasn't swept")
+	}
+	if _, ok := c.get("/polls/p11/results"); !ok {
+		t.Error("live entry dropped while an expired one was there")
+	}
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/processing"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/tenant"
+)
+
+// Handler serves the poll HTTP API of the consumer
+type Handler struct {
+	store     store.VoteStore
+	processor *processing.VoteProcessor
+	resolver  tenant.Resolver
+	admins    *tenant.Admins
+	cache     *responseCache
+}
+
+// New creates the API handler. Every request acts for the tenant its API key
+// resolves to, or the default tenant when the resolver is nil. The requests
+// that change things or show a voter's ballot need an admin key instead, and
+// act for the admin's tenant; with no admins they're all turned away.
+// Read-only responses are cached for cacheTTL, so clients polling them don't
+// turn every request into store reads
+func New(s store.VoteStore, vp *processing.VoteProcessor, r tenant.Resolver, admins *tenant.Admins, cacheTTL time.Duration) *Handler {
+	return &Handler{
+		store:     s,
+		processor: vp,
+		resolver:  r,
+		admins:    admins,
+		cache:     newResponseCache(cacheTTL),
+	}
+}
+
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /polls", h.withTenant(h.cached(h.listPolls)))
+	mux.HandleFunc("GET /polls/{id}/results", h.withTenant(h.cached(h.pollResults)))
+	mux.HandleFunc("GET /polls/{id}/settings", h.withTenant(h.getPollSettings))
+	mux.HandleFunc("PUT /polls/{id}/settings", h.withAdmin(h.putPollSettings))
+	mux.HandleFunc("GET /polls/{id}/runoff", h.withTenant(h.runoff))
+	mux.HandleFunc("GET /polls/{id}/history", h.withTenant(h.history))
+	mux.HandleFunc("GET /polls/{id}/votes/{user}", h.withAdmin(h.getVote))
+	mux.HandleFunc("GET /polls/{id}/recount", h.withAdmin(h.recount))
+	mux.HandleFunc("POST /polls/{id}/recount", h.withAdmin(h.recount))
+	mux.HandleFunc("PUT /voters/{id}/weight", h.withAdmin(h.putVoterWeight))
+	mux.HandleFunc("GET /quarantine", h.withAdmin(h.listQuarantined))
+	mux.HandleFunc("GET /quarantine/reviews", h.withAdmin(h.listReviews))
+	mux.HandleFunc("POST /quarantine/{id}/approve", h.withAdmin(h.approveQuarantined))
+	mux.HandleFunc("POST /quarantine/{id}/reject", h.withAdmin(h.rejectQuarantined))
+}
+
+type tenantKey struct{}
+
+// withTenant resolves the tenant of the request before handing it to next
+func (h *Handler) withTenant(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, err := tenant.FromRequest(h.resolver, r)
+		if err != nil {
+			http.Error(w, "Invalid or missing API key", http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenantID)))
+	}
+}
+
+type adminKey struct{}
+
+// withAdmin resolves the admin of the request, whose tenant it acts for,
+// before handing it to next
+func (h *Handler) withAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin, err := tenant.AdminFromRequest(h.admins, r)
+		if err != nil {
+			http.Error(w, "Invalid or missing admin key", http.StatusUnauthorized)
+			return
+		}
+		ctx := context.WithValue(r.Context(), tenantKey{}, admin.TenantID)
+		next(w, r.WithContext(context.WithValue(ctx, adminKey{}, admin)))
+	}
+}
+
+// adminOf returns the admin of a request that went through withAdmin
+func adminOf(r *http.Request) tenant.Admin {
+	admin, _ := r.Context().Value(adminKey{}).(tenant.Admin)
+	return admin
+}
+
+func tenantOf(r *http.Request) string {
+	tenantID, _ := r.Context().Value(tenantKey{}).(string)
+	return tenantID
+}
+
+// storeFor returns the store scoped to the request's tenant
+func (h *Handler) storeFor(r *http.Request) store.VoteStore {
+	return h.store.ForTenant(tenantOf(r))
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing JSON response: %v", err)
+	}
+}
+
+func (h *Handler) getPollSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.storeFor(r).GetPollSettings(r.Context(), r.PathValue("id"))
+	if err != nil {
+		log.Printf("Error getting poll settings: %v", err)
+		http.Error(w, "Failed to get poll settings", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, settings)
+}
+
+func (h *Handler) putPollSettings(w http.ResponseWriter, r *http.Request) {
+	var settings model.PollSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid poll settings", http.StatusBadRequest)
+		return
+	}
+	err := settings.Validate()
+	if err == nil {
+		err = h.processor.CheckValidators(settings.Validators)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid poll settings: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.storeFor(r).SavePollSettings(r.Context(), r.PathValue("id"), settings); err != nil {
+		log.Printf("Error saving poll settings: %v", err)
+		http.Error(w, "Failed to save poll settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runoff tabulates a ranked poll on demand and returns the rounds. Only the
+// consumer streams runoffs to subscribers, a GET doesn't
+func (h *Handler) runoff(w http.ResponseWriter, r *http.Request) {
+	pollID := r.PathValue("id")
+	settings, err := h.storeFor(r).GetPollSettings(r.Context(), pollID)
+	if err != nil {
+		log.Printf("Error fetching poll settings: %v", err)
+		http.Error(w, "Failed to tabulate runoff", http.StatusInternalServerError)
+		return
+	}
+	if settings.ModeOrDefault() != model.PollModeRanked {
+		http.Error(w, "Runoff is only tabulated for ranked polls", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.processor.Runoff(r.Context(), tenantOf(r), pollID)
+	if err != nil {
+		log.Printf("Error tabulating runoff: %v", err)
+		http.Error(w, "Failed to tabulate runoff", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, result)
+}
+
+// history returns the poll's history buckets between the optional
+// `from` and `to` query parameters (RFC 3339), defaulting to the last hour
+func (h *Handler) history(w http.ResponseWriter, r *http.Request) {
+	to := time.Now()
+	from := to.Add(-time.Hour)
+
+	var err error
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Invalid 'from' time", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Invalid 'to' time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	history, err := h.storeFor(r).GetHistory(r.Context(), r.PathValue("id"), from, to)
+	if err != nil {
+		log.Printf("Error getting poll history: %v", err)
+		http.Error(w, "Failed to get poll history", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, history)
+}
+
+func (h *Handler) putVoterWeight(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Weight float64 `json:"weight"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Weight <= 0 {
+		http.Error(w, "Weight must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.storeFor(r).SetVoterWeight(r.Context(), r.PathValue("id"), body.Weight); err != nil {
+		log.Printf("Error saving voter weight: %v", err)
+		http.Error(w, "Failed to save voter weight", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,256 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/api"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/processing"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/tenant"
+	"github.com/alicebob/miniredis/v2"
+)
+
+const adminKey = "secret"
+
+var admins = tenant.NewAdmins(map[string]tenant.Admin{
+	adminKey:     {Name: "alice"},
+	"acme-admin": {Name: "bob", TenantID: "acme"},
+})
+
+func newServer(t *testing.T) (*httptest.Server, store.VoteStore) {
+	t.Helper()
+	return newTenantServer(t, nil)
+}
+
+// newTenantServer resolves API keys with r, nil for a single-tenant server
+func newTenantServer(t *testing.T, r tenant.Resolver) (*httptest.Server, store.VoteStore) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	s, err := store.NewRedisStore(context.Background(), "redis://"+mr.Addr()+"/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	mux := http.NewServeMux()
+	api.New(s, processing.NewVoteProcessor(nil, nil, nil, s, nil, 1), r, admins, time.Minute).Register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, s
+}
+
+func do(t *testing.T, method, url string, header map[string]string, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestPollResults(t *testing.T) {
+	srv, s := newServer(t)
+	for _, v := range []model.Vote{
+		{PollID: "p1", UserID: "u1", OptionID: "a"},
+		{PollID: "p1", UserID: "u2", OptionID: "a", Weight: 2},
+		{PollID: "p1", UserID: "u3", OptionID: "b"},
+		{PollID: "p1", UserID: "u4", OptionID: "b"},
+		{PollID: "p1", UserID: "u5", OptionID: "a"},
+	} {
+		if _, err := s.RegisterVote(context.Background(), v); err != nil {
+			t.Fatalf("RegisterVote: %v", err)
+		}
+	}
+
+	resp := do(t, http.MethodGet, srv.URL+"/polls/p1/results", nil, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET results: %d", resp.StatusCode)
+	}
+	var res api.PollResults
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.TotalVoters != 5 || res.Leader != "a" || len(res.Options) != 2 {
+		t.Fatalf("results = %+v, want 5 voters led by a", res)
+	}
+	if a := res.Options[0]; a.OptionID != "a" || a.Votes != 3 || a.Weight != 4 || a.Percentage != 60 {
+		t.Fatalf("first option = %+v, want a with 3 votes, weight 4 and 60%%", a)
+	}
+
+	if resp := do(t, http.MethodGet, srv.URL+"/polls/unknown/results", nil, ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET results of an unknown poll: %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestListPolls(t *testing.T) {
+	srv, s := newServer(t)
+	for _, v := range []model.Vote{
+		{PollID: "p1", UserID: "u1", OptionID: "a", ReceivedAt: time.Now().Add(-time.Hour)},
+		{PollID: "p2", UserID: "u1", OptionID: "a"},
+		{PollID: "p2", UserID: "u2", OptionID: "b"},
+	} {
+		if _, err := s.RegisterVote(context.Background(), v); err != nil {
+			t.Fatalf("RegisterVote: %v", err)
+		}
+	}
+
+	resp := do(t, http.MethodGet, srv.URL+"/polls", nil, "")
+	var polls []api.PollSummary
+	if err := json.NewDecoder(resp.Body).Decode(&polls); err != nil {
+		t.Fatal(err)
+	}
+	if len(polls) != 2 || polls[0].PollID != "p2" || polls[0].TotalVoters != 2 || polls[1].PollID != "p1" || polls[1].TotalVoters != 1 {
+		t.Fatalf("GET /polls = %+v, want p2 with 2 voters then p1 with 1", polls)
+	}
+}
+
+func TestResultsETag(t *testing.T) {
+	srv, s := newServer(t)
+	if _, err := s.RegisterVote(context.Background(), model.Vote{PollID: "p1", UserID: "u1", OptionID: "a"}); err != nil {
+		t.Fatalf("RegisterVote: %v", err)
+	}
+
+	resp := do(t, http.MethodGet, srv.URL+"/polls/p1/results", nil, "")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("GET results: %d with ETag %q", resp.StatusCode, etag)
+	}
+
+	for _, inm := range []string{etag, `"other", ` + etag, "W/" + etag, "*"} {
+		resp := do(t, http.MethodGet, srv.URL+"/polls/p1/results", map[string]string{"If-None-Match": inm}, "")
+		if resp.StatusCode != http.StatusNotModified {
+			t.Fatalf("If-None-Match %s: %d, want 304", inm, resp.StatusCode)
+		}
+	}
+	if resp := do(t, http.MethodGet, srv.URL+"/polls/p1/results", map[string]string{"If-None-Match": `"other"`}, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("stale If-None-Match: %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestWritesNeedAdminKey(t *testing.T) {
+	srv, s := newServer(t)
+
+	for _, tt := range []struct {
+		path, body string
+	}{
+		{"/polls/p1/settings", `{"allow_vote_changes":true}`},
+		{"/voters/u1/weight", `{"weight":3}`},
+	} {
+		for key, want := range map[string]int{
+			"":       http.StatusUnauthorized,
+			"guess":  http.StatusUnauthorized,
+			adminKey: http.StatusNoContent,
+		} {
+			resp := do(t, http.MethodPut, srv.URL+tt.path, map[string]string{"X-Admin-Key": key}, tt.body)
+			if resp.StatusCode != want {
+				t.Errorf("PUT %s with key %q: %d, want %d", tt.path, key, resp.StatusCode, want)
+			}
+		}
+	}
+
+	if settings, err := s.GetPollSettings(context.Background(), "p1"); err != nil || !settings.AllowVoteChanges {
+		t.Fatalf("settings after the admin's PUT = %+v, %v", settings, err)
+	}
+	if w, ok, err := s.GetVoterWeight(context.Background(), "u1"); err != nil || !ok || w != 3 {
+		t.Fatalf("weight after the admin's PUT = %v, %v, %v", w, ok, err)
+	}
+}
+
+func TestVoteLookupNeedsAdminKey(t *testing.T) {
+	srv, s := newServer(t)
+	if _, err := s.RegisterVote(context.Background(), model.Vote{PollID: "p1", UserID: "u1", OptionID: "a"}); err != nil {
+		t.Fatalf("RegisterVote: %v", err)
+	}
+
+	for _, tt := range []struct {
+		method, path string
+	}{
+		{http.MethodGet, "/polls/p1/votes/u1"},
+		{http.MethodGet, "/polls/p1/recount"},
+		{http.MethodPost, "/polls/p1/recount"},
+	} {
+		if resp := do(t, tt.method, srv.URL+tt.path, nil, ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s %s without a key: %d, want 401", tt.method, tt.path, resp.StatusCode)
+		}
+		if resp := do(t, tt.method, srv.URL+tt.path, map[string]string{"X-Admin-Key": adminKey}, ""); resp.StatusCode != http.StatusOK {
+			t.Errorf("%s %s with the admin key: %d, want 200", tt.method, tt.path, resp.StatusCode)
+		}
+	}
+}
+
+func TestTenantScoping(t *testing.T) {
+	srv, s := newTenantServer(t, tenant.NewStaticResolver(map[string]string{
+		"acme-key":   "acme",
+		"globex-key": "globex",
+	}))
+	acme := map[string]string{"X-API-Key": "acme-key"}
+	globex := map[string]string{"X-API-Key": "globex-key"}
+	if _, err := s.ForTenant("acme").RegisterVote(context.Background(), model.Vote{PollID: "p1", UserID: "u1", OptionID: "a"}); err != nil {
+		t.Fatalf("RegisterVote: %v", err)
+	}
+
+	// the same URL is a different poll for each tenant, cached or not
+	for range 2 {
+		if resp := do(t, http.MethodGet, srv.URL+"/polls/p1/results", acme, ""); resp.StatusCode != http.StatusOK {
+			t.Fatalf("acme's results: %d, want 200", resp.StatusCode)
+		}
+		if resp := do(t, http.MethodGet, srv.URL+"/polls/p1/results", globex, ""); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("globex's results: %d, want 404", resp.StatusCode)
+		}
+	}
+	var polls []api.PollSummary
+	if err := json.NewDecoder(do(t, http.MethodGet, srv.URL+"/polls", globex, "").Body).Decode(&polls); err != nil || len(polls) != 0 {
+		t.Fatalf("globex's polls = %v, %v, want none", polls, err)
+	}
+
+	for _, header := range []map[string]string{nil, {"X-API-Key": "guess"}} {
+		if resp := do(t, http.MethodGet, srv.URL+"/polls/p1/results", header, ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("results with API key %q: %d, want 401", header["X-API-Key"], resp.StatusCode)
+		}
+	}
+
+	// an admin acts for their own tenant, whatever API key comes along
+	resp := do(t, http.MethodPut, srv.URL+"/polls/p1/settings", map[string]string{"X-Admin-Key": "acme-admin", "X-API-Key": "globex-key"}, `{"allow_vote_changes":true}`)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("acme admin's PUT settings: %d, want 204", resp.StatusCode)
+	}
+	if settings, err := s.ForTenant("acme").GetPollSettings(context.Background(), "p1"); err != nil || !settings.AllowVoteChanges {
+		t.Fatalf("acme's settings = %+v, %v, want changes allowed", settings, err)
+	}
+	if settings, err := s.ForTenant("globex").GetPollSettings(context.Background(), "p1"); err != nil || settings.AllowVoteChanges {
+		t.Fatalf("globex's settings = %+v, %v, want them untouched", settings, err)
+	}
+}
+
+func TestNoAdminKeyConfigured(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s, err := store.NewRedisStore(context.Background(), "redis://"+mr.Addr()+"/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	mux := http.NewServeMux()
+	api.New(s, nil, nil, nil, time.Minute).Register(mux)
+	req := httptest.NewRequest(http.MethodPut, "/polls/p1/settings", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("PUT settings with no admin key configured: %d, want 401", rec.Code)
+	}
+}
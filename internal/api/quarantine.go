@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/processing"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+)
+
+// listQuarantined returns the votes held for review, only the poll_id
+// query parameter's when it's set
+func (h *Handler) listQuarantined(w http.ResponseWriter, r *http.Request) {
+	held, err := h.storeFor(r).ListQuarantined(r.Context(), r.URL.Query().Get("poll_id"))
+	if err != nil {
+		log.Printf("Error listing quarantined votes: %v", err)
+		http.Error(w, "Failed to list quarantined votes", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, held)
+}
+
+// listReviews returns the audit records of the decisions on quarantined
+// votes, only the poll_id query parameter's when it's set
+func (h *Handler) listReviews(w http.ResponseWriter, r *http.Request) {
+	records, err := h.storeFor(r).ListReviews(r.Context(), r.URL.Query().Get("poll_id"))
+	if err != nil {
+		log.Printf("Error listing review records: %v", err)
+		http.Error(w, "Failed to list review records", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, records)
+}
+
+func (h *Handler) approveQuarantined(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, h.processor.ApproveQuarantined)
+}
+
+func (h *Handler) rejectQuarantined(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, h.processor.RejectQuarantined)
+}
+
+// review applies a decision to the held vote in the path, returning its
+// review record. The reviewer in the audit records is whoever holds the admin
+// key, the body only carries an optional note
+func (h *Handler) review(w http.ResponseWriter, r *http.Request, decide func(ctx context.Context, tenantID, id, reviewer, note string) (store.ReviewRecord, error)) {
+	var body struct {
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	rec, err := decide(r.Context(), tenantOf(r), r.PathValue("id"), adminOf(r).Name, body.Note)
+	if err != nil {
+		if errors.Is(err, processing.ErrNotQuarantined) {
+			http.Error(w, "Vote not in quarantine", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error reviewing quarantined vote: %v", err)
+		http.Error(w, "Failed to review vote", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, rec)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/tally"
+)
+
+type OptionResult struct {
+	OptionID string  `json:"option_id"`
+	Votes    int     `json:"votes"`
+	Weight   float64 `json:"weight"`
+	// Percentage is the share of voters that picked the option. In approval and
+	// up-to-K polls a voter picks several options, so they can add up past 100
+	Percentage float64 `json:"percentage"`
+}
+
+type PollResults struct {
+	PollID      string         `json:"poll_id"`
+	Mode        model.PollMode `json:"mode"`
+	TotalVoters int            `json:"total_voters"`
+	Options     []OptionResult `json:"options"`
+	// Leader is the option with the most votes, empty while there's a tie
+	Leader string `json:"leader,omitempty"`
+	// Runoff is the instant-runoff tabulation of ranked polls
+	Runoff      *tally.RunoffResult `json:"runoff,omitempty"`
+	LastUpdated time.Time           `json:"last_updated"`
+}
+
+type PollSummary struct {
+	PollID      string    `json:"poll_id"`
+	TotalVoters int       `json:"total_voters"`
+	LastVoteAt  time.Time `json:"last_vote_at"`
+}
+
+func (h *Handler) pollResults(r *http.Request) (any, error) {
+	ctx := r.Context()
+	pollID := r.PathValue("id")
+	s := h.storeFor(r)
+
+	poll, ok, err := s.GetPoll(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &httpError{status: http.StatusNotFound, msg: "Poll not found"}
+	}
+
+	voters, err := s.CountVoters(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := s.GetPollSettings(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := s.GetResults(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+	weighted, err := s.GetWeightedResults(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := PollResults{
+		PollID:      pollID,
+		Mode:        settings.ModeOrDefault(),
+		TotalVoters: voters,
+		Options:     make([]OptionResult, 0, len(counts)),
+		LastUpdated: poll.LastVoteAt,
+	}
+	for optionID, count := range counts {
+		o := OptionResult{OptionID: optionID, Votes: count, Weight: weighted[optionID]}
+		if voters > 0 {
+			o.Percentage = float64(count) * 100 / float64(voters)
+		}
+		res.Options = append(res.Options, o)
+	}
+	sort.Slice(res.Options, func(i, j int) bool {
+		if res.Options[i].Votes != res.Options[j].Votes {
+			return res.Options[i].Votes > res.Options[j].Votes
+		}
+		return res.Options[i].OptionID < res.Options[j].OptionID
+	})
+	if n := len(res.Options); n == 1 || n > 1 && res.Options[0].Votes > res.Options[1].Votes {
+		res.Leader = res.Options[0].OptionID
+	}
+
+	if res.Mode == model.PollModeRanked {
+		runoff, err := h.processor.Runoff(ctx, tenantOf(r), pollID)
+		if err != nil {
+			return nil, err
+		}
+		res.Runoff = &runoff
+	}
+
+	return res, nil
+}
+
+// listPolls returns every known poll, most recently voted first
+func (h *Handler) listPolls(r *http.Request) (any, error) {
+	s := h.storeFor(r)
+	known, err := s.ListPolls(r.Context(), time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	pollIDs := make([]string, 0, len(known))
+	for _, p := range known {
+		pollIDs = append(pollIDs, p.PollID)
+	}
+	voters, err := s.CountVotersIn(r.Context(), pollIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	polls := make([]PollSummary, 0, len(known))
+	for _, p := range known {
+		polls = append(polls, PollSummary{PollID: p.PollID, TotalVoters: voters[p.PollID], LastVoteAt: p.LastVoteAt})
+	}
+
+	return polls, nil
+}
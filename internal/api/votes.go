@@ -0,0 +1,78 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// VoteResult is a user's current vote. Where the vote came from stays out of
+// it: that's for the exports, not for looking a ballot up
+type VoteResult struct {
+	UserID    string   `json:"user_id"`
+	OptionIDs []string `json:"option_ids"`
+	Weight    float64  `json:"weight"`
+	// CastAt is zero for votes stored before their time was kept
+	CastAt time.Time `json:"cast_at,omitzero"`
+}
+
+// RecountResult is a poll's stored tally next to a recount of its voters'
+// current choices
+type RecountResult struct {
+	PollID string `json:"poll_id"`
+	// Voters only exceeds Ballots for voters whose choice was never stored
+	Voters        int                `json:"voters"`
+	Ballots       int                `json:"ballots"`
+	Stored        map[string]int     `json:"stored"`
+	Recount       map[string]int     `json:"recount"`
+	StoredWeight  map[string]float64 `json:"stored_weight"`
+	RecountWeight map[string]float64 `json:"recount_weight"`
+	Matches       bool               `json:"matches"`
+	Repaired      bool               `json:"repaired"`
+}
+
+// getVote returns a user's current vote in a poll. Ballots are secret, so
+// it's only for admins
+func (h *Handler) getVote(w http.ResponseWriter, r *http.Request) {
+	v, ok, err := h.storeFor(r).GetVote(r.Context(), r.PathValue("id"), r.PathValue("user"))
+	if err != nil {
+		log.Printf("Error getting vote: %v", err)
+		http.Error(w, "Failed to get vote", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Vote not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, VoteResult{UserID: v.UserID, OptionIDs: v.OptionIDs, Weight: v.Weight, CastAt: v.CastAt})
+}
+
+// recount recounts a poll from its voters' stored choices, for admins. A GET
+// only compares, a POST also rewrites the tally when it doesn't match
+func (h *Handler) recount(w http.ResponseWriter, r *http.Request) {
+	pollID := r.PathValue("id")
+	repair := r.Method == http.MethodPost
+
+	check, err := h.storeFor(r).CheckTally(r.Context(), pollID, repair)
+	if err != nil {
+		log.Printf("Error recounting poll: %v", err)
+		http.Error(w, "Failed to recount poll", http.StatusInternalServerError)
+		return
+	}
+	if check.Repaired {
+		log.Printf("[TALLY REPAIRED] PollID: %s tally rewritten from the stored choices on request of %s", pollID, adminOf(r).Name)
+	}
+
+	writeJSON(w, RecountResult{
+		PollID:        pollID,
+		Voters:        check.Voters,
+		Ballots:       check.Ballots,
+		Stored:        check.Stored,
+		Recount:       check.Recount,
+		StoredWeight:  check.StoredWeight,
+		RecountWeight: check.RecountWeight,
+		Matches:       check.VotersMatch() && check.Matches(),
+		Repaired:      check.Repaired,
+	})
+}
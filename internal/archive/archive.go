@@ -0,0 +1,32 @@
+package archive
+
+import (
+	"context"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+)
+
+// Poll is what's kept of a poll once its retention runs out and its data
+// leaves the store: the final tally and every voter's last vote
+type Poll struct {
+	TenantID   string             `json:"tenant_id,omitempty"`
+	PollID     string             `json:"poll_id"`
+	Settings   model.PollSettings `json:"settings"`
+	LastVoteAt time.Time          `json:"last_vote_at"`
+	ArchivedAt time.Time          `json:"archived_at"`
+	Results    map[string]int     `json:"results"`
+	Weighted   map[string]float64 `json:"weighted"`
+	Votes      []store.StoredVote `json:"votes"`
+}
+
+/*
+Sink is where archived polls go. A poll is archived before its data is
+deleted, so a crash in between archives it again on the next pass: sinks
+replace an earlier archive of the same poll instead of failing on it.
+*/
+type Sink interface {
+	Archive(ctx context.Context, p Poll) error
+	Close() error
+}
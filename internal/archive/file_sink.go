@@ -0,0 +1,69 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+/*
+FileSink writes each archived poll to its own JSON file:
+
+	<dir>/<poll id>.json                      the default tenant
+	<dir>/tenants/<tenant id>/<poll id>.json  every other tenant
+
+IDs are path-escaped, so a poll ID can't point outside the directory. Files
+are written next to their final name and renamed into place, so a reader never
+sees half an archive.
+*/
+type FileSink struct {
+	dir string
+}
+
+func NewFileSink(dir string) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating archive directory: %v", err)
+	}
+	return &FileSink{dir: dir}, nil
+}
+
+func (fs *FileSink) path(tenantID, pollID string) string {
+	name := url.PathEscape(pollID) + ".json"
+	if tenantID == "" {
+		return filepath.Join(fs.dir, name)
+	}
+	return filepath.Join(fs.dir, "tenants", url.PathEscape(tenantID), name)
+}
+
+func (fs *FileSink) Archive(ctx context.Context, p Poll) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling archive: %v", err)
+	}
+
+	path := fs.path(p.TenantID, p.PollID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("error creating archive directory: %v", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("error writing archive of poll %s: %v", p.PollID, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing archive of poll %s: %v", p.PollID, err)
+	}
+	return nil
+}
+
+func (fs *FileSink) Close() error {
+	return nil
+}
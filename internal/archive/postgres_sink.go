@@ -0,0 +1,60 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+/*
+PostgresSink keeps archived polls in a poll_archives table, one JSONB row per
+poll. It's usually the vote store's own database, but it doesn't have to be:
+the sink creates its table itself rather than going through the store's
+migrations.
+*/
+type PostgresSink struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresSink(ctx context.Context, dsn string) (*PostgresSink, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing postgres DSN: %v", err)
+	}
+
+	_, err = pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS poll_archives (
+		tenant_id   TEXT NOT NULL,
+		poll_id     TEXT NOT NULL,
+		archived_at TIMESTAMPTZ NOT NULL,
+		archive     JSONB NOT NULL,
+		PRIMARY KEY (tenant_id, poll_id)
+	)`)
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("error creating poll_archives table: %v", err)
+	}
+
+	return &PostgresSink{pool: pool}, nil
+}
+
+func (ps *PostgresSink) Archive(ctx context.Context, p Poll) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("error marshalling archive: %v", err)
+	}
+
+	_, err = ps.pool.Exec(ctx, `INSERT INTO poll_archives (tenant_id, poll_id, archived_at, archive) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant_id, poll_id) DO UPDATE SET archived_at = EXCLUDED.archived_at, archive = EXCLUDED.archive`,
+		p.TenantID, p.PollID, p.ArchivedAt, b)
+	if err != nil {
+		return fmt.Errorf("error archiving poll %s to postgres: %v", p.PollID, err)
+	}
+	return nil
+}
+
+func (ps *PostgresSink) Close() error {
+	ps.pool.Close()
+	return nil
+}
@@ -0,0 +1,265 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/metrics"
+)
+
+/*
+Breaker is a circuit breaker in front of a dependency, like the store or the
+DLQ. While it's closed every call goes through and the breaker counts how many
+fail. Once at least MinRequests calls were made in the current Window and
+ErrorRate of them failed, it opens: calls fail right away with ErrOpen,
+instead of every worker hammering a dependency that's down.
+
+After OpenFor it half-opens and lets a single call through to probe the
+dependency. If the probe works the breaker closes again, otherwise it stays
+open for another OpenFor. Callers that WaitTurn before they call are let
+through one at a time while it's half-open, so the others don't get ErrOpen.
+*/
+type Breaker struct {
+	name    string
+	cfg     Config
+	metrics *metrics.ProcessorMetrics
+
+	mu       sync.Mutex
+	state    State
+	openedAt time.Time
+	probing  bool
+	// a waiter was let through to probe, until then nobody else is
+	released time.Time
+	// closed and replaced whenever a probe may have become possible
+	changed chan struct{}
+
+	// the calls of the current window, while closed
+	windowStart     time.Time
+	calls, failures int
+}
+
+// Config is when a breaker opens and how long it stays open
+type Config struct {
+	ErrorRate   float64
+	MinRequests int
+	Window      time.Duration
+	OpenFor     time.Duration
+}
+
+var DefaultConfig = Config{ErrorRate: 0.5, MinRequests: 20, Window: 10 * time.Second, OpenFor: 10 * time.Second}
+
+// State is the state of a breaker, its value is the one of the state metric
+type State int
+
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	}
+	return "closed"
+}
+
+// ErrOpen is returned for the calls an open breaker doesn't let through
+var ErrOpen = errors.New("circuit breaker is open")
+
+type Option func(*Breaker)
+
+// WithMetrics keeps the breaker's state in the circuit_breaker_state gauge
+func WithMetrics(m *metrics.ProcessorMetrics) Option {
+	return func(b *Breaker) {
+		b.metrics = m
+	}
+}
+
+func New(name string, cfg Config, opts ...Option) (*Breaker, error) {
+	if cfg.ErrorRate <= 0 || cfg.ErrorRate > 1 {
+		return nil, fmt.Errorf("circuit breaker %s: error rate must be in (0, 1]", name)
+	}
+	if cfg.MinRequests <= 0 || cfg.Window <= 0 || cfg.OpenFor <= 0 {
+		return nil, fmt.Errorf("circuit breaker %s needs a positive min requests, window and open time", name)
+	}
+
+	b := &Breaker{name: name, cfg: cfg, windowStart: time.Now(), changed: make(chan struct{})}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.setState(Closed)
+	return b, nil
+}
+
+func (b *Breaker) Name() string { return b.name }
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow reports whether a call may go through, ErrOpen when it may not. Every
+// call it lets through must be followed by a Record of how it went
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.cfg.OpenFor {
+			return ErrOpen
+		}
+		b.setState(HalfOpen)
+		b.probing = true
+		b.released = time.Time{}
+		return nil
+	case HalfOpen:
+		if b.probing {
+			return ErrOpen // one probe at a time
+		}
+		b.probing = true
+		b.released = time.Time{}
+	}
+	return nil
+}
+
+// Record counts how a call Allow let through went
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if errors.Is(err, context.Canceled) {
+		// the caller gave up, that says nothing about the dependency, so
+		// the next call probes instead
+		b.probing = false
+		b.notify()
+		return
+	}
+
+	switch b.state {
+	case HalfOpen:
+		b.probing = false
+		if err != nil {
+			b.open()
+			return
+		}
+		b.setState(Closed)
+		b.resetWindow()
+
+	case Closed:
+		if time.Since(b.windowStart) > b.cfg.Window {
+			b.resetWindow()
+		}
+		b.calls++
+		if err != nil {
+			b.failures++
+		}
+		if b.calls >= b.cfg.MinRequests && float64(b.failures) >= b.cfg.ErrorRate*float64(b.calls) {
+			b.open()
+		}
+	}
+	// calls that started before the breaker opened don't count anymore
+}
+
+/*
+Wait blocks until the breaker is closed, or until it's time to probe and
+nobody was let through to. It doesn't take the probe, it's for callers that
+only go at the breaker's pace, like a reader handing votes to the callers
+that make the calls.
+*/
+func (b *Breaker) Wait(ctx context.Context) error {
+	return b.wait(ctx, false)
+}
+
+/*
+WaitTurn blocks until the breaker is closed. Once it's time to probe, it lets
+one waiter through to make the probe and holds the rest until the probe closes
+the breaker. A waiter that was let through and doesn't call within OpenFor
+loses its turn to the next one, so it's only for callers that call right away.
+*/
+func (b *Breaker) WaitTurn(ctx context.Context) error {
+	return b.wait(ctx, true)
+}
+
+func (b *Breaker) wait(ctx context.Context, turn bool) error {
+	for {
+		b.mu.Lock()
+		wait, ok := b.waitTime(turn)
+		changed := b.changed
+		b.mu.Unlock()
+		if ok {
+			return nil
+		}
+
+		// with no wait, only a change of state can let it go
+		timer := time.NewTimer(wait)
+		if wait <= 0 {
+			timer.Stop()
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		timer.Stop()
+	}
+}
+
+// waitTime is whether a waiter may go, or how long until it should look
+// again, 0 when only a change of state lets it. A waiter that goes with turn
+// set is the one that probes. Called with the lock held
+func (b *Breaker) waitTime(turn bool) (time.Duration, bool) {
+	now := time.Now()
+	switch {
+	case b.state == Closed:
+		return 0, true
+	case b.state == Open && now.Sub(b.openedAt) < b.cfg.OpenFor:
+		return b.cfg.OpenFor - now.Sub(b.openedAt), false
+	case b.probing:
+		return 0, false
+	case now.Before(b.released):
+		return b.released.Sub(now), false
+	}
+	if turn {
+		b.released = now.Add(b.cfg.OpenFor)
+	}
+	return 0, true
+}
+
+func (b *Breaker) open() {
+	b.openedAt = time.Now()
+	b.setState(Open)
+}
+
+func (b *Breaker) resetWindow() {
+	b.windowStart = time.Now()
+	b.calls, b.failures = 0, 0
+}
+
+// notify wakes the waiters up to look at the breaker again
+func (b *Breaker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *Breaker) setState(s State) {
+	if s != b.state {
+		log.Printf("Circuit breaker %s is %s", b.name, s)
+		b.notify()
+	}
+	b.state = s
+	if b.metrics != nil {
+		b.metrics.BreakerState.WithLabelValues(b.name).Set(float64(s))
+	}
+}
@@ -0,0 +1,105 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitLetsOneProbeThrough(t *testing.T) {
+	b, err := New("test", Config{ErrorRate: 0.5, MinRequests: 1, Window: time.Minute, OpenFor: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("closed breaker: %v", err)
+	}
+	b.Record(errors.New("down"))
+	if b.State() != Open {
+		t.Fatalf("breaker is %s after a failure, want open", b.State())
+	}
+
+	const waiters = 10
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var through atomic.Int32
+	done := make(chan error, waiters)
+	for range waiters {
+		go func() {
+			err := b.WaitTurn(ctx)
+			if err == nil {
+				through.Add(1)
+			}
+			done <- err
+		}()
+	}
+
+	// once it's time to probe, a single waiter goes and makes the probe
+	for through.Load() == 0 && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe not allowed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := through.Load(); n != 1 {
+		t.Fatalf("%d waiters let through while probing, want 1", n)
+	}
+
+	// and the probe closing the breaker lets everyone else go
+	b.Record(nil)
+	for range waiters {
+		if err := <-done; err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+	}
+	if b.State() != Closed {
+		t.Fatalf("breaker is %s after the probe, want closed", b.State())
+	}
+}
+
+func TestWaitLeavesTheProbe(t *testing.T) {
+	openFor := 50 * time.Millisecond
+	b, err := New("test", Config{ErrorRate: 0.5, MinRequests: 1, Window: time.Minute, OpenFor: openFor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Allow()
+	b.Record(errors.New("down"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	// waiters that don't call don't hold the ones that do
+	start := time.Now()
+	if err := b.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if err := b.WaitTurn(ctx); err != nil {
+		t.Fatalf("WaitTurn: %v", err)
+	}
+	if waited := time.Since(start); waited > openFor/2 {
+		t.Fatalf("waited %s after the breaker could probe", waited)
+	}
+
+	// once a prober is let through, everyone waits for its probe
+	waited := make(chan error, 1)
+	go func() { waited <- b.Wait(ctx) }()
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe not allowed: %v", err)
+	}
+	select {
+	case err := <-waited:
+		t.Fatalf("Wait returned %v while probing", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	b.Record(nil)
+	if err := <-waited; err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package breaker
+
+import (
+	"context"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/event"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+)
+
+// Publisher is a vote publisher behind a breaker
+type Publisher struct {
+	event.VotePublisher
+	b *Breaker
+}
+
+func NewPublisher(p event.VotePublisher, b *Breaker) *Publisher {
+	return &Publisher{VotePublisher: p, b: b}
+}
+
+func (p *Publisher) PublishMessage(ctx context.Context, vote model.Vote, key string, headers ...event.Header) error {
+	return do(p.b, func() error { return p.VotePublisher.PublishMessage(ctx, vote, key, headers...) })
+}
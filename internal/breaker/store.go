@@ -0,0 +1,168 @@
+package breaker
+
+import (
+	"context"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+)
+
+// Store is a vote store behind a breaker. Every tenant's scope goes through
+// the same breaker, they all share the one connection
+type Store struct {
+	store.VoteStore
+	b *Breaker
+}
+
+func NewStore(s store.VoteStore, b *Breaker) *Store {
+	return &Store{VoteStore: s, b: b}
+}
+
+// do runs fn if the breaker lets it and records how it went
+func do(b *Breaker, fn func() error) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.Record(err)
+	return err
+}
+
+func call[T any](b *Breaker, fn func() (T, error)) (T, error) {
+	var v T
+	err := do(b, func() error {
+		var err error
+		v, err = fn()
+		return err
+	})
+	return v, err
+}
+
+func (s *Store) ForTenant(tenantID string) store.VoteStore {
+	return &Store{VoteStore: s.VoteStore.ForTenant(tenantID), b: s.b}
+}
+
+func (s *Store) RegisterVote(ctx context.Context, vote model.Vote) (store.VoteResult, error) {
+	return call(s.b, func() (store.VoteResult, error) { return s.VoteStore.RegisterVote(ctx, vote) })
+}
+
+func (s *Store) GetResults(ctx context.Context, pollID string) (map[string]int, error) {
+	return call(s.b, func() (map[string]int, error) { return s.VoteStore.GetResults(ctx, pollID) })
+}
+
+func (s *Store) ListPolls(ctx context.Context, activeSince time.Time) ([]store.PollInfo, error) {
+	return call(s.b, func() ([]store.PollInfo, error) { return s.VoteStore.ListPolls(ctx, activeSince) })
+}
+
+func (s *Store) GetPoll(ctx context.Context, pollID string) (store.PollInfo, bool, error) {
+	var ok bool
+	p, err := call(s.b, func() (store.PollInfo, error) {
+		p, found, err := s.VoteStore.GetPoll(ctx, pollID)
+		ok = found
+		return p, err
+	})
+	return p, ok, err
+}
+
+func (s *Store) CountVoters(ctx context.Context, pollID string) (int, error) {
+	return call(s.b, func() (int, error) { return s.VoteStore.CountVoters(ctx, pollID) })
+}
+
+func (s *Store) CountVotersIn(ctx context.Context, pollIDs []string) (map[string]int, error) {
+	return call(s.b, func() (map[string]int, error) { return s.VoteStore.CountVotersIn(ctx, pollIDs) })
+}
+
+func (s *Store) GetWeightedResults(ctx context.Context, pollID string) (map[string]float64, error) {
+	return call(s.b, func() (map[string]float64, error) { return s.VoteStore.GetWeightedResults(ctx, pollID) })
+}
+
+func (s *Store) GetHistory(ctx context.Context, pollID string, from, to time.Time) ([]model.HistoryBucket, error) {
+	return call(s.b, func() ([]model.HistoryBucket, error) { return s.VoteStore.GetHistory(ctx, pollID, from, to) })
+}
+
+func (s *Store) GetBallots(ctx context.Context, pollID string) ([][]string, error) {
+	return call(s.b, func() ([][]string, error) { return s.VoteStore.GetBallots(ctx, pollID) })
+}
+
+func (s *Store) GetVote(ctx context.Context, pollID, userID string) (store.StoredVote, bool, error) {
+	var ok bool
+	v, err := call(s.b, func() (store.StoredVote, error) {
+		v, found, err := s.VoteStore.GetVote(ctx, pollID, userID)
+		ok = found
+		return v, err
+	})
+	return v, ok, err
+}
+
+func (s *Store) ListVotes(ctx context.Context, pollID string) ([]store.StoredVote, error) {
+	return call(s.b, func() ([]store.StoredVote, error) { return s.VoteStore.ListVotes(ctx, pollID) })
+}
+
+func (s *Store) CheckTally(ctx context.Context, pollID string, repair bool) (store.TallyCheck, error) {
+	return call(s.b, func() (store.TallyCheck, error) { return s.VoteStore.CheckTally(ctx, pollID, repair) })
+}
+
+func (s *Store) DeletePoll(ctx context.Context, pollID string, lastVoteAt time.Time) (int, error) {
+	return call(s.b, func() (int, error) { return s.VoteStore.DeletePoll(ctx, pollID, lastVoteAt) })
+}
+
+func (s *Store) GetPollSettings(ctx context.Context, pollID string) (model.PollSettings, error) {
+	return call(s.b, func() (model.PollSettings, error) { return s.VoteStore.GetPollSettings(ctx, pollID) })
+}
+
+func (s *Store) HasPollSettings(ctx context.Context, pollID string) (bool, error) {
+	return call(s.b, func() (bool, error) { return s.VoteStore.HasPollSettings(ctx, pollID) })
+}
+
+func (s *Store) SavePollSettings(ctx context.Context, pollID string, settings model.PollSettings) error {
+	return do(s.b, func() error { return s.VoteStore.SavePollSettings(ctx, pollID, settings) })
+}
+
+func (s *Store) GetVoterWeight(ctx context.Context, userID string) (float64, bool, error) {
+	var ok bool
+	w, err := call(s.b, func() (float64, error) {
+		w, found, err := s.VoteStore.GetVoterWeight(ctx, userID)
+		ok = found
+		return w, err
+	})
+	return w, ok, err
+}
+
+func (s *Store) SetVoterWeight(ctx context.Context, userID string, weight float64) error {
+	return do(s.b, func() error { return s.VoteStore.SetVoterWeight(ctx, userID, weight) })
+}
+
+func (s *Store) RecordVelocity(ctx context.Context, key, member string, at time.Time, window time.Duration) (int, error) {
+	return call(s.b, func() (int, error) { return s.VoteStore.RecordVelocity(ctx, key, member, at, window) })
+}
+
+func (s *Store) QuarantineVote(ctx context.Context, q store.QuarantinedVote) error {
+	return do(s.b, func() error { return s.VoteStore.QuarantineVote(ctx, q) })
+}
+
+func (s *Store) ListQuarantined(ctx context.Context, pollID string) ([]store.QuarantinedVote, error) {
+	return call(s.b, func() ([]store.QuarantinedVote, error) { return s.VoteStore.ListQuarantined(ctx, pollID) })
+}
+
+func (s *Store) GetQuarantined(ctx context.Context, id string) (store.QuarantinedVote, bool, error) {
+	var ok bool
+	q, err := call(s.b, func() (store.QuarantinedVote, error) {
+		q, found, err := s.VoteStore.GetQuarantined(ctx, id)
+		ok = found
+		return q, err
+	})
+	return q, ok, err
+}
+
+func (s *Store) ResolveQuarantined(ctx context.Context, rec store.ReviewRecord) (bool, error) {
+	return call(s.b, func() (bool, error) { return s.VoteStore.ResolveQuarantined(ctx, rec) })
+}
+
+func (s *Store) ListReviews(ctx context.Context, pollID string) ([]store.ReviewRecord, error) {
+	return call(s.b, func() ([]store.ReviewRecord, error) { return s.VoteStore.ListReviews(ctx, pollID) })
+}
+
+func (s *Store) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	return call(s.b, func() (bool, error) { return s.VoteStore.AcquireLease(ctx, name, holder, ttl) })
+}
@@ -10,3 +10,9 @@ type VoteConsumer interface {
 	ReadMessage(ctx context.Context) (model.Vote, error)
 	Close() error
 }
+
+// Acker is implemented by consumers that don't commit a vote's offset when
+// it's read, but when the processor acks it, once it's done with the vote
+type Acker interface {
+	Ack(ctx context.Context, v model.Vote) error
+}
@@ -2,7 +2,6 @@ package event
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -10,14 +9,77 @@ import (
 	"time"
 
 	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/tenant"
 	"github.com/segmentio/kafka-go"
 )
 
 type KafkaConsumer struct {
-	reader *kafka.Reader
+	reader   *kafka.Reader
+	resolver tenant.Resolver
+
+	// set by WithCommitAfterProcessing, commits what the processor acked
+	offsets *offsetTracker
+
+	// how long after it was published a message is handed out
+	delay time.Duration
+	// the votes were published by the processor, see WithRetryVotes
+	retryVotes bool
+	signingKey []byte
 }
 
-func NewKafkaConsumer(brokers []string, topic, groupID string) (*KafkaConsumer, error) {
+type ConsumerOption func(*KafkaConsumer)
+
+// WithTenantResolver makes the consumer resolve each vote's tenant from the API
+// key it was published with. Without it every vote goes to the default tenant
+func WithTenantResolver(r tenant.Resolver) ConsumerOption {
+	return func(kc *KafkaConsumer) {
+		kc.resolver = r
+	}
+}
+
+/*
+WithCommitAfterProcessing stops committing a vote's offset as soon as it's
+read: it's committed when the processor acks it, after the vote was applied
+and sent to wherever it had to go, so a consumer that dies mid-vote gets it
+again instead of losing it. Votes without a VoteID get their
+topic/partition/offset as one, so the store applies a redelivered vote once
+like any other retried copy.
+
+That's the tally moved once, not exactly-once delivery: the offsets aren't
+committed in a Kafka transaction with the DLQ publishes, kafka-go has no
+transactional producer. A rejected vote that's redelivered is published to
+the DLQ again, whether a validator or the store rejected it, so the DLQ
+readers have to dedupe on the vote_id. Only committed records are read, in
+case the votes topic is written by a transactional producer.
+*/
+func WithCommitAfterProcessing() ConsumerOption {
+	return func(kc *KafkaConsumer) {
+		kc.offsets = newOffsetTracker()
+	}
+}
+
+// WithDelay holds each message until d after it was published, for the retry
+// topics. Messages come in publish order, so holding one holds its partition
+func WithDelay(d time.Duration) ConsumerOption {
+	return func(kc *KafkaConsumer) {
+		kc.delay = d
+	}
+}
+
+// WithRetryVotes is for topics nobody but the processor writes to, like the
+// retry topics, whose votes had their tenant resolved before and carry no
+// API key. With a key the messages must be signed with it, see
+// WithSigningKey, and the ones that aren't come back as a
+// RejectedMessageError, whoever wrote them. A nil key is only for
+// single-tenant deployments
+func WithRetryVotes(key []byte) ConsumerOption {
+	return func(kc *KafkaConsumer) {
+		kc.retryVotes = true
+		kc.signingKey = key
+	}
+}
+
+func NewKafkaConsumer(brokers []string, topic, groupID string, opts ...ConsumerOption) (*KafkaConsumer, error) {
 	rCfg := kafka.ReaderConfig{
 		Brokers:  brokers,
 		Topic:    topic,
@@ -29,15 +91,24 @@ func NewKafkaConsumer(brokers []string, topic, groupID string) (*KafkaConsumer,
 		// from the last post in the topic (we don't reprocess the history)
 		StartOffset: kafka.FirstOffset,
 	}
-	r := kafka.NewReader(rCfg)
 
-	return &KafkaConsumer{reader: r}, nil
+	kc := &KafkaConsumer{}
+	for _, opt := range opts {
+		opt(kc)
+	}
+	if kc.offsets != nil {
+		rCfg.IsolationLevel = kafka.ReadCommitted
+	}
+	kc.reader = kafka.NewReader(rCfg)
+	return kc, nil
 }
 
 func (kc *KafkaConsumer) ReadMessage(ctx context.Context) (model.Vote, error) {
-	// `ReadMessage` is a blocking call. It waits until a new
-	// message arrives, or the context is canceled
-	msg, err := kc.reader.ReadMessage(ctx)
+	// `FetchMessage` is a blocking call. It waits until a new
+	// message arrives, or the context is canceled. Unlike `ReadMessage`
+	// it doesn't commit the message, so it's not committed before its delay
+	msg, err := kc.reader.FetchMessage(ctx)
+	receivedAt := time.Now()
 	if err != nil {
 		// If the error is context canceled or EOF (end of stream),
 		// it's a clean shutdown signal, so we return the error so
@@ -51,16 +122,74 @@ func (kc *KafkaConsumer) ReadMessage(ctx context.Context) (model.Vote, error) {
 		return model.Vote{}, err
 	}
 
+	if wait := time.Until(msg.Time.Add(kc.delay)); kc.delay > 0 && wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return model.Vote{}, ctx.Err() // not committed, so it's read again
+		}
+	}
+	if kc.offsets == nil {
+		if err := kc.reader.CommitMessages(ctx, msg); err != nil {
+			log.Printf("error committing message: %v", err)
+			return model.Vote{}, err
+		}
+	}
+
 	// sucessfull read, deserialize the message
 	var vote model.Vote
-	if err := json.Unmarshal(msg.Value, &vote); err != nil {
-		log.Printf("error deserializing vote: %v", err)
-		return model.Vote{}, err
+	if kc.retryVotes {
+		vote, err = decodeRetryVote(msg, kc.signingKey)
+	} else {
+		vote, err = decodeVote(msg, kc.resolver)
+	}
+	// The time the checks go by. It isn't msg.Time: kafka-go hands out the
+	// producer's record timestamp even when the topic has the broker stamp it,
+	// so it's no more trustworthy than the vote's own. A consumer that lags
+	// checks votes as late as it reads them. A retried vote keeps the time it
+	// was first read at
+	if vote.ReceivedAt.IsZero() {
+		vote.ReceivedAt = receivedAt
+	}
+	if kc.offsets != nil {
+		source := kc.offsets.track(msg)
+		var rejected *RejectedMessageError
+		switch {
+		case errors.As(err, &rejected):
+			// the processor still sends it to the DLQ, and acks it then
+			rejected.Vote.Source = source
+			if rejected.Vote.VoteID == "" {
+				rejected.Vote.VoteID = source
+			}
+		case err != nil:
+			// nobody will ever process it, so it mustn't hold the partition back
+			if err := kc.offsets.ack(ctx, source, kc.reader.CommitMessages); err != nil {
+				log.Printf("error committing undecodable message: %v", err)
+			}
+		default:
+			vote.Source = source
+			if vote.VoteID == "" {
+				vote.VoteID = source
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("error decoding vote: %v", err)
+		return vote, err
 	}
 
 	return vote, nil
 }
 
+// Ack commits the offset of a vote read with WithCommitAfterProcessing, as
+// soon as every vote read before it from its partition was acked too
+func (kc *KafkaConsumer) Ack(ctx context.Context, v model.Vote) error {
+	if kc.offsets == nil || v.Source == "" {
+		return nil // already committed when it was read
+	}
+	return kc.offsets.ack(ctx, v.Source, kc.reader.CommitMessages)
+}
+
 func (kc *KafkaConsumer) Close() error {
 	if err := kc.reader.Close(); err != nil {
 		return fmt.Errorf("failed to close kafka reader: %v", err)
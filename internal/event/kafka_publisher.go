@@ -2,6 +2,7 @@ package event
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -11,7 +12,37 @@ import (
 )
 
 type KafkaPublisher struct {
-	writer *kafka.Writer
+	writer     *kafka.Writer
+	apiKey     string
+	channel    string
+	signingKey []byte
+}
+
+type PublisherOption func(*KafkaPublisher)
+
+// WithAPIKey sends every message with the API key that tells the consumer which
+// tenant the votes belong to
+func WithAPIKey(key string) PublisherOption {
+	return func(kp *KafkaPublisher) {
+		kp.apiKey = key
+	}
+}
+
+// WithChannel stamps every vote with the ingest channel, e.g. "web" or
+// "mobile", over whatever channel the client put in it
+func WithChannel(channel string) PublisherOption {
+	return func(kp *KafkaPublisher) {
+		kp.channel = channel
+	}
+}
+
+// WithSigningKey signs every message with an HMAC of its payload and headers,
+// for topics nobody but the processor writes to, whose readers trust the
+// tenant in the payload once it checks out, see WithRetryVotes
+func WithSigningKey(key []byte) PublisherOption {
+	return func(kp *KafkaPublisher) {
+		kp.signingKey = key
+	}
 }
 
 /*
@@ -36,7 +67,7 @@ Compression: kafka.Snappy: Our votes will be sent as JSON (text), which compress
 Using compression is an excellent practice that reduces network bandwidth usage and storage
 space on brokers, resulting in cost savings and often higher throughput.
 */
-func NewKafkaPublisher(brokers []string, topic string) (*KafkaPublisher, error) {
+func NewKafkaPublisher(brokers []string, topic string, opts ...PublisherOption) (*KafkaPublisher, error) {
 	w := &kafka.Writer{
 		Addr:         kafka.TCP(brokers...),
 		Topic:        topic,
@@ -47,10 +78,21 @@ func NewKafkaPublisher(brokers []string, topic string) (*KafkaPublisher, error)
 		Compression:  kafka.Snappy,
 	}
 
-	return &KafkaPublisher{writer: w}, nil
+	kp := &KafkaPublisher{writer: w}
+	for _, opt := range opts {
+		opt(kp)
+	}
+	return kp, nil
 }
 
-func (kp *KafkaPublisher) PublishMessage(ctx context.Context, vote model.Vote, key string) error {
+func (kp *KafkaPublisher) PublishMessage(ctx context.Context, vote model.Vote, key string, headers ...Header) error {
+	// the writer's retries resend these same bytes, so every copy has the same ID
+	if vote.VoteID == "" {
+		vote.VoteID = rand.Text()
+	}
+	if kp.channel != "" {
+		vote.Metadata.Channel = kp.channel
+	}
 	vb, err := json.Marshal(vote)
 	if err != nil {
 		return fmt.Errorf("failed to marshal vote: %v", err)
@@ -59,6 +101,17 @@ func (kp *KafkaPublisher) PublishMessage(ctx context.Context, vote model.Vote, k
 	msg := kafka.Message{
 		Key:   []byte(key), // PollID
 		Value: vb,
+		// kafka-go would send no timestamp, and the delay of a retry topic counts from it
+		Time: time.Now(),
+	}
+	if kp.apiKey != "" {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: APIKeyHeader, Value: []byte(kp.apiKey)})
+	}
+	for _, h := range headers {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: h.Key, Value: []byte(h.Value)})
+	}
+	if kp.signingKey != nil {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: SignatureHeader, Value: []byte(sign(kp.signingKey, vb, msg.Headers))})
 	}
 
 	if err := kp.writer.WriteMessages(ctx, msg); err != nil {
@@ -0,0 +1,153 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/tenant"
+	"github.com/segmentio/kafka-go"
+)
+
+/*
+ReplayTopic reads every vote in the topic from the earliest offset and hands
+it to fn, one partition after the other and in order within each, returning
+how many votes were replayed.
+
+It stops at the end of each partition as it was when the replay started, so
+votes published meanwhile aren't replayed. The partitions are read directly,
+without a consumer group, so nothing is committed and nothing is left behind
+on the brokers. Tenants are resolved with resolver like the consumer does, and
+votes it would have rejected for their credentials are skipped. An error from
+fn stops the replay and is returned.
+
+The votes are handed over without a ReceivedAt: when the live consumer got
+them isn't in the topic, and the message time is the producer's.
+*/
+func ReplayTopic(ctx context.Context, brokers []string, topic string, resolver tenant.Resolver, fn func(context.Context, model.Vote) error) (int, error) {
+	return replay(ctx, brokers, topic, func(ctx context.Context, msg kafka.Message) (bool, error) {
+		vote, err := decodeVote(msg, resolver)
+		if err != nil {
+			log.Printf("Skipping message at partition %d offset %d: %v", msg.Partition, msg.Offset, err)
+			return false, nil
+		}
+		return true, fn(ctx, vote)
+	})
+}
+
+/*
+ReplayRejections reads a topic the processor publishes votes to, like the DLQ
+or the review topic, the way ReplayTopic reads the votes topic. Those votes
+were resolved already, so they keep the tenant in their payload: only the
+processor is meant to write these topics. fn also gets the validator a DLQ
+vote failed, empty when it was rejected for something else or the topic
+isn't the DLQ.
+*/
+func ReplayRejections(ctx context.Context, brokers []string, topic string, fn func(ctx context.Context, v model.Vote, rule string) error) (int, error) {
+	return replay(ctx, brokers, topic, func(ctx context.Context, msg kafka.Message) (bool, error) {
+		var vote model.Vote
+		if err := json.Unmarshal(msg.Value, &vote); err != nil {
+			log.Printf("Skipping message at partition %d offset %d: error deserializing vote: %v", msg.Partition, msg.Offset, err)
+			return false, nil
+		}
+		var rule string
+		for _, h := range msg.Headers {
+			if h.Key == RejectRuleHeader {
+				rule = string(h.Value)
+			}
+		}
+		return true, fn(ctx, vote, rule)
+	})
+}
+
+// replay hands every message of the topic to handle, which reports whether
+// it was a vote
+func replay(ctx context.Context, brokers []string, topic string, handle func(context.Context, kafka.Message) (bool, error)) (int, error) {
+	ends, err := endOffsets(ctx, brokers[0], topic)
+	if err != nil {
+		return 0, err
+	}
+
+	partitions := slices.Sorted(maps.Keys(ends))
+	n := 0
+	for _, p := range partitions {
+		replayed, err := replayPartition(ctx, brokers, topic, p, ends[p], handle)
+		n += replayed
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// replayPartition replays one partition from its earliest offset up to end
+func replayPartition(ctx context.Context, brokers []string, topic string, partition int, end int64, handle func(context.Context, kafka.Message) (bool, error)) (int, error) {
+	// without a GroupID the reader starts at the first offset and commits nothing
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   brokers,
+		Topic:     topic,
+		Partition: partition,
+		MinBytes:  10e3, // 10kb
+		MaxBytes:  10e6, // 10mb
+		MaxWait:   1 * time.Second,
+	})
+	defer r.Close()
+
+	n := 0
+	for {
+		msg, err := r.ReadMessage(ctx)
+		if err != nil {
+			return n, fmt.Errorf("error reading message from kafka: %v", err)
+		}
+
+		ok, err := handle(ctx, msg)
+		if err != nil {
+			return n, fmt.Errorf("error replaying message at partition %d offset %d: %v", msg.Partition, msg.Offset, err)
+		}
+		if ok {
+			n++
+		}
+
+		if msg.Offset+1 >= end {
+			return n, nil // replayed up to where the partition ended
+		}
+	}
+}
+
+// endOffsets returns the offset after the last message of every non-empty partition
+func endOffsets(ctx context.Context, broker, topic string) (map[int]int64, error) {
+	conn, err := kafka.DialContext(ctx, "tcp", broker)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to kafka: %v", err)
+	}
+	defer conn.Close()
+
+	partitions, err := conn.ReadPartitions(topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read partitions of %s: %v", topic, err)
+	}
+
+	ends := make(map[int]int64, len(partitions))
+	for _, p := range partitions {
+		lc, err := kafka.DialLeader(ctx, "tcp", broker, topic, p.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to leader of partition %d: %v", p.ID, err)
+		}
+		first, last, err := lc.ReadOffsets()
+		lc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read offsets of partition %d: %v", p.ID, err)
+		}
+		if last > first {
+			ends[p.ID] = last
+		}
+	}
+
+	return ends, nil
+}
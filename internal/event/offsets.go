@@ -0,0 +1,97 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+/*
+offsetTracker commits the offsets of a consumer that commits after
+processing. Votes are processed by several workers, so they're acked out of
+order, but a partition is only committed up to the first vote that isn't
+acked yet: a crash never gets an offset past a vote that wasn't processed
+committed, and it's all redelivered from there.
+
+Commits are made under the lock, so two acks can't commit a partition
+backwards.
+*/
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int][]*pendingMessage // in fetch order
+	bySource   map[string]*pendingMessage
+}
+
+type pendingMessage struct {
+	msg   kafka.Message
+	acked bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		partitions: make(map[int][]*pendingMessage),
+		bySource:   make(map[string]*pendingMessage),
+	}
+}
+
+// messageSource is the topic/partition/offset a message is known by
+func messageSource(msg kafka.Message) string {
+	return fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+}
+
+// track remembers a fetched message until it's acked
+func (t *offsetTracker) track(msg kafka.Message) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending := t.partitions[msg.Partition]
+	if n := len(pending); n > 0 && msg.Offset <= pending[n-1].msg.Offset {
+		// the reader went back to the committed offset, after a rebalance,
+		// so what we were waiting on is being delivered again
+		for _, p := range pending {
+			delete(t.bySource, messageSource(p.msg))
+		}
+		pending = nil
+	}
+
+	source := messageSource(msg)
+	p := &pendingMessage{msg: msg}
+	t.partitions[msg.Partition] = append(pending, p)
+	t.bySource[source] = p
+	return source
+}
+
+// ack marks a message as processed and commits its partition as far as
+// every message before it was processed too
+func (t *offsetTracker) ack(ctx context.Context, source string, commit func(context.Context, ...kafka.Message) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.bySource[source]
+	if !ok {
+		return nil // dropped by a rebalance, it's being redelivered
+	}
+	p.acked = true
+
+	partition := p.msg.Partition
+	pending := t.partitions[partition]
+	done := 0
+	for done < len(pending) && pending[done].acked {
+		done++
+	}
+	if done == 0 {
+		return nil
+	}
+
+	last := pending[done-1].msg
+	if err := commit(ctx, last); err != nil {
+		return fmt.Errorf("failed to commit offset %d of partition %d: %v", last.Offset, partition, err)
+	}
+	for _, p := range pending[:done] {
+		delete(t.bySource, messageSource(p.msg))
+	}
+	t.partitions[partition] = pending[done:]
+	return nil
+}
@@ -0,0 +1,143 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// commits records the offsets an offsetTracker commits, per partition
+type commits map[int][]int64
+
+func (c commits) commit(_ context.Context, msgs ...kafka.Message) error {
+	for _, m := range msgs {
+		c[m.Partition] = append(c[m.Partition], m.Offset)
+	}
+	return nil
+}
+
+func message(partition int, offset int64) kafka.Message {
+	return kafka.Message{Topic: "votes", Partition: partition, Offset: offset}
+}
+
+func TestOffsetTrackerOutOfOrderAcks(t *testing.T) {
+	ctx := context.Background()
+	tr := newOffsetTracker()
+	c := commits{}
+
+	var sources []string
+	for offset := range int64(4) {
+		sources = append(sources, tr.track(message(0, offset)))
+	}
+
+	// acks after a gap wait for the gap to be acked
+	for _, i := range []int{2, 1, 3} {
+		if err := tr.ack(ctx, sources[i], c.commit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c[0]) != 0 {
+		t.Fatalf("committed %v with offset 0 not acked", c[0])
+	}
+
+	// and closing it commits everything acked after it at once
+	if err := tr.ack(ctx, sources[0], c.commit); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{3}; !slices.Equal(c[0], want) {
+		t.Fatalf("committed %v, want %v", c[0], want)
+	}
+
+	// an ack of an already committed message commits nothing again
+	if err := tr.ack(ctx, sources[1], c.commit); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{3}; !slices.Equal(c[0], want) {
+		t.Fatalf("committed %v after a repeated ack, want %v", c[0], want)
+	}
+}
+
+func TestOffsetTrackerPartitions(t *testing.T) {
+	ctx := context.Background()
+	tr := newOffsetTracker()
+	c := commits{}
+
+	held := tr.track(message(0, 10))
+	p0 := tr.track(message(0, 11))
+	p1 := tr.track(message(1, 10))
+
+	// a partition isn't held back by another one's gap
+	for _, source := range []string{p0, p1} {
+		if err := tr.ack(ctx, source, c.commit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c[0]) != 0 || !slices.Equal(c[1], []int64{10}) {
+		t.Fatalf("committed %v, want only offset 10 of partition 1", c)
+	}
+
+	if err := tr.ack(ctx, held, c.commit); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(c[0], []int64{11}) {
+		t.Fatalf("committed %v of partition 0, want [11]", c[0])
+	}
+}
+
+func TestOffsetTrackerRebalance(t *testing.T) {
+	ctx := context.Background()
+	tr := newOffsetTracker()
+	c := commits{}
+
+	old0 := tr.track(message(0, 5))
+	old1 := tr.track(message(0, 6))
+
+	// the partition came back from the committed offset: what was pending is
+	// delivered again, and the acks of the old copies are dropped
+	again := tr.track(message(0, 5))
+	for _, source := range []string{old1, old0} {
+		if err := tr.ack(ctx, source, c.commit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the sources are the same, so the ack of the first copy is the new one's
+	if !slices.Equal(c[0], []int64{5}) {
+		t.Fatalf("committed %v after the rebalance, want [5]", c[0])
+	}
+
+	next := tr.track(message(0, 6))
+	if err := tr.ack(ctx, again, c.commit); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.ack(ctx, next, c.commit); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(c[0], []int64{5, 6}) {
+		t.Fatalf("committed %v, want [5 6]", c[0])
+	}
+}
+
+func TestOffsetTrackerCommitFailure(t *testing.T) {
+	ctx := context.Background()
+	tr := newOffsetTracker()
+	c := commits{}
+
+	first := tr.track(message(0, 1))
+	second := tr.track(message(0, 2))
+
+	failing := func(context.Context, ...kafka.Message) error { return errors.New("broker down") }
+	if err := tr.ack(ctx, first, failing); err == nil {
+		t.Fatal("ack with a failing commit returned no error")
+	}
+
+	// the failed commit stays pending, so the next ack commits past it
+	if err := tr.ack(ctx, second, c.commit); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(c[0], []int64{2}) {
+		t.Fatalf("committed %v, want [2]", c[0])
+	}
+}
@@ -6,7 +6,35 @@ import (
 	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
 )
 
+// The headers a rejected vote carries on its way to the DLQ: the validator
+// that turned it down (empty when it wasn't a validator), the reason, which
+// is also the reason label of the rejection metrics, and the details
+const (
+	RejectRuleHeader   = "reject-rule"
+	RejectReasonHeader = "reject-reason"
+	RejectErrorHeader  = "reject-error"
+)
+
+// The headers of a vote on a retry topic: the store error that sent it there,
+// when the consumer first read it (RFC 3339) and "true" when it already went
+// through the checks, see model.Vote
+const (
+	RetryErrorHeader = "retry-error"
+	ReceivedAtHeader = "received-at"
+	CheckedHeader    = "checked"
+)
+
+// FraudSignalsHeader lists the signals a quarantined vote was flagged by,
+// comma separated, on the review topic
+const FraudSignalsHeader = "fraud-signals"
+
+// Header is a message header, sent along with the vote
+type Header struct {
+	Key   string
+	Value string
+}
+
 type VotePublisher interface {
-	PublishMessage(ctx context.Context, vote model.Vote, key string) error
+	PublishMessage(ctx context.Context, vote model.Vote, key string, headers ...Header) error
 	Close() error
 }
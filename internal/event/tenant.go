@@ -0,0 +1,125 @@
+package event
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/tenant"
+	"github.com/segmentio/kafka-go"
+)
+
+// APIKeyHeader is the Kafka header producers put their API key in
+const APIKeyHeader = "api-key"
+
+// SignatureHeader carries the HMAC of a message the processor wrote for
+// itself, see WithSigningKey
+const SignatureHeader = "signature"
+
+var errBadSignature = errors.New("message signature doesn't match")
+
+// RejectedMessageError is returned for a message that was read and decoded
+// but must not be processed, like one published with credentials no tenant
+// owns. It carries the vote so it can still go to the DLQ
+type RejectedMessageError struct {
+	Vote   model.Vote
+	Reason string
+	Err    error
+}
+
+func (e *RejectedMessageError) Error() string {
+	return fmt.Sprintf("vote rejected (%s): %v", e.Reason, e.Err)
+}
+
+func (e *RejectedMessageError) Unwrap() error { return e.Err }
+
+// decodeVote reads a vote from a message of the votes topic. The tenant
+// comes from the message's API key, never from the payload
+func decodeVote(msg kafka.Message, r tenant.Resolver) (model.Vote, error) {
+	var vote model.Vote
+	if err := json.Unmarshal(msg.Value, &vote); err != nil {
+		return model.Vote{}, fmt.Errorf("error deserializing vote: %v", err)
+	}
+
+	var apiKey string
+	for _, h := range msg.Headers {
+		if h.Key == APIKeyHeader {
+			apiKey = string(h.Value)
+		}
+	}
+
+	tenantID, err := tenant.Resolve(r, apiKey)
+	vote.TenantID = tenantID
+	if err != nil {
+		reason := "unknown_credentials"
+		if apiKey == "" {
+			reason = "missing_credentials"
+		}
+		return vote, &RejectedMessageError{Vote: vote, Reason: reason, Err: err}
+	}
+	return vote, nil
+}
+
+// sign is the HMAC-SHA256 of a message's value and headers, hex encoded. The
+// headers go in length-prefixed, so they can't be shifted into each other
+func sign(key, value []byte, headers []kafka.Header) string {
+	mac := hmac.New(sha256.New, key)
+	for _, b := range append([][]byte{value}, headerBytes(headers)...) {
+		binary.Write(mac, binary.BigEndian, uint32(len(b)))
+		mac.Write(b)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func headerBytes(headers []kafka.Header) [][]byte {
+	var b [][]byte
+	for _, h := range headers {
+		if h.Key != SignatureHeader {
+			b = append(b, []byte(h.Key), h.Value)
+		}
+	}
+	return b
+}
+
+/*
+decodeRetryVote reads a vote the processor published for itself, like the
+ones of the retry topics. Its tenant was resolved before and is in the
+payload, and the headers say whether it went through the checks and when it
+was first read. With a key, all of that is only trusted when the message was
+signed with it. Without one every vote is the default tenant's.
+*/
+func decodeRetryVote(msg kafka.Message, key []byte) (model.Vote, error) {
+	var vote model.Vote
+	if err := json.Unmarshal(msg.Value, &vote); err != nil {
+		return model.Vote{}, fmt.Errorf("error deserializing vote: %v", err)
+	}
+
+	var signature string
+	for _, h := range msg.Headers {
+		switch h.Key {
+		case SignatureHeader:
+			signature = string(h.Value)
+		case CheckedHeader:
+			vote.Checked = string(h.Value) == "true"
+		case ReceivedAtHeader:
+			if t, err := time.Parse(time.RFC3339Nano, string(h.Value)); err == nil {
+				vote.ReceivedAt = t
+			}
+		}
+	}
+	if key == nil {
+		vote.TenantID = ""
+		return vote, nil
+	}
+	if !hmac.Equal([]byte(signature), []byte(sign(key, msg.Value, msg.Headers))) {
+		vote.TenantID, vote.Checked, vote.ReceivedAt = "", false, time.Time{}
+		return vote, &RejectedMessageError{Vote: vote, Reason: "bad_signature", Err: errBadSignature}
+	}
+	return vote, nil
+}
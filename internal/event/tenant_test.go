@@ -0,0 +1,58 @@
+package event
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestDecodeRetryVote(t *testing.T) {
+	key := []byte("retry-key")
+	value := []byte(`{"poll_id":"p","user_id":"u","option_id":"a","tenant_id":"acme"}`)
+	receivedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	headers := []kafka.Header{
+		{Key: RetryErrorHeader, Value: []byte("store down")},
+		{Key: ReceivedAtHeader, Value: []byte(receivedAt.Format(time.RFC3339Nano))},
+		{Key: CheckedHeader, Value: []byte("true")},
+	}
+	signed := func(v []byte, k []byte, hs []kafka.Header) kafka.Message {
+		hs = append(hs[:len(hs):len(hs)], kafka.Header{Key: SignatureHeader, Value: []byte(sign(k, v, hs))})
+		return kafka.Message{Value: v, Headers: hs}
+	}
+
+	vote, err := decodeRetryVote(signed(value, key, headers), key)
+	if err != nil {
+		t.Fatalf("decodeRetryVote: %v", err)
+	}
+	if vote.TenantID != "acme" || !vote.Checked || !vote.ReceivedAt.Equal(receivedAt) {
+		t.Fatalf("got tenant %q checked %v received at %v, want acme, true and %v", vote.TenantID, vote.Checked, vote.ReceivedAt, receivedAt)
+	}
+
+	// without a key nothing is checked, and the tenant isn't taken
+	if vote, err := decodeRetryVote(kafka.Message{Value: value, Headers: headers}, nil); err != nil || vote.TenantID != "" || !vote.Checked {
+		t.Fatalf("without a key got tenant %q checked %v, %v", vote.TenantID, vote.Checked, err)
+	}
+
+	payloadEdited := signed(value, key, headers)
+	payloadEdited.Value = []byte(`{"poll_id":"p","user_id":"u","option_id":"a","tenant_id":"other"}`)
+	headerAdded := signed(value, key, headers[:2])
+	headerAdded.Headers = append(headerAdded.Headers, kafka.Header{Key: CheckedHeader, Value: []byte("true")})
+	for name, msg := range map[string]kafka.Message{
+		"unsigned":       {Value: value, Headers: headers},
+		"other key":      signed(value, []byte("not-the-key"), headers),
+		"payload edited": payloadEdited,
+		"header added":   headerAdded,
+	} {
+		vote, err := decodeRetryVote(msg, key)
+		var rejected *RejectedMessageError
+		if !errors.As(err, &rejected) || rejected.Reason != "bad_signature" {
+			t.Errorf("%s: got %v, want a bad_signature rejection", name, err)
+			continue
+		}
+		if vote.TenantID != "" || vote.Checked {
+			t.Errorf("%s: kept tenant %q checked %v from an untrusted message", name, vote.TenantID, vote.Checked)
+		}
+	}
+}
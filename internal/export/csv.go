@@ -0,0 +1,56 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// optionSeparator joins a vote's options in a single CSV field, keeping their order
+const optionSeparator = ";"
+
+func writeVotesCSV(w io.Writer, rows []VoteRow) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"tenant_id", "poll_id", "user_id", "option_ids", "weight", "cast_at",
+		"source_ip", "device_id", "user_agent", "app_version", "channel", "geo_bucket"})
+	for _, r := range rows {
+		castAt := ""
+		if !r.CastAt.IsZero() {
+			castAt = r.CastAt.UTC().Format(time.RFC3339Nano)
+		}
+		cw.Write([]string{
+			r.TenantID,
+			r.PollID,
+			r.UserID,
+			strings.Join(r.OptionIDs, optionSeparator),
+			strconv.FormatFloat(r.Weight, 'f', -1, 64),
+			castAt,
+			r.Metadata.SourceIP,
+			r.Metadata.DeviceID,
+			r.Metadata.UserAgent,
+			r.Metadata.AppVersion,
+			r.Metadata.Channel,
+			r.Metadata.GeoBucket,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeTallyCSV(w io.Writer, rows []TallyRow) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"tenant_id", "poll_id", "option_id", "votes", "weight"})
+	for _, r := range rows {
+		cw.Write([]string{
+			r.TenantID,
+			r.PollID,
+			r.OptionID,
+			strconv.Itoa(r.Votes),
+			strconv.FormatFloat(r.Weight, 'f', -1, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
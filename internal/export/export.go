@@ -0,0 +1,172 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+)
+
+// Format is the file format polls are exported in
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatJSONL   Format = "jsonl"
+	FormatParquet Format = "parquet"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatCSV, FormatJSONL, FormatParquet:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown export format %q, want csv, jsonl or parquet", s)
+	}
+}
+
+// VoteRow is one user's vote as exported. OptionIDs are in the order the user
+// gave them, which for ranked polls is the ballot
+type VoteRow struct {
+	TenantID  string   `json:"tenant_id,omitempty"`
+	PollID    string   `json:"poll_id"`
+	UserID    string   `json:"user_id"`
+	OptionIDs []string `json:"option_ids"`
+	Weight    float64  `json:"weight"`
+	// CastAt is zero for votes stored before their time was kept
+	CastAt time.Time `json:"cast_at,omitzero"`
+	// Metadata is flattened to a column per field in CSV and Parquet, which
+	// leave its Extra out; JSON Lines has all of it
+	Metadata model.VoteMetadata `json:"metadata,omitzero"`
+}
+
+// TallyRow is one option of a poll's final tally
+type TallyRow struct {
+	TenantID string  `json:"tenant_id,omitempty"`
+	PollID   string  `json:"poll_id"`
+	OptionID string  `json:"option_id"`
+	Votes    int     `json:"votes"`
+	Weight   float64 `json:"weight"`
+}
+
+/*
+Exporter writes a poll's votes and final tally to two files in dir:
+
+	<poll id>.votes.<format>  one row per user with a vote
+	<poll id>.tally.<format>  one row per option
+
+The default tenant's polls go straight in dir and every other tenant's under
+tenants/<tenant id>/, with the IDs path-escaped. Rows are sorted by user and
+by option, so exporting the same poll twice gives the same files, and each file
+is written next to its final name and renamed into place.
+*/
+type Exporter struct {
+	dir    string
+	format Format
+}
+
+func New(dir string, format Format) (*Exporter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating export directory: %v", err)
+	}
+	return &Exporter{dir: dir, format: format}, nil
+}
+
+// ExportPoll exports a poll as the store has it now, returning the files written
+func (e *Exporter) ExportPoll(ctx context.Context, s store.VoteStore, tenantID, pollID string) ([]string, error) {
+	votes, err := s.ListVotes(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := s.GetResults(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+	weighted, err := s.GetWeightedResults(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	voteRows := make([]VoteRow, 0, len(votes))
+	for _, v := range votes {
+		voteRows = append(voteRows, VoteRow{TenantID: tenantID, PollID: pollID, UserID: v.UserID, OptionIDs: v.OptionIDs, Weight: v.Weight, CastAt: v.CastAt, Metadata: v.Metadata})
+	}
+	slices.SortFunc(voteRows, func(a, b VoteRow) int { return strings.Compare(a.UserID, b.UserID) })
+
+	tallyRows := make([]TallyRow, 0, len(counts))
+	for optionID, n := range counts {
+		tallyRows = append(tallyRows, TallyRow{TenantID: tenantID, PollID: pollID, OptionID: optionID, Votes: n, Weight: weighted[optionID]})
+	}
+	slices.SortFunc(tallyRows, func(a, b TallyRow) int { return strings.Compare(a.OptionID, b.OptionID) })
+
+	votesPath, tallyPath := e.path(tenantID, pollID, "votes"), e.path(tenantID, pollID, "tally")
+	if err := e.writeFile(votesPath, func(w io.Writer) error { return writeVotes(w, e.format, voteRows) }); err != nil {
+		return nil, err
+	}
+	if err := e.writeFile(tallyPath, func(w io.Writer) error { return writeTally(w, e.format, tallyRows) }); err != nil {
+		return nil, err
+	}
+	return []string{votesPath, tallyPath}, nil
+}
+
+func (e *Exporter) path(tenantID, pollID, kind string) string {
+	name := fmt.Sprintf("%s.%s.%s", url.PathEscape(pollID), kind, e.format)
+	if tenantID == "" {
+		return filepath.Join(e.dir, name)
+	}
+	return filepath.Join(e.dir, "tenants", url.PathEscape(tenantID), name)
+}
+
+func (e *Exporter) writeFile(path string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("error creating export directory: %v", err)
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", path, err)
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return nil
+}
+
+func writeVotes(w io.Writer, f Format, rows []VoteRow) error {
+	switch f {
+	case FormatCSV:
+		return writeVotesCSV(w, rows)
+	case FormatParquet:
+		return writeVotesParquet(w, rows)
+	default:
+		return writeJSONL(w, rows)
+	}
+}
+
+func writeTally(w io.Writer, f Format, rows []TallyRow) error {
+	switch f {
+	case FormatCSV:
+		return writeTallyCSV(w, rows)
+	case FormatParquet:
+		return writeTallyParquet(w, rows)
+	default:
+		return writeJSONL(w, rows)
+	}
+}
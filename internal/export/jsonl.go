@@ -0,0 +1,17 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// writeJSONL writes one JSON object per line
+func writeJSONL[T any](w io.Writer, rows []T) error {
+	enc := json.NewEncoder(w)
+	for _, r := range rows {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+/*
+A minimal Parquet writer, just enough for the export files: one row group,
+one uncompressed data page per column, PLAIN values and RLE levels. Columns
+are flat, optional for a missing timestamp, and repeated for a vote's options
+(the legacy list form every reader still understands), so nothing deeper than
+one level of nesting is ever needed.
+
+The footer is Thrift's compact protocol, written by hand in thriftWriter.
+Field IDs and enum values below come from parquet.thrift.
+*/
+
+// physical types
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+)
+
+// repetition types
+const (
+	parquetRequired = 0
+	parquetOptional = 1
+	parquetRepeated = 2
+)
+
+// converted types, noConvertedType leaves it out
+const (
+	noConvertedType        = -1
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+)
+
+// encodings
+const (
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+const parquetMagic = "PAR1"
+
+// parquetColumn buffers a column's PLAIN values and, for optional and
+// repeated columns, its definition and repetition levels
+type parquetColumn struct {
+	name       string
+	typ        int32
+	repetition int32
+	converted  int32
+
+	values    bytes.Buffer
+	defLevels []int
+	repLevels []int
+}
+
+func newColumn(name string, typ, repetition, converted int32) *parquetColumn {
+	return &parquetColumn{name: name, typ: typ, repetition: repetition, converted: converted}
+}
+
+func (c *parquetColumn) putString(s string) {
+	binary.Write(&c.values, binary.LittleEndian, uint32(len(s)))
+	c.values.WriteString(s)
+}
+
+// defined records the definition level of a value that's there, which is
+// 0 for a required column and 1 for the others
+func (c *parquetColumn) defined() {
+	c.defLevels = append(c.defLevels, min(int(c.repetition), 1))
+}
+
+func (c *parquetColumn) String(s string) {
+	c.putString(s)
+	c.defined()
+}
+
+func (c *parquetColumn) Double(v float64) {
+	binary.Write(&c.values, binary.LittleEndian, math.Float64bits(v))
+	c.defined()
+}
+
+func (c *parquetColumn) Int64(v int64) {
+	binary.Write(&c.values, binary.LittleEndian, v)
+	c.defined()
+}
+
+// Null is a missing value of an optional column
+func (c *parquetColumn) Null() {
+	c.defLevels = append(c.defLevels, 0)
+}
+
+// Strings is a row of a repeated column. An empty list has no value, only levels
+func (c *parquetColumn) Strings(ss []string) {
+	if len(ss) == 0 {
+		c.defLevels = append(c.defLevels, 0)
+		c.repLevels = append(c.repLevels, 0)
+		return
+	}
+	for i, s := range ss {
+		c.putString(s)
+		c.defined()
+		c.repLevels = append(c.repLevels, min(i, 1))
+	}
+}
+
+// page is the column's data page: its levels, if it has any, then the values
+func (c *parquetColumn) page() []byte {
+	var b bytes.Buffer
+	if c.repetition == parquetRepeated {
+		writeLevels(&b, c.repLevels)
+	}
+	if c.repetition != parquetRequired {
+		writeLevels(&b, c.defLevels)
+	}
+	b.Write(c.values.Bytes())
+	return b.Bytes()
+}
+
+// writeLevels writes levels of at most 1 as RLE runs, prefixed by their length
+func writeLevels(w *bytes.Buffer, levels []int) {
+	var runs []byte
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		runs = binary.AppendUvarint(runs, uint64(j-i)<<1)
+		runs = append(runs, byte(levels[i]))
+		i = j
+	}
+	binary.Write(w, binary.LittleEndian, uint32(len(runs)))
+	w.Write(runs)
+}
+
+// writeParquet writes the columns as a single row group of numRows rows
+func writeParquet(w io.Writer, numRows int, columns []*parquetColumn) error {
+	var out bytes.Buffer
+	out.WriteString(parquetMagic)
+
+	type chunk struct {
+		offset, size int64
+	}
+	chunks := make([]chunk, len(columns))
+	for i, c := range columns {
+		page := c.page()
+
+		var h thriftWriter
+		h.begin()
+		h.i32(1, 0) // DATA_PAGE
+		h.i32(2, int32(len(page)))
+		h.i32(3, int32(len(page)))
+		h.beginStruct(5)
+		h.i32(1, int32(len(c.defLevels)))
+		h.i32(2, parquetPlain)
+		h.i32(3, parquetRLE)
+		h.i32(4, parquetRLE)
+		h.endStruct()
+		h.end()
+
+		chunks[i] = chunk{offset: int64(out.Len()), size: int64(h.buf.Len() + len(page))}
+		out.Write(h.buf.Bytes())
+		out.Write(page)
+	}
+
+	var m thriftWriter
+	m.begin()
+	m.i32(1, 1) // version
+	m.beginList(2, thriftStruct, len(columns)+1)
+	m.beginElem()
+	m.binary(4, "schema")
+	m.i32(5, int32(len(columns)))
+	m.endStruct()
+	for _, c := range columns {
+		m.beginElem()
+		m.i32(1, c.typ)
+		m.i32(3, c.repetition)
+		m.binary(4, c.name)
+		if c.converted != noConvertedType {
+			m.i32(6, c.converted)
+		}
+		m.endStruct()
+	}
+	m.i64(3, int64(numRows))
+
+	var total int64
+	for _, ch := range chunks {
+		total += ch.size
+	}
+	m.beginList(4, thriftStruct, 1)
+	m.beginElem()
+	m.beginList(1, thriftStruct, len(columns))
+	for i, c := range columns {
+		m.beginElem()
+		m.i64(2, chunks[i].offset)
+		m.beginStruct(3)
+		m.i32(1, c.typ)
+		m.beginList(2, thriftI32, 2)
+		m.elemI32(parquetPlain)
+		m.elemI32(parquetRLE)
+		m.beginList(3, thriftBinary, 1)
+		m.elemBinary(c.name)
+		m.i32(4, 0) // UNCOMPRESSED
+		m.i64(5, int64(len(c.defLevels)))
+		m.i64(6, chunks[i].size)
+		m.i64(7, chunks[i].size)
+		m.i64(9, chunks[i].offset)
+		m.endStruct()
+		m.endStruct()
+	}
+	m.i64(2, total)
+	m.i64(3, int64(numRows))
+	m.endStruct()
+	m.binary(6, "real_time_voting_analysis_system export")
+	m.end()
+
+	out.Write(m.buf.Bytes())
+	binary.Write(&out, binary.LittleEndian, uint32(m.buf.Len()))
+	out.WriteString(parquetMagic)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+func writeVotesParquet(w io.Writer, rows []VoteRow) error {
+	tenantID := newColumn("tenant_id", parquetByteArray, parquetRequired, parquetUTF8)
+	pollID := newColumn("poll_id", parquetByteArray, parquetRequired, parquetUTF8)
+	userID := newColumn("user_id", parquetByteArray, parquetRequired, parquetUTF8)
+	optionIDs := newColumn("option_ids", parquetByteArray, parquetRepeated, parquetUTF8)
+	weight := newColumn("weight", parquetDouble, parquetRequired, noConvertedType)
+	castAt := newColumn("cast_at", parquetInt64, parquetOptional, parquetTimestampMicros)
+	sourceIP := newColumn("source_ip", parquetByteArray, parquetRequired, parquetUTF8)
+	deviceID := newColumn("device_id", parquetByteArray, parquetRequired, parquetUTF8)
+	userAgent := newColumn("user_agent", parquetByteArray, parquetRequired, parquetUTF8)
+	appVersion := newColumn("app_version", parquetByteArray, parquetRequired, parquetUTF8)
+	channel := newColumn("channel", parquetByteArray, parquetRequired, parquetUTF8)
+	geoBucket := newColumn("geo_bucket", parquetByteArray, parquetRequired, parquetUTF8)
+
+	for _, r := range rows {
+		tenantID.String(r.TenantID)
+		pollID.String(r.PollID)
+		userID.String(r.UserID)
+		optionIDs.Strings(r.OptionIDs)
+		weight.Double(r.Weight)
+		if r.CastAt.IsZero() {
+			castAt.Null()
+		} else {
+			castAt.Int64(r.CastAt.UnixMicro())
+		}
+		sourceIP.String(r.Metadata.SourceIP)
+		deviceID.String(r.Metadata.DeviceID)
+		userAgent.String(r.Metadata.UserAgent)
+		appVersion.String(r.Metadata.AppVersion)
+		channel.String(r.Metadata.Channel)
+		geoBucket.String(r.Metadata.GeoBucket)
+	}
+	return writeParquet(w, len(rows), []*parquetColumn{
+		tenantID, pollID, userID, optionIDs, weight, castAt,
+		sourceIP, deviceID, userAgent, appVersion, channel, geoBucket,
+	})
+}
+
+func writeTallyParquet(w io.Writer, rows []TallyRow) error {
+	tenantID := newColumn("tenant_id", parquetByteArray, parquetRequired, parquetUTF8)
+	pollID := newColumn("poll_id", parquetByteArray, parquetRequired, parquetUTF8)
+	optionID := newColumn("option_id", parquetByteArray, parquetRequired, parquetUTF8)
+	votes := newColumn("votes", parquetInt64, parquetRequired, noConvertedType)
+	weight := newColumn("weight", parquetDouble, parquetRequired, noConvertedType)
+
+	for _, r := range rows {
+		tenantID.String(r.TenantID)
+		pollID.String(r.PollID)
+		optionID.String(r.OptionID)
+		votes.Int64(int64(r.Votes))
+		weight.Double(r.Weight)
+	}
+	return writeParquet(w, len(rows), []*parquetColumn{tenantID, pollID, optionID, votes, weight})
+}
+
+// Thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes a struct in Thrift's compact protocol. Field IDs are
+// written as deltas from the previous field of the same struct, so it keeps
+// the last ID of every struct that's still open
+type thriftWriter struct {
+	buf    bytes.Buffer
+	lastID []int16
+}
+
+func (t *thriftWriter) begin() {
+	t.lastID = append(t.lastID, 0)
+}
+
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(0) // stop
+	t.lastID = t.lastID[:len(t.lastID)-1]
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	last := &t.lastID[len(t.lastID)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(int64(id))
+	}
+	*last = id
+}
+
+// varint writes a zigzag varint, the encoding of every integer type
+func (t *thriftWriter) varint(v int64) {
+	t.buf.Write(binary.AppendVarint(nil, v))
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.elemBinary(s)
+}
+
+func (t *thriftWriter) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+func (t *thriftWriter) endStruct() {
+	t.end()
+}
+
+func (t *thriftWriter) beginList(id int16, elemType byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elemType)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elemType)
+	t.buf.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+// beginElem starts a struct element of a list, closed with endStruct
+func (t *thriftWriter) beginElem() {
+	t.begin()
+}
+
+func (t *thriftWriter) elemI32(v int32) {
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) elemBinary(s string) {
+	t.buf.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	t.buf.WriteString(s)
+}
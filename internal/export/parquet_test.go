@@ -0,0 +1,145 @@
+package export
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// parquetColumnData is a column as another Parquet reader sees it
+type parquetColumnData struct {
+	values    []any
+	repLevels []int32
+	defLevels []int32
+}
+
+// readParquet reads every column of a file back with parquet-go, by name
+func readParquet(t *testing.T, b []byte) (int64, map[string]parquetColumnData) {
+	t.Helper()
+	pr, err := reader.NewParquetColumnReader(buffer.NewBufferFileFromBytes(b), 1)
+	if err != nil {
+		t.Fatalf("reading parquet file: %v", err)
+	}
+	defer pr.ReadStop()
+
+	rows := pr.GetNumRows()
+	columns := make(map[string]parquetColumnData)
+	if rows == 0 {
+		return 0, columns
+	}
+	// the first schema element is the root, the rest are the columns in
+	// order. parquet-go renames them, ExName is the name in the file
+	for i := 1; i < len(pr.SchemaHandler.Infos); i++ {
+		name := pr.SchemaHandler.GetExName(i)
+		values, rls, dls, err := pr.ReadColumnByIndex(int64(i-1), rows)
+		if err != nil {
+			t.Fatalf("reading column %s: %v", name, err)
+		}
+		columns[name] = parquetColumnData{values: values, repLevels: rls, defLevels: dls}
+	}
+	return rows, columns
+}
+
+func checkColumn(t *testing.T, columns map[string]parquetColumnData, name string, want parquetColumnData) {
+	t.Helper()
+	got, ok := columns[name]
+	if !ok {
+		t.Errorf("no column %s", name)
+		return
+	}
+	if !reflect.DeepEqual(got.values, want.values) {
+		t.Errorf("column %s has values %v, want %v", name, got.values, want.values)
+	}
+	if want.repLevels != nil && !reflect.DeepEqual(got.repLevels, want.repLevels) {
+		t.Errorf("column %s has repetition levels %v, want %v", name, got.repLevels, want.repLevels)
+	}
+	if want.defLevels != nil && !reflect.DeepEqual(got.defLevels, want.defLevels) {
+		t.Errorf("column %s has definition levels %v, want %v", name, got.defLevels, want.defLevels)
+	}
+}
+
+func TestWriteVotesParquet(t *testing.T) {
+	castAt := time.Date(2026, 3, 1, 12, 30, 0, 250_000, time.UTC)
+	rows := []VoteRow{
+		{
+			TenantID:  "acme",
+			PollID:    "poll-1",
+			UserID:    "alice",
+			OptionIDs: []string{"b", "a", "c"},
+			Weight:    2.5,
+			CastAt:    castAt,
+			Metadata: model.VoteMetadata{
+				SourceIP:   "10.0.0.1",
+				DeviceID:   "dev-1",
+				UserAgent:  "ua",
+				AppVersion: "1.2.0",
+				Channel:    "web",
+				GeoBucket:  "br-sp",
+			},
+		},
+		{PollID: "poll-1", UserID: "bob", OptionIDs: []string{"a"}, Weight: 1},
+		{PollID: "poll-1", UserID: "carol", Weight: 1},
+	}
+
+	var buf bytes.Buffer
+	if err := writeVotesParquet(&buf, rows); err != nil {
+		t.Fatalf("writeVotesParquet: %v", err)
+	}
+	n, columns := readParquet(t, buf.Bytes())
+	if n != int64(len(rows)) {
+		t.Fatalf("got %d rows, want %d", n, len(rows))
+	}
+
+	checkColumn(t, columns, "tenant_id", parquetColumnData{values: []any{"acme", "", ""}})
+	checkColumn(t, columns, "user_id", parquetColumnData{values: []any{"alice", "bob", "carol"}})
+	// a new row starts at repetition level 0, and carol's empty list is a
+	// single undefined value
+	checkColumn(t, columns, "option_ids", parquetColumnData{
+		values:    []any{"b", "a", "c", "a", nil},
+		repLevels: []int32{0, 1, 1, 0, 0},
+		defLevels: []int32{1, 1, 1, 1, 0},
+	})
+	checkColumn(t, columns, "weight", parquetColumnData{values: []any{2.5, 1.0, 1.0}})
+	checkColumn(t, columns, "cast_at", parquetColumnData{
+		values:    []any{castAt.UnixMicro(), nil, nil},
+		defLevels: []int32{1, 0, 0},
+	})
+	checkColumn(t, columns, "source_ip", parquetColumnData{values: []any{"10.0.0.1", "", ""}})
+	checkColumn(t, columns, "geo_bucket", parquetColumnData{values: []any{"br-sp", "", ""}})
+}
+
+func TestWriteTallyParquet(t *testing.T) {
+	rows := []TallyRow{
+		{PollID: "poll-1", OptionID: "a", Votes: 3, Weight: 4.5},
+		{PollID: "poll-1", OptionID: "b", Votes: 0, Weight: 0},
+	}
+
+	var buf bytes.Buffer
+	if err := writeTallyParquet(&buf, rows); err != nil {
+		t.Fatalf("writeTallyParquet: %v", err)
+	}
+	n, columns := readParquet(t, buf.Bytes())
+	if n != int64(len(rows)) {
+		t.Fatalf("got %d rows, want %d", n, len(rows))
+	}
+
+	checkColumn(t, columns, "poll_id", parquetColumnData{values: []any{"poll-1", "poll-1"}})
+	checkColumn(t, columns, "option_id", parquetColumnData{values: []any{"a", "b"}})
+	checkColumn(t, columns, "votes", parquetColumnData{values: []any{int64(3), int64(0)}})
+	checkColumn(t, columns, "weight", parquetColumnData{values: []any{4.5, 0.0}})
+}
+
+func TestWriteParquetNoRows(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeTallyParquet(&buf, nil); err != nil {
+		t.Fatalf("writeTallyParquet: %v", err)
+	}
+	if n, _ := readParquet(t, buf.Bytes()); n != 0 {
+		t.Fatalf("got %d rows, want 0", n)
+	}
+}
@@ -25,7 +25,25 @@ ensures it's only done once.
 type ProcessorMetrics struct {
 	VotesProcessed *prometheus.CounterVec
 	VotesDuplicate *prometheus.CounterVec
+	VotesChanged   *prometheus.CounterVec
+	VotesRetracted *prometheus.CounterVec
+	VotesRejected  *prometheus.CounterVec
 	ProcessingTime *prometheus.HistogramVec
+
+	ValidatorRejections *prometheus.CounterVec
+	VotesFlagged        *prometheus.CounterVec
+	VotesReplayed       *prometheus.CounterVec
+	VotesQuarantined    *prometheus.CounterVec
+	StoreRetries        *prometheus.CounterVec
+	VotesRetried        *prometheus.CounterVec
+
+	TallyMismatches *prometheus.CounterVec
+	TallyRepairs    *prometheus.CounterVec
+
+	PollsArchived *prometheus.CounterVec
+	KeysReclaimed *prometheus.CounterVec
+
+	BreakerState *prometheus.GaugeVec
 }
 
 func NewProcessorMetrics(namespace, subsystem string) *ProcessorMetrics {
@@ -37,7 +55,7 @@ func NewProcessorMetrics(namespace, subsystem string) *ProcessorMetrics {
 				Name:      "votes_processed_total",
 				Help:      "Total number of valid votes processed",
 			},
-			[]string{"poll_id"},
+			[]string{"tenant_id", "poll_id"},
 		),
 		VotesDuplicate: promauto.NewCounterVec(
 			prometheus.CounterOpts{
@@ -46,7 +64,88 @@ func NewProcessorMetrics(namespace, subsystem string) *ProcessorMetrics {
 				Name:      "votes_duplicate_total",
 				Help:      "Total number of duplicate votes (frauds) detected",
 			},
-			[]string{"poll_id"},
+			[]string{"tenant_id", "poll_id"},
+		),
+		VotesChanged: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "votes_changed_total",
+				Help:      "Total number of votes moved from one option to another",
+			},
+			[]string{"tenant_id", "poll_id"},
+		),
+		VotesRetracted: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "votes_retracted_total",
+				Help:      "Total number of votes retracted by their users",
+			},
+			[]string{"tenant_id", "poll_id"},
+		),
+		VotesRejected: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "votes_rejected_total",
+				Help:      "Total number of votes rejected by poll rules, by reason",
+			},
+			[]string{"tenant_id", "poll_id", "reason"},
+		),
+		ValidatorRejections: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "validator_rejections_total",
+				Help:      "Total number of votes rejected by each validator",
+			},
+			[]string{"tenant_id", "poll_id", "rule"},
+		),
+		VotesReplayed: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "votes_replayed_total",
+				Help:      "Total number of vote copies absorbed because their vote ID was already applied",
+			},
+			[]string{"tenant_id", "poll_id"},
+		),
+		VotesFlagged: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "votes_flagged_total",
+				Help:      "Total number of votes the velocity detector flagged, by signal",
+			},
+			[]string{"tenant_id", "poll_id", "signal"},
+		),
+		VotesQuarantined: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "votes_quarantined_total",
+				Help:      "Total number of flagged votes sent to review instead of being counted",
+			},
+			[]string{"tenant_id", "poll_id"},
+		),
+		StoreRetries: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "store_retries_total",
+				Help:      "Total number of vote writes retried in-process after the store failed",
+			},
+			[]string{"tenant_id", "poll_id"},
+		),
+		VotesRetried: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "votes_retried_total",
+				Help:      "Total number of votes sent to a retry topic after the store kept failing",
+			},
+			[]string{"tenant_id", "poll_id", "topic"},
 		),
 		ProcessingTime: promauto.NewHistogramVec(
 			prometheus.HistogramOpts{
@@ -56,7 +155,52 @@ func NewProcessorMetrics(namespace, subsystem string) *ProcessorMetrics {
 				Help:      "Histogram of vote processing times",
 				Buckets:   prometheus.LinearBuckets(0.001, 0.001, 10), // 10 buckets, 1ms to 10ms
 			},
-			[]string{"poll_id"},
+			[]string{"tenant_id", "poll_id"},
+		),
+		TallyMismatches: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "tally_mismatches_total",
+				Help:      "Total number of reconciliation checks that found a poll's tally drifting, by kind",
+			},
+			[]string{"tenant_id", "poll_id", "kind"},
+		),
+		TallyRepairs: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "tally_repairs_total",
+				Help:      "Total number of tallies rewritten from the voters' stored choices",
+			},
+			[]string{"tenant_id", "poll_id"},
+		),
+		PollsArchived: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "polls_archived_total",
+				Help:      "Total number of polls archived and deleted from the store after their retention",
+			},
+			[]string{"tenant_id"},
+		),
+		KeysReclaimed: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "store_keys_reclaimed_total",
+				Help:      "Total number of store keys (rows, for postgres) deleted with archived polls",
+			},
+			[]string{"tenant_id"},
+		),
+		BreakerState: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "circuit_breaker_state",
+				Help:      "State of each circuit breaker: 0 closed, 1 half-open, 2 open",
+			},
+			[]string{"breaker"},
 		),
 	}
 }
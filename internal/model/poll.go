@@ -0,0 +1,123 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// PollMode defines how many options a user may select in a single vote
+type PollMode string
+
+const (
+	// PollModeSingle allows exactly one option (the default)
+	PollModeSingle PollMode = "single"
+	// PollModeApproval allows any non-empty subset of the options
+	PollModeApproval PollMode = "approval"
+	// PollModeUpToK allows between one and MaxSelections options
+	PollModeUpToK PollMode = "up_to_k"
+	// PollModeRanked takes a ranked ballot: the options in order of preference,
+	// up to MaxSelections when it's set. Results count first preferences and
+	// the winner comes from an instant-runoff tabulation
+	PollModeRanked PollMode = "ranked"
+)
+
+// PollSettings holds the per-poll rules the processor applies to incoming votes.
+// A poll without saved settings uses the zero value. The mode decides how votes
+// are tallied, so it must not change once the poll has votes
+type PollSettings struct {
+	// AllowVoteChanges lets users change or retract their vote while the poll is open
+	AllowVoteChanges bool     `json:"allow_vote_changes"`
+	Mode             PollMode `json:"mode,omitempty"`
+	// MaxSelections is the K in PollModeUpToK and the ballot length limit in
+	// PollModeRanked, ignored by the other modes
+	MaxSelections int `json:"max_selections,omitempty"`
+	// OpensAt is when the poll starts taking votes; zero means right away
+	OpensAt time.Time `json:"opens_at,omitzero"`
+	// ClosesAt is when the poll stops taking votes; zero means it never closes
+	ClosesAt time.Time `json:"closes_at,omitzero"`
+	// RetentionDays is how long after closing the poll's votes and tally are
+	// kept before they're archived and deleted. Zero uses the consumer's
+	// default and a negative value keeps them forever
+	RetentionDays int `json:"retention_days,omitempty"`
+
+	// Validators are the rules the poll's votes go through, in order, by name.
+	// Empty uses the consumer's default chain
+	Validators []string `json:"validators,omitempty"`
+	// Options are the only options votes may select, any option goes when empty
+	Options []string `json:"options,omitempty"`
+	// RateLimit caps how often a user may vote in the poll, nil for no cap
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+	// BlockedUsers may not vote in the poll at all
+	BlockedUsers []string `json:"blocked_users,omitempty"`
+	// Channels are the only ingest channels votes may come in through, any
+	// channel goes when empty
+	Channels []string `json:"channels,omitempty"`
+}
+
+// RateLimit allows a user at most Votes votes (casts, changes and retractions
+// alike) in any window of WindowSeconds, going by when the votes were cast
+type RateLimit struct {
+	Votes         int `json:"votes"`
+	WindowSeconds int `json:"window_seconds"`
+}
+
+// Window returns the rate limit window as a duration
+func (r RateLimit) Window() time.Duration {
+	return time.Duration(r.WindowSeconds) * time.Second
+}
+
+// ModeOrDefault returns the poll mode, treating a missing mode as single-choice
+func (s PollSettings) ModeOrDefault() PollMode {
+	if s.Mode == "" {
+		return PollModeSingle
+	}
+	return s.Mode
+}
+
+// Validate checks the settings make sense before they're saved, since a poll
+// with, say, an unknown mode would turn every vote away
+func (s PollSettings) Validate() error {
+	if s.MaxSelections < 0 {
+		return fmt.Errorf("max_selections can't be negative")
+	}
+	switch mode := s.ModeOrDefault(); mode {
+	case PollModeSingle, PollModeApproval, PollModeRanked:
+	case PollModeUpToK:
+		if s.MaxSelections < 1 {
+			return fmt.Errorf("up_to_k poll needs max_selections of at least 1")
+		}
+	default:
+		return fmt.Errorf("unknown poll mode %q", mode)
+	}
+	if !s.OpensAt.IsZero() && !s.ClosesAt.IsZero() && !s.ClosesAt.After(s.OpensAt) {
+		return fmt.Errorf("closes_at must be after opens_at")
+	}
+	if r := s.RateLimit; r != nil && (r.Votes < 1 || r.WindowSeconds < 1) {
+		return fmt.Errorf("rate_limit needs at least 1 vote and a window of at least 1 second")
+	}
+	return nil
+}
+
+// IsOpened reports whether the poll has opened at the given time
+func (s PollSettings) IsOpened(at time.Time) bool {
+	return s.OpensAt.IsZero() || !at.Before(s.OpensAt)
+}
+
+// IsClosed reports whether the poll is closed at the given time
+func (s PollSettings) IsClosed(at time.Time) bool {
+	return !s.ClosesAt.IsZero() && !at.Before(s.ClosesAt)
+}
+
+// ExpiresAt returns when the poll's data is due for archival, given the
+// retention that applies when the poll sets none. A poll that never closes or
+// is kept forever doesn't expire
+func (s PollSettings) ExpiresAt(defaultDays int) (time.Time, bool) {
+	days := s.RetentionDays
+	if days == 0 {
+		days = defaultDays
+	}
+	if s.ClosesAt.IsZero() || days < 0 {
+		return time.Time{}, false
+	}
+	return s.ClosesAt.AddDate(0, 0, days), true
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// Results is the tally of a poll as streamed to subscribers: the raw vote
+// count of each option and the sum of the weights those votes carried
+type Results struct {
+	PollID   string             `json:"poll_id"`
+	Counts   map[string]int     `json:"counts"`
+	Weighted map[string]float64 `json:"weighted"`
+}
+
+// HistoryBucket is the net change of each option's count over a time bucket.
+// Changes and retractions make counts in a bucket go negative
+type HistoryBucket struct {
+	Start  time.Time      `json:"start"`
+	Counts map[string]int `json:"counts"`
+}
@@ -2,9 +2,122 @@ package model
 
 import "time"
 
+// VoteKind tells the processor what the user wants to do with their vote.
+// Older producers don't send a kind at all, so an empty value means "cast"
+type VoteKind string
+
+const (
+	VoteKindCast    VoteKind = "cast"
+	VoteKindChange  VoteKind = "change"
+	VoteKindRetract VoteKind = "retract"
+)
+
 type Vote struct {
-	PollID    string    `json:"poll_id"`
-	UserID    string    `json:"user_id"`
-	OptionID  string    `json:"option_id"`
+	// VoteID identifies one submission of a vote, so the copies a retry
+	// writes are recognized as the same vote. Clients may set it, otherwise
+	// the publisher does. Votes from older producers have none
+	VoteID string `json:"vote_id,omitempty"`
+	// TenantID is the team the vote belongs to, empty for the default tenant.
+	// The consumer sets it from the credentials the vote was published with,
+	// so producers can't vote into another tenant's polls
+	TenantID string `json:"tenant_id,omitempty"`
+	PollID   string `json:"poll_id"`
+	UserID   string `json:"user_id"`
+	// OptionID is the single-choice form of OptionIDs, still sent by older producers
+	OptionID  string   `json:"option_id,omitempty"`
+	OptionIDs []string `json:"option_ids,omitempty"`
+	Kind      VoteKind `json:"kind,omitempty"`
+	// Weight is how much the vote counts in weighted tallies. The processor
+	// sets it from the voter-weight table, falling back to 1, and ignores
+	// whatever the producer sent
+	Weight    float64   `json:"weight,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
+	// Metadata is where the vote came from, as far as ingestion knows
+	Metadata VoteMetadata `json:"metadata,omitzero"`
+	// Flags are the fraud signals the processor tagged the vote with
+	Flags []string `json:"flags,omitempty"`
+	// Source is the topic/partition/offset the vote was read from. Only a
+	// consumer that commits after processing sets it, to know which offset to
+	// commit, and it never leaves the process
+	Source string `json:"-"`
+	// ReceivedAt is when the consumer read the vote. Poll windows, rate
+	// limits, velocity and the polls' last vote time go by it rather than
+	// Timestamp, which is whatever the producer says. Like Source it never
+	// leaves the process
+	ReceivedAt time.Time `json:"-"`
+	// Checked is set once the vote went through the processor's checks and
+	// only has the store write left. The retry topics carry it and
+	// ReceivedAt in their headers
+	Checked bool `json:"-"`
+}
+
+// VoteMetadata is set by ingestion and travels with the vote to the store.
+// Extra carries whatever else ingestion wants to pass along under its own keys,
+// so a new field doesn't have to wait for a new version of the vote.
+//
+// Only Channel is ingestion's own, see event.WithChannel. The rest is what
+// the client said about itself, so it can be made up: checks that go by it
+// only hold against clients that don't lie
+type VoteMetadata struct {
+	SourceIP string `json:"source_ip,omitempty"`
+	// DeviceID is the client's device fingerprint
+	DeviceID   string `json:"device_id,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	AppVersion string `json:"app_version,omitempty"`
+	// Channel is how the vote came in, e.g. "web", "mobile" or "kafka"
+	Channel string `json:"channel,omitempty"`
+	// GeoBucket is a coarse location, a country or region code, never finer
+	GeoBucket string            `json:"geo_bucket,omitempty"`
+	Extra     map[string]string `json:"extra,omitempty"`
+}
+
+// IsZero reports whether ingestion said nothing about the vote
+func (m VoteMetadata) IsZero() bool {
+	return m.SourceIP == "" && m.DeviceID == "" && m.UserAgent == "" && m.AppVersion == "" &&
+		m.Channel == "" && m.GeoBucket == "" && len(m.Extra) == 0
+}
+
+// KindOrDefault returns the vote kind, treating a missing kind as a cast
+func (v Vote) KindOrDefault() VoteKind {
+	if v.Kind == "" {
+		return VoteKindCast
+	}
+	return v.Kind
+}
+
+// Options returns every option the vote selects, whichever field carried them
+func (v Vote) Options() []string {
+	if len(v.OptionIDs) > 0 {
+		return v.OptionIDs
+	}
+	if v.OptionID != "" {
+		return []string{v.OptionID}
+	}
+	return nil
+}
+
+// WeightOrDefault returns the vote weight, treating a missing weight as 1
+func (v Vote) WeightOrDefault() float64 {
+	if v.Weight == 0 {
+		return 1
+	}
+	return v.Weight
+}
+
+// ReceivedAtOrNow returns when the vote was read, using the current time for
+// votes that didn't come through a consumer
+func (v Vote) ReceivedAtOrNow() time.Time {
+	if v.ReceivedAt.IsZero() {
+		return time.Now()
+	}
+	return v.ReceivedAt
+}
+
+// CastAt returns when the vote was cast, using the current time for votes
+// from producers that don't stamp them
+func (v Vote) CastAt() time.Time {
+	if v.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return v.Timestamp
 }
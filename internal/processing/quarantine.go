@@ -0,0 +1,156 @@
+package processing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+)
+
+/*
+Quarantined votes are held in the store, out of the tally, until someone
+approves or rejects them through the API. Approving counts the vote as it was
+cast, rejecting sends it to the DLQ, and either way the decision is kept in
+the store's review records.
+
+An approved vote skips the validators and the velocity detector, since a
+person already looked at it, but still goes through the store's dedupe.
+
+A decision takes the vote out of quarantine before anything is done with it,
+so of two reviewers deciding at once, only the first one's decision happens
+and the other gets ErrNotQuarantined. An approved vote the store then fails to
+take goes through the retry topics like any other. When the vote can't be
+counted, nor sent to the DLQ for a rejection, it's held again for the
+decision to be retried; its record stays, so the audit trail has every try.
+Counting a vote again is harmless, the store applies its VoteID once.
+*/
+
+// ErrNotQuarantined is returned for a vote ID that's not held, or not anymore
+var ErrNotQuarantined = errors.New("vote is not in quarantine")
+
+// WithQuarantine holds the votes the velocity detector flags until they're
+// reviewed, instead of counting them
+func WithQuarantine() Option {
+	return func(vp *VoteProcessor) {
+		vp.quarantine = true
+	}
+}
+
+// quarantineID identifies a held vote by its VoteID, so the same vote
+// delivered twice is held once whatever the flags it got each time. Votes
+// without one go by their content, minus what the processor adds to it
+func quarantineID(v model.Vote) string {
+	var b []byte
+	if v.VoteID != "" {
+		b, _ = json.Marshal([]string{v.TenantID, v.PollID, v.VoteID})
+	} else {
+		v.Flags, v.Weight = nil, 0
+		b, _ = json.Marshal(v)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+func (vp *VoteProcessor) quarantineVote(ctx context.Context, s store.VoteStore, v model.Vote) error {
+	q := store.QuarantinedVote{ID: quarantineID(v), Vote: v, QuarantinedAt: time.Now()}
+	if err := s.QuarantineVote(ctx, q); err != nil {
+		log.Printf("Error quarantining vote from UserID %s in PollID %s: %v", v.UserID, v.PollID, err)
+		return err
+	}
+	return nil
+}
+
+// ApproveQuarantined counts a held vote and records who approved it
+func (vp *VoteProcessor) ApproveQuarantined(ctx context.Context, tenantID, id, reviewer, note string) (store.ReviewRecord, error) {
+	s := vp.store.ForTenant(tenantID)
+	q, ok, err := s.GetQuarantined(ctx, id)
+	if err != nil {
+		return store.ReviewRecord{}, err
+	}
+	if !ok {
+		return store.ReviewRecord{}, ErrNotQuarantined
+	}
+
+	rec := reviewRecord(q, store.ReviewApproved, reviewer, note)
+	if err := vp.resolve(ctx, s, rec); err != nil {
+		return store.ReviewRecord{}, err
+	}
+
+	vote := q.Vote
+	vote.Checked = true
+	res, err := vp.countVote(ctx, s, vote)
+	var se *storeError
+	if errors.As(err, &se) {
+		err = vp.retryLater(ctx, se.vote, 0, se.err)
+	}
+	if err != nil {
+		vp.holdAgain(ctx, s, q, err)
+		return store.ReviewRecord{}, fmt.Errorf("error counting approved vote: %v", err)
+	}
+	rec.Outcome = res.Outcome
+	return rec, nil
+}
+
+// RejectQuarantined sends a held vote to the DLQ and records who rejected it
+func (vp *VoteProcessor) RejectQuarantined(ctx context.Context, tenantID, id, reviewer, note string) (store.ReviewRecord, error) {
+	s := vp.store.ForTenant(tenantID)
+	q, ok, err := s.GetQuarantined(ctx, id)
+	if err != nil {
+		return store.ReviewRecord{}, err
+	}
+	if !ok {
+		return store.ReviewRecord{}, ErrNotQuarantined
+	}
+
+	rec := reviewRecord(q, store.ReviewRejected, reviewer, note)
+	if err := vp.resolve(ctx, s, rec); err != nil {
+		return store.ReviewRecord{}, err
+	}
+	if err := vp.sendToDLQ(ctx, q.Vote, "", reject("rejected_in_review", "rejected by %s after review", reviewer)); err != nil {
+		vp.holdAgain(ctx, s, q, err)
+		return store.ReviewRecord{}, fmt.Errorf("error sending rejected vote to the DLQ: %v", err)
+	}
+	vp.metrics.VotesRejected.WithLabelValues(q.Vote.TenantID, q.Vote.PollID, "rejected_in_review").Inc()
+	return rec, nil
+}
+
+// holdAgain puts back in quarantine a vote whose decision couldn't be carried
+// out, so it can be decided again
+func (vp *VoteProcessor) holdAgain(ctx context.Context, s store.VoteStore, q store.QuarantinedVote, cause error) {
+	log.Printf("Decision on vote %s from UserID: %s in PollID: %s not carried out, held again: %v", q.ID, q.Vote.UserID, q.Vote.PollID, cause)
+	if err := s.QuarantineVote(ctx, q); err != nil {
+		log.Printf("[CRITICAL ERROR] Vote %s from UserID: %s in PollID: %s left neither decided nor held: %v", q.ID, q.Vote.UserID, q.Vote.PollID, err)
+	}
+}
+
+func reviewRecord(q store.QuarantinedVote, d store.ReviewDecision, reviewer, note string) store.ReviewRecord {
+	return store.ReviewRecord{
+		VoteID:    q.ID,
+		PollID:    q.Vote.PollID,
+		UserID:    q.Vote.UserID,
+		Flags:     q.Vote.Flags,
+		Decision:  d,
+		Reviewer:  reviewer,
+		Note:      note,
+		DecidedAt: time.Now(),
+	}
+}
+
+func (vp *VoteProcessor) resolve(ctx context.Context, s store.VoteStore, rec store.ReviewRecord) error {
+	ok, err := s.ResolveQuarantined(ctx, rec)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotQuarantined
+	}
+	log.Printf("[REVIEWED] Vote %s from UserID: %s in PollID: %s %s by %s", rec.VoteID, rec.UserID, rec.PollID, rec.Decision, rec.Reviewer)
+	return nil
+}
@@ -0,0 +1,153 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/event"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/metrics"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+)
+
+// the metrics register globally, so the tests share them
+var testMetrics = metrics.NewProcessorMetrics("voting_system", "processing_test")
+
+// flakyStore fails every vote write while down is set
+type flakyStore struct {
+	store.VoteStore
+	down *bool
+}
+
+func (s flakyStore) ForTenant(tenantID string) store.VoteStore {
+	return flakyStore{s.VoteStore.ForTenant(tenantID), s.down}
+}
+
+func (s flakyStore) RegisterVote(ctx context.Context, v model.Vote) (store.VoteResult, error) {
+	if *s.down {
+		return store.VoteResult{}, errors.New("store down")
+	}
+	return s.VoteStore.RegisterVote(ctx, v)
+}
+
+// flakyPublisher fails every publish while down is set, and keeps the rest
+type flakyPublisher struct {
+	down      bool
+	published []model.Vote
+}
+
+func (p *flakyPublisher) PublishMessage(_ context.Context, v model.Vote, _ string, _ ...event.Header) error {
+	if p.down {
+		return errors.New("kafka down")
+	}
+	p.published = append(p.published, v)
+	return nil
+}
+
+func (p *flakyPublisher) Close() error { return nil }
+
+func newQuarantineProcessor(t *testing.T) (*VoteProcessor, store.VoteStore, *bool, *flakyPublisher) {
+	t.Helper()
+	bs, err := store.NewBoltStore(filepath.Join(t.TempDir(), "votes.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bs.Close() })
+
+	down := new(bool)
+	dlq := &flakyPublisher{}
+	vp := NewVoteProcessor(nil, dlq, testMetrics, flakyStore{bs, down}, nil, 1, WithQuarantine(), WithStoreRetries(0))
+	return vp, bs, down, dlq
+}
+
+func TestQuarantineIDIgnoresFlags(t *testing.T) {
+	v := model.Vote{VoteID: "v1", PollID: "p", UserID: "u", OptionID: "a", Flags: []string{"ip_velocity"}, Weight: 2}
+	redelivered := v
+	redelivered.Flags = []string{"ip_velocity", "device_velocity"}
+	redelivered.Weight = 1
+	if quarantineID(v) != quarantineID(redelivered) {
+		t.Fatal("a redelivered vote flagged differently got another quarantine ID")
+	}
+
+	noID := v
+	noID.VoteID = ""
+	noIDAgain := redelivered
+	noIDAgain.VoteID = ""
+	if quarantineID(noID) != quarantineID(noIDAgain) {
+		t.Fatal("a vote without a VoteID flagged differently got another quarantine ID")
+	}
+	other := noID
+	other.OptionID = "b"
+	if quarantineID(noID) == quarantineID(other) {
+		t.Fatal("two votes without a VoteID got the same quarantine ID")
+	}
+}
+
+func TestApproveHoldsAgainWhenNotCounted(t *testing.T) {
+	ctx := context.Background()
+	vp, s, down, dlq := newQuarantineProcessor(t)
+
+	v := model.Vote{VoteID: "v1", PollID: "p", UserID: "u", OptionID: "a", Timestamp: time.Now(), Flags: []string{"ip_velocity"}}
+	if err := vp.quarantineVote(ctx, s, v); err != nil {
+		t.Fatal(err)
+	}
+	id := quarantineID(v)
+
+	// neither the store nor the DLQ take it, so the vote is held again
+	*down, dlq.down = true, true
+	if _, err := vp.ApproveQuarantined(ctx, "", id, "alice", ""); err == nil {
+		t.Fatal("approval that couldn't count the vote returned no error")
+	}
+	if _, ok, err := s.GetQuarantined(ctx, id); err != nil || !ok {
+		t.Fatalf("vote held after a failed approval = %v, %v, want it held", ok, err)
+	}
+
+	*down, dlq.down = false, false
+	rec, err := vp.ApproveQuarantined(ctx, "", id, "alice", "")
+	if err != nil {
+		t.Fatalf("ApproveQuarantined: %v", err)
+	}
+	if rec.Outcome != store.VoteCounted {
+		t.Fatalf("approval outcome %s, want %s", rec.Outcome, store.VoteCounted)
+	}
+	results, err := s.GetResults(ctx, "p")
+	if err != nil || results["a"] != 1 {
+		t.Fatalf("results = %v, %v, want a: 1", results, err)
+	}
+	if _, ok, _ := s.GetQuarantined(ctx, id); ok {
+		t.Fatal("approved vote still held")
+	}
+}
+
+func TestRejectHoldsAgainWhenNotPublished(t *testing.T) {
+	ctx := context.Background()
+	vp, s, _, dlq := newQuarantineProcessor(t)
+
+	v := model.Vote{VoteID: "v1", PollID: "p", UserID: "u", OptionID: "a", Timestamp: time.Now()}
+	if err := vp.quarantineVote(ctx, s, v); err != nil {
+		t.Fatal(err)
+	}
+	id := quarantineID(v)
+
+	dlq.down = true
+	if _, err := vp.RejectQuarantined(ctx, "", id, "alice", ""); err == nil {
+		t.Fatal("rejection that couldn't reach the DLQ returned no error")
+	}
+	if _, ok, err := s.GetQuarantined(ctx, id); err != nil || !ok {
+		t.Fatalf("vote held after a failed rejection = %v, %v, want it held", ok, err)
+	}
+
+	dlq.down = false
+	if _, err := vp.RejectQuarantined(ctx, "", id, "alice", ""); err != nil {
+		t.Fatalf("RejectQuarantined: %v", err)
+	}
+	if len(dlq.published) != 1 || dlq.published[0].VoteID != "v1" {
+		t.Fatalf("DLQ got %v, want the rejected vote", dlq.published)
+	}
+	if _, ok, _ := s.GetQuarantined(ctx, id); ok {
+		t.Fatal("rejected vote still held")
+	}
+}
@@ -0,0 +1,110 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/metrics"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+)
+
+/*
+Reconciler periodically checks that each poll's tally still adds up to its
+voters' current choices. Drift can come from a vote that half-applied, a key
+someone edited by hand, or a bug in a store; the reconciler counts and logs
+it, and with repair enabled rewrites the tally from the stored choices.
+
+Voters with no stored choice can't be recounted, so those polls are only
+reported. Replaying the votes topic with cmd/rebuild is the fix for them.
+
+Every consumer runs a reconciler, but only the one holding the reconciler
+lease checks anything. It renews the lease on every tick, and if it goes away
+another one takes over once the lease runs out, two intervals later.
+*/
+type Reconciler struct {
+	store    store.VoteStore
+	metrics  *metrics.ProcessorMetrics
+	tenants  []string
+	interval time.Duration
+	repair   bool
+	// who this reconciler is when it holds the lease
+	holder string
+}
+
+const reconcilerLease = "reconciler"
+
+func NewReconciler(s store.VoteStore, m *metrics.ProcessorMetrics, tenants []string, interval time.Duration, repair bool) *Reconciler {
+	host, _ := os.Hostname()
+	holder := fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+	return &Reconciler{store: s, metrics: m, tenants: tenants, interval: interval, repair: repair, holder: holder}
+}
+
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Tally reconciler got stop signal")
+			return
+		case <-ticker.C:
+			leader, err := r.store.AcquireLease(ctx, reconcilerLease, r.holder, 2*r.interval)
+			if err != nil {
+				log.Printf("Error acquiring the reconciler lease: %v", err)
+				continue
+			}
+			if !leader {
+				continue // another consumer reconciles
+			}
+			for _, tenantID := range r.tenants {
+				r.reconcile(ctx, tenantID)
+			}
+		}
+	}
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, tenantID string) {
+	s := r.store.ForTenant(tenantID)
+	polls, err := s.ListPolls(ctx, time.Time{})
+	if err != nil {
+		log.Printf("Error listing polls to reconcile: %v", err)
+		return
+	}
+
+	drifted := 0
+	for _, p := range polls {
+		check, err := s.CheckTally(ctx, p.PollID, r.repair)
+		if err != nil {
+			log.Printf("Error checking tally of PollID %s: %v", p.PollID, err)
+			continue
+		}
+
+		if check.VotersMatch() && check.Matches() {
+			continue
+		}
+		drifted++
+
+		if !check.VotersMatch() {
+			log.Printf("[TALLY DRIFT] PollID: %s has %d voters but only %d stored choices", p.PollID, check.Voters, check.Ballots)
+			r.metrics.TallyMismatches.WithLabelValues(tenantID, p.PollID, "voters").Inc()
+		}
+		if !check.TallyMatches() {
+			log.Printf("[TALLY DRIFT] PollID: %s stored tally %v, choices add up to %v", p.PollID, check.Stored, check.Recount)
+			r.metrics.TallyMismatches.WithLabelValues(tenantID, p.PollID, "tally").Inc()
+		}
+		if !check.WeightsMatch() {
+			log.Printf("[TALLY DRIFT] PollID: %s stored weighted tally %v, choices and weights add up to %v", p.PollID, check.StoredWeight, check.RecountWeight)
+			r.metrics.TallyMismatches.WithLabelValues(tenantID, p.PollID, "weights").Inc()
+		}
+		if check.Repaired {
+			log.Printf("[TALLY REPAIRED] PollID: %s tally rewritten from the stored choices", p.PollID)
+			r.metrics.TallyRepairs.WithLabelValues(tenantID, p.PollID).Inc()
+		}
+	}
+
+	log.Printf("Reconciled %d polls of tenant %q, %d drifting", len(polls), tenantID, drifted)
+}
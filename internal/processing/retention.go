@@ -0,0 +1,150 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/archive"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/metrics"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+)
+
+/*
+Retention archives polls whose retention ran out and deletes their data from
+the store. A poll expires RetentionDays after it closes (defaultDays when its
+settings don't say), and polls that never close are kept.
+
+The archive is written before anything is deleted, so a failed archive leaves
+the poll alone until the next pass, and a crash after archiving only means the
+poll gets archived again. A poll that was voted in or deleted while it was
+being read isn't archived, and one voted in after it was archived isn't
+deleted: an archive never replaces a good one with what's left of a poll.
+
+Like the reconciler, only the consumer holding the retention lease expires
+anything, so two consumers never archive the same poll at once.
+*/
+type Retention struct {
+	store       store.VoteStore
+	sink        archive.Sink
+	metrics     *metrics.ProcessorMetrics
+	tenants     []string
+	interval    time.Duration
+	defaultDays int
+	// who this retention is when it holds the lease
+	holder string
+}
+
+const retentionLease = "retention"
+
+func NewRetention(s store.VoteStore, sink archive.Sink, m *metrics.ProcessorMetrics, tenants []string, interval time.Duration, defaultDays int) *Retention {
+	host, _ := os.Hostname()
+	holder := fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+	return &Retention{store: s, sink: sink, metrics: m, tenants: tenants, interval: interval, defaultDays: defaultDays, holder: holder}
+}
+
+func (rt *Retention) Run(ctx context.Context) {
+	ticker := time.NewTicker(rt.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Poll retention got stop signal")
+			return
+		case <-ticker.C:
+			leader, err := rt.store.AcquireLease(ctx, retentionLease, rt.holder, 2*rt.interval)
+			if err != nil {
+				log.Printf("Error acquiring the retention lease: %v", err)
+				continue
+			}
+			if !leader {
+				continue // another consumer expires the polls
+			}
+			for _, tenantID := range rt.tenants {
+				rt.expire(ctx, tenantID)
+			}
+		}
+	}
+}
+
+func (rt *Retention) expire(ctx context.Context, tenantID string) {
+	s := rt.store.ForTenant(tenantID)
+	polls, err := s.ListPolls(ctx, time.Time{})
+	if err != nil {
+		log.Printf("Error listing polls for retention: %v", err)
+		return
+	}
+
+	archived, reclaimed := 0, 0
+	for _, p := range polls {
+		settings, err := s.GetPollSettings(ctx, p.PollID)
+		if err != nil {
+			log.Printf("Error getting settings for PollID %s: %v", p.PollID, err)
+			continue
+		}
+		expiresAt, ok := settings.ExpiresAt(rt.defaultDays)
+		if !ok || time.Now().Before(expiresAt) {
+			continue
+		}
+
+		results, err := getResults(ctx, s, p.PollID)
+		if err != nil {
+			log.Printf("Error getting results of PollID %s to archive: %v", p.PollID, err)
+			continue
+		}
+		votes, err := s.ListVotes(ctx, p.PollID)
+		if err != nil {
+			log.Printf("Error listing votes of PollID %s to archive: %v", p.PollID, err)
+			continue
+		}
+		// what was read is only the poll if nothing happened to it meanwhile
+		now, ok, err := s.GetPoll(ctx, p.PollID)
+		if err != nil {
+			log.Printf("Error getting PollID %s to archive: %v", p.PollID, err)
+			continue
+		}
+		if !ok || !now.LastVoteAt.Equal(p.LastVoteAt) {
+			log.Printf("PollID %s changed while it was read for the archive, left for the next pass", p.PollID)
+			continue
+		}
+
+		err = rt.sink.Archive(ctx, archive.Poll{
+			TenantID:   tenantID,
+			PollID:     p.PollID,
+			Settings:   settings,
+			LastVoteAt: p.LastVoteAt,
+			ArchivedAt: time.Now().UTC(),
+			Results:    results.Counts,
+			Weighted:   results.Weighted,
+			Votes:      votes,
+		})
+		if err != nil {
+			log.Printf("Error archiving PollID %s: %v", p.PollID, err)
+			continue
+		}
+
+		n, err := s.DeletePoll(ctx, p.PollID, p.LastVoteAt)
+		if errors.Is(err, store.ErrPollChanged) {
+			// archived again with the new votes on the next pass
+			log.Printf("PollID %s was voted in after it was archived, not deleted", p.PollID)
+			continue
+		}
+		if err != nil {
+			log.Printf("Error deleting archived PollID %s: %v", p.PollID, err)
+			continue
+		}
+		log.Printf("[RETENTION] PollID: %s archived, %d keys deleted", p.PollID, n)
+		rt.metrics.PollsArchived.WithLabelValues(tenantID).Inc()
+		rt.metrics.KeysReclaimed.WithLabelValues(tenantID).Add(float64(n))
+		archived++
+		reclaimed += n
+	}
+
+	if archived > 0 {
+		log.Printf("Archived %d polls of tenant %q, %d keys reclaimed", archived, tenantID, reclaimed)
+	}
+}
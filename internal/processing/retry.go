@@ -0,0 +1,167 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/event"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+)
+
+/*
+A vote the store fails to take is retried right away a few times, backing off
+exponentially, which rides out a blip. If the store is still failing, the vote
+goes to the first retry topic, whose reader holds it for the topic's delay and
+tries again, and so on through the tiers. Past the last one it goes to the DLQ
+as store_unavailable.
+
+A vote that already went through the checks carries its resolved weight and
+flags, so only its store write is retried and it's counted as it was when it
+came in. One whose checks couldn't read the store goes the same way and has
+them run again when it's retried, by the time it was first read at. A write
+that failed after the store applied it comes back as a replay, as long as the
+vote has a vote ID.
+*/
+
+// RetryTier is a retry topic. Its consumer is the one that holds the votes
+// for the tier's delay, see event.WithDelay
+type RetryTier struct {
+	Topic     string
+	Consumer  event.VoteConsumer
+	Publisher event.VotePublisher
+}
+
+// the in-process backoff of the store writes, doubling from base up to max
+const (
+	storeRetryBase = 100 * time.Millisecond
+	storeRetryMax  = 2 * time.Second
+)
+
+// WithStoreRetries sets how many times a failed store write is retried
+// in-process before the vote goes to the retry topics. The default is 3
+func WithStoreRetries(n int) Option {
+	return func(vp *VoteProcessor) {
+		vp.storeRetries = n
+	}
+}
+
+// WithRetryTiers sends the votes the store kept failing to take through the
+// tiers, in order, before they go to the DLQ
+func WithRetryTiers(tiers []RetryTier) Option {
+	return func(vp *VoteProcessor) {
+		vp.retryTiers = tiers
+	}
+}
+
+// storeError is a store call that failed, a write only once the in-process
+// retries ran out, with the vote as far as it got
+type storeError struct {
+	vote model.Vote
+	err  error
+}
+
+func (e *storeError) Error() string { return e.err.Error() }
+
+func (e *storeError) Unwrap() error { return e.err }
+
+// registerVote writes a vote to the store, retrying with backoff while it fails
+func (vp *VoteProcessor) registerVote(ctx context.Context, s store.VoteStore, v model.Vote) (store.VoteResult, error) {
+	wait := storeRetryBase
+	for attempt := 1; ; attempt++ {
+		res, err := s.RegisterVote(ctx, v)
+		if err == nil {
+			return res, nil
+		}
+		if attempt > vp.storeRetries || ctx.Err() != nil {
+			return res, &storeError{v, err}
+		}
+
+		log.Printf("Error registering vote from UserID %s in PollID %s, retry %d in %s: %v", v.UserID, v.PollID, attempt, wait, err)
+		vp.metrics.StoreRetries.WithLabelValues(v.TenantID, v.PollID).Inc()
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return res, &storeError{v, err}
+		}
+		wait = min(2*wait, storeRetryMax)
+	}
+}
+
+// retryLater sends a vote the store kept failing to take to the given retry
+// tier, or to the DLQ when it was through every tier
+func (vp *VoteProcessor) retryLater(ctx context.Context, v model.Vote, tier int, cause error) error {
+	if tier >= len(vp.retryTiers) {
+		log.Printf("[REJECTED] Vote from UserID: %s in PollID: %s gave up on the store: %v", v.UserID, v.PollID, cause)
+		vp.metrics.VotesRejected.WithLabelValues(v.TenantID, v.PollID, "store_unavailable").Inc()
+		return vp.sendToDLQ(ctx, v, "", reject("store_unavailable", "%v", cause))
+	}
+
+	t := vp.retryTiers[tier]
+	retryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	headers := []event.Header{{Key: event.RetryErrorHeader, Value: cause.Error()}}
+	if !v.ReceivedAt.IsZero() {
+		headers = append(headers, event.Header{Key: event.ReceivedAtHeader, Value: v.ReceivedAt.Format(time.RFC3339Nano)})
+	}
+	if v.Checked {
+		headers = append(headers, event.Header{Key: event.CheckedHeader, Value: "true"})
+	}
+	if err := t.Publisher.PublishMessage(retryCtx, v, v.PollID, headers...); err != nil {
+		log.Printf("[CRITICAL ERROR] Failed to publish to retry topic %s: %v", t.Topic, err)
+		return err
+	}
+	log.Printf("[RETRY] Vote from UserID: %s in PollID: %s sent to %s: %v", v.UserID, v.PollID, t.Topic, cause)
+	vp.metrics.VotesRetried.WithLabelValues(v.TenantID, v.PollID, t.Topic).Inc()
+	return nil
+}
+
+// runRetryTier handles the votes of a retry topic as their delay runs out
+func (vp *VoteProcessor) runRetryTier(ctx context.Context, tier int) {
+	defer vp.wg.Done()
+	t := vp.retryTiers[tier]
+
+	for {
+		if err := waitBreaker(ctx, vp.storeBreaker, false); err != nil {
+			log.Printf("Retry reader of %s got stop signal", t.Topic)
+			return
+		}
+		v, err := t.Consumer.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Printf("Retry reader of %s got stop signal", t.Topic)
+				return
+			}
+			// like a message that wasn't signed by a processor
+			var rejected *event.RejectedMessageError
+			if errors.As(err, &rejected) {
+				vp.rejectMessage(ctx, t.Consumer, rejected)
+				continue
+			}
+			log.Printf("Error reading message from %s: %v", t.Topic, err)
+			continue
+		}
+
+		err = vp.untilHandled(ctx, v, func() error {
+			if !v.Checked {
+				return vp.handleVote(ctx, v, tier+1)
+			}
+			if err := waitBreaker(ctx, vp.storeBreaker, true); err != nil {
+				return err
+			}
+			_, err := vp.countVote(ctx, vp.store.ForTenant(v.TenantID), v)
+			var se *storeError
+			if errors.As(err, &se) {
+				err = vp.retryLater(ctx, se.vote, tier+1, se.err)
+			}
+			return err
+		})
+		if err != nil {
+			continue
+		}
+		ack(ctx, t.Consumer, v)
+	}
+}
@@ -0,0 +1,49 @@
+package processing
+
+import (
+	"fmt"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+)
+
+// validateSelection checks that the options picked by a vote fit the poll mode.
+// Retractions don't select anything, so they're never checked here
+func validateSelection(settings model.PollSettings, options []string) error {
+	seen := make(map[string]bool, len(options))
+	for _, o := range options {
+		if o == "" {
+			return fmt.Errorf("empty option id")
+		}
+		if seen[o] {
+			return fmt.Errorf("option %s selected more than once", o)
+		}
+		seen[o] = true
+	}
+
+	n := len(options)
+	switch mode := settings.ModeOrDefault(); mode {
+	case model.PollModeSingle:
+		if n != 1 {
+			return fmt.Errorf("single-choice poll requires exactly 1 option, got %d", n)
+		}
+	case model.PollModeApproval:
+		if n == 0 {
+			return fmt.Errorf("approval poll requires at least 1 option")
+		}
+	case model.PollModeUpToK:
+		if n == 0 || n > settings.MaxSelections {
+			return fmt.Errorf("poll allows between 1 and %d options, got %d", settings.MaxSelections, n)
+		}
+	case model.PollModeRanked:
+		if n == 0 {
+			return fmt.Errorf("ranked ballot requires at least 1 option")
+		}
+		if settings.MaxSelections > 0 && n > settings.MaxSelections {
+			return fmt.Errorf("ranked ballot allows up to %d options, got %d", settings.MaxSelections, n)
+		}
+	default:
+		return fmt.Errorf("unknown poll mode %q", mode)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package processing
+
+import (
+	"testing"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+)
+
+func TestValidateSelection(t *testing.T) {
+	single := model.PollSettings{}
+	approval := model.PollSettings{Mode: model.PollModeApproval}
+	upTo2 := model.PollSettings{Mode: model.PollModeUpToK, MaxSelections: 2}
+	ranked := model.PollSettings{Mode: model.PollModeRanked}
+	rankedUpTo2 := model.PollSettings{Mode: model.PollModeRanked, MaxSelections: 2}
+
+	tests := []struct {
+		name     string
+		settings model.PollSettings
+		options  []string
+		ok       bool
+	}{
+		{"single one option", single, []string{"a"}, true},
+		{"single no option", single, nil, false},
+		{"single two options", single, []string{"a", "b"}, false},
+		{"approval several options", approval, []string{"a", "b", "c"}, true},
+		{"approval no option", approval, nil, false},
+		{"up to k within k", upTo2, []string{"a", "b"}, true},
+		{"up to k over k", upTo2, []string{"a", "b", "c"}, false},
+		{"up to k no option", upTo2, nil, false},
+		{"ranked any length", ranked, []string{"a", "b", "c", "d"}, true},
+		{"ranked no option", ranked, nil, false},
+		{"ranked over max", rankedUpTo2, []string{"a", "b", "c"}, false},
+		{"option twice", approval, []string{"a", "a"}, false},
+		{"empty option", approval, []string{"a", ""}, false},
+		{"unknown mode", model.PollSettings{Mode: "plurality"}, []string{"a"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSelection(tt.settings, tt.options)
+			if ok := err == nil; ok != tt.ok {
+				t.Errorf("validateSelection(%v) = %v, want ok %v", tt.options, err, tt.ok)
+			}
+		})
+	}
+}
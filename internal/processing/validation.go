@@ -0,0 +1,118 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+)
+
+/*
+Every vote goes through a chain of validators before it reaches the store.
+Each validator is one rule that accepts the vote or rejects it with a reason.
+The first rejection stops the chain, is counted against the rule, and sends
+the vote to the DLQ with the rule and the reason in its headers.
+
+A poll picks its chain by name in its settings' Validators; polls that don't
+go through the processor's default chain. Rules read their parameters (the
+allowed options, the rate limit...) from the poll settings too. The dedupe
+isn't a validator: it's the store's atomic check, right after the chain.
+*/
+
+// Rejection is why a validator turned a vote down. Reason is short and
+// stable since it labels the rejection metrics, Err has the details
+type Rejection struct {
+	Reason string
+	Err    error
+}
+
+func reject(reason, format string, args ...any) *Rejection {
+	return &Rejection{Reason: reason, Err: fmt.Errorf(format, args...)}
+}
+
+// VoteCheck is what a validator gets to look at: the vote, its poll's
+// settings and the store scoped to the vote's tenant
+type VoteCheck struct {
+	Vote     model.Vote
+	Settings model.PollSettings
+	Store    store.VoteStore
+}
+
+type Validator interface {
+	// Name is how poll settings, metrics and DLQ headers refer to the rule
+	Name() string
+	// Validate returns a nil rejection to accept the vote. An error means the
+	// rule couldn't decide, and the vote is dropped like on any store error
+	Validate(ctx context.Context, c VoteCheck) (*Rejection, error)
+}
+
+// DefaultValidators is the default chain. poll_exists isn't in it, since polls
+// never had to be created before their first vote
+var DefaultValidators = []string{"schema", "blocklist", "channel", "window_open", "changes_allowed", "option_allowed", "rate_limit"}
+
+func builtinValidators() []Validator {
+	return []Validator{
+		schemaValidator{},
+		pollExistsValidator{},
+		blocklistValidator{},
+		channelValidator{},
+		windowOpenValidator{},
+		changesAllowedValidator{},
+		optionAllowedValidator{},
+		newRateLimitValidator(),
+	}
+}
+
+// WithValidator adds a rule polls can name in their chain, replacing the
+// built-in rule of the same name
+func WithValidator(v Validator) Option {
+	return func(vp *VoteProcessor) {
+		vp.validators[v.Name()] = v
+	}
+}
+
+// WithValidators sets the chain of the polls that don't pick their own.
+// The default is DefaultValidators
+func WithValidators(names []string) Option {
+	return func(vp *VoteProcessor) {
+		vp.chain = names
+	}
+}
+
+// CheckValidators returns an error for the first name that isn't a rule the
+// processor knows, so chains can be checked before they're used
+func (vp *VoteProcessor) CheckValidators(names []string) error {
+	for _, name := range names {
+		if _, ok := vp.validators[name]; !ok {
+			return fmt.Errorf("unknown validator %q", name)
+		}
+	}
+	return nil
+}
+
+// validate runs a vote through its poll's chain, returning the rule that
+// rejected it and why
+func (vp *VoteProcessor) validate(ctx context.Context, c VoteCheck) (string, *Rejection, error) {
+	names := c.Settings.Validators
+	if len(names) == 0 {
+		names = vp.chain
+	}
+
+	for _, name := range names {
+		v, ok := vp.validators[name]
+		if !ok {
+			// chains are checked when they're saved, so a rule must have gone
+			// away since; better to refuse votes than to skip it
+			return name, reject("unknown_rule", "poll asks for validator %q, which doesn't exist", name), nil
+		}
+		r, err := v.Validate(ctx, c)
+		if err != nil {
+			return name, nil, fmt.Errorf("validator %s: %v", name, err)
+		}
+		if r != nil {
+			return name, r, nil
+		}
+	}
+	return "", nil, nil
+}
@@ -0,0 +1,224 @@
+package processing
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+)
+
+// schema: the vote has what every vote needs
+type schemaValidator struct{}
+
+func (schemaValidator) Name() string { return "schema" }
+
+func (schemaValidator) Validate(_ context.Context, c VoteCheck) (*Rejection, error) {
+	v := c.Vote
+	if v.PollID == "" || v.UserID == "" {
+		return reject("invalid_vote", "vote needs both a poll_id and a user_id"), nil
+	}
+
+	switch kind := v.KindOrDefault(); kind {
+	case model.VoteKindCast, model.VoteKindChange:
+		if len(v.Options()) == 0 {
+			return reject("invalid_vote", "%s selects no options", kind), nil
+		}
+	case model.VoteKindRetract:
+	default:
+		return reject("invalid_vote", "unknown vote kind %q", kind), nil
+	}
+	// the weight the producer sent isn't checked, the processor replaces it
+	return nil, nil
+}
+
+// poll_exists: the poll's settings were saved before its votes came in
+type pollExistsValidator struct{}
+
+func (pollExistsValidator) Name() string { return "poll_exists" }
+
+func (pollExistsValidator) Validate(ctx context.Context, c VoteCheck) (*Rejection, error) {
+	ok, err := c.Store.HasPollSettings(ctx, c.Vote.PollID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return reject("unknown_poll", "poll %s has no settings", c.Vote.PollID), nil
+	}
+	return nil, nil
+}
+
+// blocklist: the user isn't in the poll's BlockedUsers
+type blocklistValidator struct{}
+
+func (blocklistValidator) Name() string { return "blocklist" }
+
+func (blocklistValidator) Validate(_ context.Context, c VoteCheck) (*Rejection, error) {
+	if slices.Contains(c.Settings.BlockedUsers, c.Vote.UserID) {
+		return reject("blocked_user", "UserID %s is blocked from the poll", c.Vote.UserID), nil
+	}
+	return nil, nil
+}
+
+// channel: the vote came in through one of the poll's Channels, when it lists them
+type channelValidator struct{}
+
+func (channelValidator) Name() string { return "channel" }
+
+func (channelValidator) Validate(_ context.Context, c VoteCheck) (*Rejection, error) {
+	channels := c.Settings.Channels
+	if len(channels) == 0 || slices.Contains(channels, c.Vote.Metadata.Channel) {
+		return nil, nil
+	}
+	return reject("channel_not_allowed", "vote came in through channel %q, which the poll doesn't take", c.Vote.Metadata.Channel), nil
+}
+
+// window_open: the vote was received between the poll's OpensAt and ClosesAt
+type windowOpenValidator struct{}
+
+func (windowOpenValidator) Name() string { return "window_open" }
+
+func (windowOpenValidator) Validate(_ context.Context, c VoteCheck) (*Rejection, error) {
+	at := c.Vote.ReceivedAtOrNow()
+	if !c.Settings.IsOpened(at) {
+		return reject("poll_not_open", "vote received at %s, before the poll opened", at.Format(time.RFC3339)), nil
+	}
+	if c.Settings.IsClosed(at) {
+		return reject("poll_closed", "vote received at %s, after the poll closed", at.Format(time.RFC3339)), nil
+	}
+	return nil, nil
+}
+
+// changes_allowed: changes and retractions only go to polls that allow them
+type changesAllowedValidator struct{}
+
+func (changesAllowedValidator) Name() string { return "changes_allowed" }
+
+func (changesAllowedValidator) Validate(_ context.Context, c VoteCheck) (*Rejection, error) {
+	if kind := c.Vote.KindOrDefault(); kind != model.VoteKindCast && !c.Settings.AllowVoteChanges {
+		return reject("changes_not_allowed", "poll doesn't allow a %s", kind), nil
+	}
+	return nil, nil
+}
+
+// option_allowed: the selection fits the poll mode and only picks the poll's
+// Options, when it lists them. Retractions don't select anything
+type optionAllowedValidator struct{}
+
+func (optionAllowedValidator) Name() string { return "option_allowed" }
+
+func (optionAllowedValidator) Validate(_ context.Context, c VoteCheck) (*Rejection, error) {
+	if c.Vote.KindOrDefault() == model.VoteKindRetract {
+		return nil, nil
+	}
+
+	options := c.Vote.Options()
+	if err := validateSelection(c.Settings, options); err != nil {
+		return &Rejection{Reason: "invalid_selection", Err: err}, nil
+	}
+	if len(c.Settings.Options) == 0 {
+		return nil, nil
+	}
+	for _, o := range options {
+		if !slices.Contains(c.Settings.Options, o) {
+			return reject("option_not_allowed", "option %s isn't one of the poll's options", o), nil
+		}
+	}
+	return nil, nil
+}
+
+/*
+rate_limit: the user stays within the poll's RateLimit. It goes by when the
+votes were received, not by their Timestamp, which the producer could set to
+spread a burst out.
+
+Each consumer keeps its own counts in memory. Votes are keyed by poll ID, so
+all of a poll's votes go to the same partition and the same consumer, but
+after a rebalance the new owner of the partition starts counting from zero.
+
+A vote is counted once by its VoteID: checking it again, because it's
+retried or redelivered, doesn't count it twice. Votes without a VoteID
+can't be told apart from new ones and count every time they're checked.
+*/
+type rateLimitValidator struct {
+	mu      sync.Mutex
+	votes   map[rateLimitKey]*rateLimitLog
+	sweepAt int
+}
+
+type rateLimitKey struct {
+	tenantID, pollID, userID string
+}
+
+// rateLimitLog is a user's recent votes in a poll
+type rateLimitLog struct {
+	votes  []rateLimitVote
+	window time.Duration
+}
+
+type rateLimitVote struct {
+	voteID string
+	at     time.Time
+}
+
+// minSweepAt is how many users are tracked before the first sweep
+const minSweepAt = 1024
+
+func newRateLimitValidator() *rateLimitValidator {
+	return &rateLimitValidator{votes: make(map[rateLimitKey]*rateLimitLog), sweepAt: minSweepAt}
+}
+
+func (*rateLimitValidator) Name() string { return "rate_limit" }
+
+func (rl *rateLimitValidator) Validate(_ context.Context, c VoteCheck) (*Rejection, error) {
+	limit := c.Settings.RateLimit
+	if limit == nil || limit.Votes <= 0 || limit.WindowSeconds <= 0 {
+		return nil, nil
+	}
+
+	at := c.Vote.ReceivedAtOrNow()
+	key := rateLimitKey{c.Vote.TenantID, c.Vote.PollID, c.Vote.UserID}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	l, ok := rl.votes[key]
+	if !ok {
+		l = &rateLimitLog{}
+		rl.votes[key] = l
+	}
+	l.window = limit.Window()
+	l.expire(at)
+
+	if id := c.Vote.VoteID; id != "" && slices.ContainsFunc(l.votes, func(v rateLimitVote) bool { return v.voteID == id }) {
+		return nil, nil // counted when it was first checked
+	}
+	if len(l.votes) >= limit.Votes {
+		return reject("rate_limited", "UserID %s already voted %d times in the last %s", c.Vote.UserID, len(l.votes), l.window), nil
+	}
+	l.votes = append(l.votes, rateLimitVote{c.Vote.VoteID, at})
+
+	if len(rl.votes) >= rl.sweepAt {
+		rl.sweep(at)
+	}
+	return nil, nil
+}
+
+// expire drops the votes that are out of the window ending at now
+func (l *rateLimitLog) expire(now time.Time) {
+	cutoff := now.Add(-l.window)
+	l.votes = slices.DeleteFunc(l.votes, func(v rateLimitVote) bool { return !v.at.After(cutoff) })
+}
+
+// sweep forgets the users with no vote left in their window, so polls that
+// ended don't stay in memory, and sweeps again once the rest doubles
+func (rl *rateLimitValidator) sweep(now time.Time) {
+	for key, l := range rl.votes {
+		l.expire(now)
+		if len(l.votes) == 0 {
+			delete(rl.votes, key)
+		}
+	}
+	rl.sweepAt = max(minSweepAt, 2*len(rl.votes))
+}
@@ -0,0 +1,52 @@
+package processing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+)
+
+func TestRateLimitRetriedVote(t *testing.T) {
+	ctx := context.Background()
+	rl := newRateLimitValidator()
+	settings := model.PollSettings{RateLimit: &model.RateLimit{Votes: 1, WindowSeconds: 60}}
+	receivedAt := time.Now()
+	vote := model.Vote{PollID: "p", UserID: "u", OptionID: "a", VoteID: "v1", ReceivedAt: receivedAt}
+
+	// the vote is checked again when a store read after the checks failed
+	for attempt := 1; attempt <= 3; attempt++ {
+		rejection, err := rl.Validate(ctx, VoteCheck{Vote: vote, Settings: settings})
+		if err != nil || rejection != nil {
+			t.Fatalf("attempt %d: got %v, %v, want the vote through", attempt, rejection, err)
+		}
+	}
+
+	// another vote of the user is over the limit
+	other := vote
+	other.VoteID = "v2"
+	other.ReceivedAt = receivedAt.Add(time.Second)
+	rejection, err := rl.Validate(ctx, VoteCheck{Vote: other, Settings: settings})
+	if err != nil || rejection == nil || rejection.Reason != "rate_limited" {
+		t.Fatalf("second vote got %v, %v, want rate_limited", rejection, err)
+	}
+
+	// and without a vote ID every check counts
+	noID := vote
+	noID.UserID, noID.VoteID = "u2", ""
+	if rejection, _ := rl.Validate(ctx, VoteCheck{Vote: noID, Settings: settings}); rejection != nil {
+		t.Fatalf("first vote without an ID got %v", rejection)
+	}
+	if rejection, _ := rl.Validate(ctx, VoteCheck{Vote: noID, Settings: settings}); rejection == nil {
+		t.Fatal("second check of a vote without an ID went through")
+	}
+}
+
+func TestSchemaIgnoresProducerWeight(t *testing.T) {
+	vote := model.Vote{PollID: "p", UserID: "u", OptionID: "a", Weight: -3}
+	r, err := schemaValidator{}.Validate(context.Background(), VoteCheck{Vote: vote})
+	if err != nil || r != nil {
+		t.Fatalf("vote with a negative producer weight = %v, %v, want it through", r, err)
+	}
+}
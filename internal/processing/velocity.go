@@ -0,0 +1,109 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+)
+
+/*
+VelocityDetector flags bursts of votes that one user voting twice wouldn't
+show: a lot of votes from one source IP or one device, one user voting in a
+lot of polls, or a lot of users whose IDs only differ in a trailing number
+(bot-0001, bot-0002...). Each signal counts distinct votes in a sliding
+window, across every poll of the tenant, with the store's velocity counters,
+so every consumer sees the same counts and they survive restarts.
+
+A flagged vote is tagged with the signals it went over. The processor counts
+it anyway, or sends it to the review topic instead when it has one.
+
+The source IP and device come from the client, see model.VoteMetadata: a
+client that makes up a new one per vote stays under their limits.
+*/
+type VelocityDetector struct {
+	rules []VelocityRule
+}
+
+// the signals a VelocityRule can watch
+const (
+	SignalSourceIP   = "source_ip"
+	SignalDeviceID   = "device_id"
+	SignalUser       = "user"
+	SignalUserFamily = "user_family"
+)
+
+// VelocityRule flags a vote once its signal has seen more than Limit
+// distinct votes in the last Window
+type VelocityRule struct {
+	Signal string
+	Limit  int
+	Window time.Duration
+}
+
+func NewVelocityDetector(rules []VelocityRule) (*VelocityDetector, error) {
+	for _, r := range rules {
+		switch r.Signal {
+		case SignalSourceIP, SignalDeviceID, SignalUser, SignalUserFamily:
+		default:
+			return nil, fmt.Errorf("unknown velocity signal %q", r.Signal)
+		}
+		if r.Limit <= 0 || r.Window <= 0 {
+			return nil, fmt.Errorf("velocity rule %s needs a positive limit and window", r.Signal)
+		}
+	}
+	return &VelocityDetector{rules: rules}, nil
+}
+
+// Check records the vote in the counters of every rule and returns the
+// signals it went over the limit on
+func (d *VelocityDetector) Check(ctx context.Context, s store.VoteStore, v model.Vote) ([]string, error) {
+	var flagged []string
+	for _, r := range d.rules {
+		key, member, ok := velocityKey(r.Signal, v)
+		if !ok {
+			continue
+		}
+		n, err := s.RecordVelocity(ctx, key, member, v.ReceivedAtOrNow(), r.Window)
+		if err != nil {
+			return nil, err
+		}
+		if n > r.Limit {
+			flagged = append(flagged, r.Signal)
+		}
+	}
+	return flagged, nil
+}
+
+// velocityKey returns the counter a vote goes to for a signal, and what it
+// counts as there. It's false when the vote doesn't carry the signal
+func velocityKey(signal string, v model.Vote) (string, string, bool) {
+	// a user counts once per poll, so a change isn't a second vote
+	pollUser := v.PollID + " " + v.UserID
+
+	switch signal {
+	case SignalSourceIP:
+		return signal + ":" + v.Metadata.SourceIP, pollUser, v.Metadata.SourceIP != ""
+	case SignalDeviceID:
+		return signal + ":" + v.Metadata.DeviceID, pollUser, v.Metadata.DeviceID != ""
+	case SignalUser:
+		return signal + ":" + v.UserID, v.PollID, true
+	case SignalUserFamily:
+		family := userFamily(v.UserID)
+		return signal + ":" + family, pollUser, family != ""
+	}
+	return "", "", false
+}
+
+// userFamily is the user ID without its trailing digits, empty for IDs that
+// don't end in a number or are nothing but one
+func userFamily(userID string) string {
+	family := strings.TrimRight(userID, "0123456789")
+	if family == userID {
+		return ""
+	}
+	return family
+}
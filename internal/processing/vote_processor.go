@@ -4,16 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/breaker"
 	"github.com/Guizzs26/real_time_voting_analysis_system/internal/event"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/export"
 	"github.com/Guizzs26/real_time_voting_analysis_system/internal/metrics"
 	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
 	"github.com/Guizzs26/real_time_voting_analysis_system/internal/pubsub"
 	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/tally"
 )
 
 type VoteProcessor struct {
@@ -25,9 +30,105 @@ type VoteProcessor struct {
 	numWorkers int
 	wg         sync.WaitGroup
 
-	// we maintain minimal, local state: just the IDs of polls we've already seen
-	mu         sync.Mutex
-	knownPolls map[string]bool
+	// polls without votes for longer than reportWindow drop out of printResults
+	reportWindow time.Duration
+
+	// tenants the periodic jobs go through, just the default one unless set
+	tenants []string
+
+	// exports closed polls when set
+	exporter *export.Exporter
+
+	// the rules polls can name in their chain, and the chain of those that don't
+	validators map[string]Validator
+	chain      []string
+
+	// flags vote bursts when set; flagged votes are held in quarantine and/or
+	// published for review instead of counted when either is set too
+	velocity   *VelocityDetector
+	quarantine bool
+	review     event.VotePublisher
+
+	// how often a failed store write is retried in-process, and the retry
+	// topics the vote goes through after that, see retry.go
+	storeRetries int
+	retryTiers   []RetryTier
+
+	// the breakers the store and the DLQ publisher are behind, when they are
+	storeBreaker, dlqBreaker *breaker.Breaker
+
+	// the known polls live in the store; locally we only remember the polls
+	// we're done checking for a close: closed ones whose final runoff we've
+	// already streamed and that we've exported, and polls that need neither
+	mu        sync.Mutex
+	announced map[pollRef]bool
+}
+
+// pollRef names a poll across tenants
+type pollRef struct {
+	tenantID, pollID string
+}
+
+type Option func(*VoteProcessor)
+
+// WithTenants sets the tenants whose polls the periodic report and the close
+// announcements go through. Votes are processed for any tenant either way
+func WithTenants(tenants []string) Option {
+	return func(vp *VoteProcessor) {
+		vp.tenants = tenants
+	}
+}
+
+// WithExporter exports every poll's votes and final tally once it closes.
+// The processor only remembers which polls it exported while it runs, so
+// after a restart the closed polls are exported again
+func WithExporter(e *export.Exporter) Option {
+	return func(vp *VoteProcessor) {
+		vp.exporter = e
+	}
+}
+
+// WithVelocityDetector tags the votes that are part of a burst, see VelocityDetector
+func WithVelocityDetector(d *VelocityDetector) Option {
+	return func(vp *VoteProcessor) {
+		vp.velocity = d
+	}
+}
+
+// WithReview quarantines the votes the velocity detector flags: they're
+// published to p, for someone to look at, instead of being counted
+func WithReview(p event.VotePublisher) Option {
+	return func(vp *VoteProcessor) {
+		vp.review = p
+	}
+}
+
+// WithBreakers tells the processor the breakers its store and DLQ publisher
+// are behind, either can be nil. While the store's is open no vote is read,
+// so no offset is committed, until it's time to probe again. While the DLQ's
+// is, the votes bound for the DLQ wait for it, whichever way they were read
+func WithBreakers(storeBreaker, dlqBreaker *breaker.Breaker) Option {
+	return func(vp *VoteProcessor) {
+		vp.storeBreaker = storeBreaker
+		vp.dlqBreaker = dlqBreaker
+	}
+}
+
+// WithReportWindow sets how long a poll stays in the periodic report after
+// its last vote. The default is one hour
+func WithReportWindow(d time.Duration) Option {
+	return func(vp *VoteProcessor) {
+		vp.reportWindow = d
+	}
+}
+
+// RunoffMessage is streamed over the hub with a ranked poll's tabulation,
+// once when the poll closes and whenever someone asks for it
+type RunoffMessage struct {
+	Type   string             `json:"type"`
+	PollID string             `json:"poll_id"`
+	Final  bool               `json:"final"`
+	Result tally.RunoffResult `json:"result"`
 }
 
 func NewVoteProcessor(
@@ -37,27 +138,41 @@ func NewVoteProcessor(
 	s store.VoteStore,
 	h *pubsub.Hub,
 	nw int,
+	opts ...Option,
 ) *VoteProcessor {
-	return &VoteProcessor{
-		consumer:   c,
-		publisher:  p,
-		metrics:    m,
-		store:      s,
-		hub:        h,
-		numWorkers: nw,
-		knownPolls: make(map[string]bool),
+	vp := &VoteProcessor{
+		consumer:     c,
+		publisher:    p,
+		metrics:      m,
+		store:        s,
+		hub:          h,
+		numWorkers:   nw,
+		reportWindow: time.Hour,
+		tenants:      []string{""},
+		announced:    make(map[pollRef]bool),
+		validators:   make(map[string]Validator),
+		chain:        DefaultValidators,
+		storeRetries: 3,
+	}
+	for _, v := range builtinValidators() {
+		vp.validators[v.Name()] = v
 	}
+	for _, opt := range opts {
+		opt(vp)
+	}
+	return vp
 }
 
 func (vp *VoteProcessor) Run(ctx context.Context) error {
-	rTicker := time.NewTicker(5 * time.Second)
-	defer rTicker.Stop()
-
 	jobs := make(chan model.Vote, 100)
 	for i := 1; i < vp.numWorkers; i++ {
 		vp.wg.Add(1)
 		go vp.worker(ctx, i+1, jobs)
 	}
+	for i := range vp.retryTiers {
+		vp.wg.Add(1)
+		go vp.runRetryTier(ctx, i)
+	}
 
 	go func() {
 		for {
@@ -68,11 +183,20 @@ func (vp *VoteProcessor) Run(ctx context.Context) error {
 				return
 
 			default:
+				// the vote's worker takes the store's probe, not the reader
+				if err := waitBreaker(ctx, vp.storeBreaker, false); err != nil {
+					continue
+				}
 				v, err := vp.consumer.ReadMessage(ctx)
 				if err != nil {
 					if errors.Is(err, context.Canceled) || errors.Is(err, io.EOF) {
 						continue
 					}
+					var rejected *event.RejectedMessageError
+					if errors.As(err, &rejected) {
+						vp.rejectMessage(ctx, vp.consumer, rejected)
+						continue
+					}
 					log.Printf("Error reading message from kafka: %v", err)
 					continue
 				}
@@ -91,6 +215,7 @@ func (vp *VoteProcessor) Run(ctx context.Context) error {
 				return
 			case <-resultsTicker.C:
 				vp.printResults(ctx)
+				vp.announceClosedPolls(ctx)
 			}
 		}
 	}()
@@ -104,96 +229,437 @@ func (vp *VoteProcessor) Run(ctx context.Context) error {
 	return nil
 }
 
-func (vp *VoteProcessor) processVote(ctx context.Context, v model.Vote) {
+// Process runs a single vote through the processor, outside of Run. Replays
+// use it to apply votes with exactly the rules the live consumer applies. It
+// returns an error when the vote couldn't be handled, rejections aren't
+func (vp *VoteProcessor) Process(ctx context.Context, v model.Vote) error {
+	return vp.handleVote(ctx, v, 0)
+}
+
+// waitBreaker blocks while b is open, see breaker.Wait, and with turn set
+// takes its probe, see breaker.WaitTurn. A nil b is never open
+func waitBreaker(ctx context.Context, b *breaker.Breaker, turn bool) error {
+	switch {
+	case b == nil:
+		return nil
+	case turn:
+		return b.WaitTurn(ctx)
+	}
+	return b.Wait(ctx)
+}
+
+/*
+untilHandled runs handle for a vote until it goes through. A vote read with
+its offset committed after processing holds back its partition's commits
+until it's acked, so a vote whose DLQ or retry publish failed is handled
+again, backing off, until it isn't or ctx is done: the store absorbs what an
+earlier attempt already applied, and a rejection comes back to be published
+again. Votes committed when they were read get one attempt, like before,
+unless a breaker turned it down: they're held like the others until the
+breaker lets them through, rather than dropped.
+*/
+func (vp *VoteProcessor) untilHandled(ctx context.Context, v model.Vote, handle func() error) error {
+	wait := storeRetryBase
+	for {
+		err := handle()
+		if err == nil || (v.Source == "" && !errors.Is(err, breaker.ErrOpen)) {
+			return err
+		}
+
+		log.Printf("Vote from %s not handled, trying again in %s: %v", v.Source, wait, err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+		wait = min(2*wait, storeRetryMax)
+	}
+}
+
+// rejectMessage sends a vote its consumer turned down to the DLQ, and acks it
+func (vp *VoteProcessor) rejectMessage(ctx context.Context, c event.VoteConsumer, rejected *event.RejectedMessageError) {
+	v := rejected.Vote
+	log.Printf("[REJECTED] Vote from UserID: %s to PollID: %s: %v", v.UserID, v.PollID, rejected.Err)
+	vp.metrics.VotesRejected.WithLabelValues(v.TenantID, v.PollID, rejected.Reason).Inc()
+	err := vp.untilHandled(ctx, v, func() error {
+		return vp.sendToDLQ(ctx, v, "", &Rejection{Reason: rejected.Reason, Err: rejected.Err})
+	})
+	if err == nil {
+		ack(ctx, c, v)
+	}
+}
+
+// ack tells a consumer that commits after processing that it's done with a vote
+func ack(ctx context.Context, c event.VoteConsumer, v model.Vote) {
+	acker, ok := c.(event.Acker)
+	if !ok {
+		return
+	}
+	if err := acker.Ack(ctx, v); err != nil {
+		log.Printf("Error committing vote from %s: %v", v.Source, err)
+	}
+}
+
+// handleVote runs a vote through the processor, and sends it to the given
+// retry tier when the store failed it
+func (vp *VoteProcessor) handleVote(ctx context.Context, v model.Vote, tier int) error {
+	err := vp.processVote(ctx, v)
+	var se *storeError
+	if errors.As(err, &se) {
+		return vp.retryLater(ctx, se.vote, tier, se.err)
+	}
+	return err
+}
+
+// processVote returns an error when the vote couldn't be handled, it was
+// logged already, a *storeError when the store failed it. Rejections aren't
+// errors, the vote was handled
+func (vp *VoteProcessor) processVote(ctx context.Context, v model.Vote) error {
 	start := time.Now()
 	defer func() {
 		duration := time.Since(start).Seconds()
-		vp.metrics.ProcessingTime.WithLabelValues(v.PollID).Observe(duration)
+		vp.metrics.ProcessingTime.WithLabelValues(v.TenantID, v.PollID).Observe(duration)
 	}()
 
-	isNewVote, err := vp.store.RegisterVote(ctx, v)
+	kind := v.KindOrDefault()
+	s := vp.store.ForTenant(v.TenantID)
+	// the vote was read already, but it can still wait for the store to come back
+	if err := waitBreaker(ctx, vp.storeBreaker, true); err != nil {
+		return err
+	}
+	settings, err := s.GetPollSettings(ctx, v.PollID)
 	if err != nil {
-		log.Printf("Error registering vote: %v", err)
-		return
+		log.Printf("Error getting settings for PollID %s: %v", v.PollID, err)
+		return &storeError{v, err}
 	}
 
-	vp.mu.Lock()
-	vp.knownPolls[v.PollID] = true
-	vp.mu.Unlock()
-
-	if !isNewVote {
-		log.Printf("[FRAUD DETECTED] Duplicate vote from UserID: %s to PollID: %s", v.UserID, v.PollID)
-		vp.metrics.VotesDuplicate.WithLabelValues(v.PollID).Inc()
+	rule, rejection, err := vp.validate(ctx, VoteCheck{Vote: v, Settings: settings, Store: s})
+	if err != nil {
+		log.Printf("Error validating vote from UserID %s in PollID %s: %v", v.UserID, v.PollID, err)
+		return &storeError{v, err} // the validators only fail on the store
+	}
+	if rejection != nil {
+		log.Printf("[REJECTED] Vote from UserID: %s in PollID: %s failed %s: %v", v.UserID, v.PollID, rule, rejection.Err)
+		vp.metrics.VotesRejected.WithLabelValues(v.TenantID, v.PollID, rejection.Reason).Inc()
+		vp.metrics.ValidatorRejections.WithLabelValues(v.TenantID, v.PollID, rule).Inc()
+		return vp.sendToDLQ(ctx, v, rule, rejection)
+	}
 
-		dlqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		defer cancel()
+	if kind != model.VoteKindRetract {
+		// the weight table is the only say on a vote's weight, whatever the
+		// producer put in the payload. Voters who aren't in it weigh 1
+		w, ok, err := s.GetVoterWeight(ctx, v.UserID)
+		if err != nil {
+			log.Printf("Error getting weight for UserID %s: %v", v.UserID, err)
+			return &storeError{v, err}
+		}
+		v.Weight = 0
+		if ok {
+			v.Weight = w
+		}
+	}
 
-		if err := vp.publisher.PublishMessage(dlqCtx, v, v.PollID); err != nil {
-			log.Printf("[CRITICAL ERROR] Failed to publishing to DLQ: %v", err)
+	if vp.velocity != nil && kind != model.VoteKindRetract {
+		signals, err := vp.velocity.Check(ctx, s, v)
+		if err != nil {
+			log.Printf("Error checking vote velocity for UserID %s in PollID %s: %v", v.UserID, v.PollID, err)
+			return &storeError{v, err}
+		}
+		if len(signals) > 0 {
+			v.Flags = signals
+			for _, signal := range signals {
+				vp.metrics.VotesFlagged.WithLabelValues(v.TenantID, v.PollID, signal).Inc()
+			}
+			if vp.quarantine || vp.review != nil {
+				log.Printf("[QUARANTINED] Vote from UserID: %s in PollID: %s flagged by %s", v.UserID, v.PollID, strings.Join(signals, ", "))
+				vp.metrics.VotesQuarantined.WithLabelValues(v.TenantID, v.PollID).Inc()
+				if vp.quarantine {
+					if err := vp.quarantineVote(ctx, s, v); err != nil {
+						return err
+					}
+				}
+				if vp.review != nil {
+					return vp.sendToReview(ctx, v)
+				}
+				return nil
+			}
+			log.Printf("[FLAGGED] Vote from UserID: %s in PollID: %s flagged by %s", v.UserID, v.PollID, strings.Join(signals, ", "))
 		}
-		return // we're done here
 	}
 
-	log.Printf("[VALID VOTE] UserID: %s voted for OptionID: %s in PollID: %s", v.UserID, v.OptionID, v.PollID)
-	vp.metrics.VotesProcessed.WithLabelValues(v.PollID).Inc()
+	v.Checked = true
+	if _, err := vp.countVote(ctx, s, v); err != nil {
+		return err
+	}
+	return nil
+}
 
-	r, err := vp.store.GetResults(ctx, v.PollID)
+// countVote registers a vote that passed every check and broadcasts the new
+// results when it moved the tally
+func (vp *VoteProcessor) countVote(ctx context.Context, s store.VoteStore, v model.Vote) (store.VoteResult, error) {
+	kind := v.KindOrDefault()
+	res, err := vp.registerVote(ctx, s, v)
+	if err != nil {
+		return res, err
+	}
+
+	switch res.Outcome {
+	case store.VoteReplayed:
+		// a retry wrote the same vote twice, that's not the user voting twice
+		log.Printf("[RETRY ABSORBED] VoteID: %s from UserID: %s in PollID: %s was already applied", v.VoteID, v.UserID, v.PollID)
+		vp.metrics.VotesReplayed.WithLabelValues(v.TenantID, v.PollID).Inc()
+		return res, nil
+
+	case store.VoteDuplicate:
+		log.Printf("[FRAUD DETECTED] Duplicate vote from UserID: %s to PollID: %s", v.UserID, v.PollID)
+		vp.metrics.VotesDuplicate.WithLabelValues(v.TenantID, v.PollID).Inc()
+		return res, vp.sendToDLQ(ctx, v, "", reject("duplicate", "UserID %s already voted", v.UserID)) // we're done here
+
+	case store.VoteNotFound:
+		log.Printf("[REJECTED] UserID: %s has no vote to %s in PollID: %s", v.UserID, kind, v.PollID)
+		vp.metrics.VotesRejected.WithLabelValues(v.TenantID, v.PollID, "no_previous_vote").Inc()
+		return res, vp.sendToDLQ(ctx, v, "", reject("no_previous_vote", "UserID %s has no vote to %s", v.UserID, kind))
+
+	case store.VoteUnchanged:
+		log.Printf("[UNCHANGED VOTE] UserID: %s already voted for OptionIDs: %s in PollID: %s", v.UserID, strings.Join(v.Options(), ","), v.PollID)
+		return res, nil // nothing moved, so there's nothing new to broadcast
+
+	case store.VoteChanged:
+		log.Printf("[CHANGED VOTE] UserID: %s moved from OptionIDs: %s to OptionIDs: %s in PollID: %s", v.UserID, strings.Join(res.PreviousOptionIDs, ","), strings.Join(v.Options(), ","), v.PollID)
+		vp.metrics.VotesChanged.WithLabelValues(v.TenantID, v.PollID).Inc()
+
+	case store.VoteRetracted:
+		log.Printf("[RETRACTED VOTE] UserID: %s retracted its vote for OptionIDs: %s in PollID: %s", v.UserID, strings.Join(res.PreviousOptionIDs, ","), v.PollID)
+		vp.metrics.VotesRetracted.WithLabelValues(v.TenantID, v.PollID).Inc()
+
+	default:
+		log.Printf("[VALID VOTE] UserID: %s voted for OptionIDs: %s in PollID: %s", v.UserID, strings.Join(v.Options(), ","), v.PollID)
+		vp.metrics.VotesProcessed.WithLabelValues(v.TenantID, v.PollID).Inc()
+	}
+
+	r, err := getResults(ctx, s, v.PollID)
 	if err != nil {
 		log.Printf("Error getting results for PollID %s: %v", v.PollID, err)
-		return
+		return res, nil
 	}
 
 	rJSON, err := json.Marshal(r)
 	if err != nil {
 		log.Printf("Error marshalling vote to JSON: %v", err)
-		return
+		return res, nil
+	}
+
+	vp.broadcast(v.TenantID, v.PollID, rJSON)
+	return res, nil
+}
+
+func (vp *VoteProcessor) broadcast(tenantID, pollID string, data []byte) {
+	if vp.hub == nil {
+		return // replays have nobody listening
 	}
 
 	m := &pubsub.Message{
-		PollID: v.PollID,
-		Data:   rJSON,
+		TenantID: tenantID,
+		PollID:   pollID,
+		Data:     data,
 	}
 
 	select {
 	case vp.hub.Broadcast <- m:
 		// message sent successfully
-		log.Printf("Poll score %s sent to Hub.", v.PollID)
+		log.Printf("Poll score %s sent to Hub.", pollID)
 	default:
-		log.Printf("Warning: Broadcast channel is full, dropping message for PollID: %s", v.PollID)
+		log.Printf("Warning: Broadcast channel is full, dropping message for PollID: %s", pollID)
 	}
 }
 
-func (vp *VoteProcessor) printResults(ctx context.Context) {
-	vp.mu.Lock()
-	pollIDs := make([]string, 0, len(vp.knownPolls))
-	for id := range vp.knownPolls {
-		pollIDs = append(pollIDs, id)
+// Runoff tabulates the current ballots of a ranked poll
+func (vp *VoteProcessor) Runoff(ctx context.Context, tenantID, pollID string) (tally.RunoffResult, error) {
+	ballots, err := vp.store.ForTenant(tenantID).GetBallots(ctx, pollID)
+	if err != nil {
+		return tally.RunoffResult{}, err
 	}
-	vp.mu.Unlock()
+	return tally.InstantRunoff(ballots), nil
+}
+
+// BroadcastRunoff tabulates a ranked poll and streams the result to its subscribers
+func (vp *VoteProcessor) BroadcastRunoff(ctx context.Context, tenantID, pollID string, final bool) (tally.RunoffResult, error) {
+	r, err := vp.Runoff(ctx, tenantID, pollID)
+	if err != nil {
+		return r, err
+	}
+
+	data, err := json.Marshal(RunoffMessage{Type: "runoff", PollID: pollID, Final: final, Result: r})
+	if err != nil {
+		return r, fmt.Errorf("error marshalling runoff result: %v", err)
+	}
+
+	vp.broadcast(tenantID, pollID, data)
+	return r, nil
+}
 
-	log.Println("--- CURRENT SCORE (Redis) ---")
-	if len(pollIDs) == 0 {
-		log.Println("No polls processed yet")
+// announceClosedPolls streams the final runoff of every ranked poll that closed
+// since the last check, and exports the closed polls when there's an exporter
+func (vp *VoteProcessor) announceClosedPolls(ctx context.Context) {
+	for _, tenantID := range vp.tenants {
+		vp.announceClosedTenantPolls(ctx, tenantID)
+	}
+}
+
+func (vp *VoteProcessor) announceClosedTenantPolls(ctx context.Context, tenantID string) {
+	s := vp.store.ForTenant(tenantID)
+	polls, err := s.ListPolls(ctx, time.Time{})
+	if err != nil {
+		log.Printf("Error listing polls: %v", err)
 		return
 	}
 
-	for _, poolID := range pollIDs {
-		rs, err := vp.store.GetResults(ctx, poolID)
+	vp.mu.Lock()
+	pollIDs := make([]string, 0, len(polls))
+	for _, p := range polls {
+		if !vp.announced[pollRef{tenantID, p.PollID}] {
+			pollIDs = append(pollIDs, p.PollID)
+		}
+	}
+	vp.mu.Unlock()
+
+	for _, pollID := range pollIDs {
+		ref := pollRef{tenantID, pollID}
+		settings, err := s.GetPollSettings(ctx, pollID)
 		if err != nil {
-			log.Printf("Error getting results for PollID %s: %v", poolID, err)
+			log.Printf("Error getting settings for PollID %s: %v", pollID, err)
 			continue
 		}
-
-		log.Printf("Poll: %s", poolID)
-		if len(rs) == 0 {
-			log.Println(" No votes counted yet")
+		ranked := settings.ModeOrDefault() == model.PollModeRanked
+		if !ranked && vp.exporter == nil {
+			vp.mu.Lock()
+			vp.announced[ref] = true // the mode doesn't change, no need to look again
+			vp.mu.Unlock()
 			continue
 		}
-		for optionID, count := range rs {
-			log.Printf(" Option %s: %d votes", optionID, count)
+		if !settings.IsClosed(time.Now()) {
+			continue
 		}
+
+		if ranked {
+			r, err := vp.BroadcastRunoff(ctx, tenantID, pollID, true)
+			if err != nil {
+				log.Printf("Error tabulating runoff for PollID %s: %v", pollID, err)
+				continue
+			}
+			log.Printf("Poll %s closed after %d runoff rounds, winner: %q", pollID, len(r.Rounds), r.Winner)
+		}
+
+		if vp.exporter != nil {
+			files, err := vp.exporter.ExportPoll(ctx, s, tenantID, pollID)
+			if err != nil {
+				log.Printf("Error exporting closed PollID %s: %v", pollID, err)
+				continue
+			}
+			log.Printf("Poll %s closed, exported to %s", pollID, strings.Join(files, ", "))
+		}
+
+		vp.mu.Lock()
+		vp.announced[ref] = true
+		vp.mu.Unlock()
+	}
+}
+
+// getResults reads both the raw and the weighted tally of a poll
+func getResults(ctx context.Context, s store.VoteStore, pollID string) (model.Results, error) {
+	counts, err := s.GetResults(ctx, pollID)
+	if err != nil {
+		return model.Results{}, err
+	}
+
+	weighted, err := s.GetWeightedResults(ctx, pollID)
+	if err != nil {
+		return model.Results{}, err
+	}
+
+	return model.Results{PollID: pollID, Counts: counts, Weighted: weighted}, nil
+}
+
+// sendToDLQ publishes a rejected vote with why it was rejected in its headers.
+// rule is empty for rejections that don't come from a validator
+func (vp *VoteProcessor) sendToDLQ(ctx context.Context, v model.Vote, rule string, r *Rejection) error {
+	// only the votes that go to the DLQ probe it
+	if err := waitBreaker(ctx, vp.dlqBreaker, true); err != nil {
+		return err
+	}
+	dlqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	headers := []event.Header{
+		{Key: event.RejectRuleHeader, Value: rule},
+		{Key: event.RejectReasonHeader, Value: r.Reason},
+		{Key: event.RejectErrorHeader, Value: r.Err.Error()},
+	}
+	if err := vp.publisher.PublishMessage(dlqCtx, v, v.PollID, headers...); err != nil {
+		log.Printf("[CRITICAL ERROR] Failed to publishing to DLQ: %v", err)
+		return err
 	}
-	log.Println("-----------------------------")
+	return nil
+}
+
+// sendToReview publishes a quarantined vote, tagged with its flags, to the review topic
+func (vp *VoteProcessor) sendToReview(ctx context.Context, v model.Vote) error {
+	reviewCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	header := event.Header{Key: event.FraudSignalsHeader, Value: strings.Join(v.Flags, ",")}
+	if err := vp.review.PublishMessage(reviewCtx, v, v.PollID, header); err != nil {
+		log.Printf("[CRITICAL ERROR] Failed to publish to the review topic: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (vp *VoteProcessor) printResults(ctx context.Context) {
+	since := time.Now().Add(-vp.reportWindow)
+	polls := make(map[string][]store.PollInfo, len(vp.tenants))
+	total := 0
+	for _, tenantID := range vp.tenants {
+		ps, err := vp.store.ForTenant(tenantID).ListPolls(ctx, since)
+		if err != nil {
+			log.Printf("Error listing polls: %v", err)
+			return
+		}
+		polls[tenantID] = ps
+		total += len(ps)
+	}
+
+	log.Println("--- CURRENT SCORE ---")
+	if total == 0 {
+		log.Printf("No votes processed in the last %s", vp.reportWindow)
+		return
+	}
+
+	for _, tenantID := range vp.tenants {
+		s := vp.store.ForTenant(tenantID)
+		for _, p := range polls[tenantID] {
+			poolID := p.PollID
+			rs, err := getResults(ctx, s, poolID)
+			if err != nil {
+				log.Printf("Error getting results for PollID %s: %v", poolID, err)
+				continue
+			}
+
+			if tenantID != "" {
+				log.Printf("Poll: %s (tenant %s)", poolID, tenantID)
+			} else {
+				log.Printf("Poll: %s", poolID)
+			}
+			if len(rs.Counts) == 0 {
+				log.Println(" No votes counted yet")
+				continue
+			}
+			for optionID, count := range rs.Counts {
+				log.Printf(" Option %s: %d votes (weight %.2f)", optionID, count, rs.Weighted[optionID])
+			}
+		}
+	}
+	log.Println("---------------------")
 }
 
 func (vp *VoteProcessor) worker(ctx context.Context, id int, jobs <-chan model.Vote) {
@@ -201,7 +667,16 @@ func (vp *VoteProcessor) worker(ctx context.Context, id int, jobs <-chan model.V
 	log.Printf("Worker %d started", id)
 
 	for vote := range jobs {
-		vp.processVote(ctx, vote)
+		err := vp.untilHandled(ctx, vote, func() error {
+			return vp.handleVote(ctx, vote, 0)
+		})
+		if err != nil {
+			if vote.Source != "" {
+				log.Printf("Vote from %s left uncommitted on shutdown, it's redelivered after a restart", vote.Source)
+			}
+			continue
+		}
+		ack(ctx, vp.consumer, vote)
 	}
 
 	log.Printf("Worker %d finished", id)
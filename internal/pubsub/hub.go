@@ -8,20 +8,29 @@ import (
 )
 
 type Message struct {
-	PollID string
-	Data   []byte
+	TenantID string
+	PollID   string
+	Data     []byte
 }
 
 // one client conenected via websocket
 type Client struct {
-	Hub    *Hub
-	Conn   *websocket.Conn
-	Send   chan []byte
-	PollID string
+	Hub      *Hub
+	Conn     *websocket.Conn
+	Send     chan []byte
+	TenantID string
+	PollID   string
+}
+
+// Channel is what clients subscribe to: a poll of a tenant. Two tenants can
+// have polls with the same ID without seeing each other's messages
+type Channel struct {
+	TenantID string
+	PollID   string
 }
 
 type Hub struct {
-	Clients    map[string]map[*Client]bool
+	Clients    map[Channel]map[*Client]bool
 	Broadcast  chan *Message
 	Register   chan *Client
 	Unregister chan *Client
@@ -29,7 +38,7 @@ type Hub struct {
 
 func NewHub() *Hub {
 	return &Hub{
-		Clients:    make(map[string]map[*Client]bool),
+		Clients:    make(map[Channel]map[*Client]bool),
 		Broadcast:  make(chan *Message),
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
@@ -40,27 +49,29 @@ func (h *Hub) Run() {
 	for {
 		select {
 		case client := <-h.Register:
-			conn := h.Clients[client.PollID]
+			ch := Channel{client.TenantID, client.PollID}
+			conn := h.Clients[ch]
 			if conn == nil {
 				conn = make(map[*Client]bool)
-				h.Clients[client.PollID] = conn
+				h.Clients[ch] = conn
 			}
 			conn[client] = true
 
 		case client := <-h.Unregister:
-			conn := h.Clients[client.PollID]
+			ch := Channel{client.TenantID, client.PollID}
+			conn := h.Clients[ch]
 			if conn != nil {
 				if _, ok := conn[client]; ok {
 					delete(conn, client)
 					close(client.Send)
 					if len(conn) == 0 {
-						delete(h.Clients, client.PollID)
+						delete(h.Clients, ch)
 					}
 				}
 			}
 
 		case message := <-h.Broadcast:
-			conn := h.Clients[message.PollID]
+			conn := h.Clients[Channel{message.TenantID, message.PollID}]
 			for c := range conn {
 				select {
 				case c.Send <- message.Data:
@@ -48,6 +48,12 @@ func (s *Simulator) Run(ctx context.Context) error {
 	return nil
 }
 
+var (
+	userAgents  = []string{"Mozilla/5.0 (Windows NT 10.0; Win64; x64)", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)", "okhttp/4.12.0"}
+	appVersions = []string{"1.0.0", "1.1.0", "2.0.0"}
+	geoBuckets  = []string{"BR", "US", "PT", "AR"}
+)
+
 func (s *Simulator) worker(ctx context.Context, id int, wg *sync.WaitGroup, jobs <-chan struct{}) {
 	defer wg.Done()
 	pollIDs := []string{"poll1", "poll2", "poll3"}
@@ -55,13 +61,21 @@ func (s *Simulator) worker(ctx context.Context, id int, wg *sync.WaitGroup, jobs
 
 	for range jobs {
 		pollID := pollIDs[rand.Intn(len(pollIDs))]
-		userID := fmt.Sprintf("user-%d", rand.Intn(10000))
+		user := rand.Intn(10000)
+		userID := fmt.Sprintf("user-%d", user)
 
 		vote := model.Vote{
 			PollID:    pollID,
 			UserID:    userID,
 			OptionID:  fmt.Sprintf("option-%d", rand.Intn(3)+1),
 			Timestamp: time.Now(),
+			Metadata: model.VoteMetadata{
+				SourceIP:   fmt.Sprintf("10.0.%d.%d", rand.Intn(256), rand.Intn(256)),
+				DeviceID:   fmt.Sprintf("device-%d", user),
+				UserAgent:  userAgents[user%len(userAgents)],
+				AppVersion: appVersions[user%len(appVersions)],
+				GeoBucket:  geoBuckets[user%len(geoBuckets)],
+			},
 		}
 
 		publishCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
@@ -0,0 +1,1024 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+/*
+BoltStore is an embedded, single-node VoteStore kept in one bbolt file, for
+consumers that run on a single box without Redis.
+
+bbolt runs one write transaction at a time and fsyncs it on commit, so the
+dedupe check and the tally update of a vote can't interleave with another
+vote, and a crash leaves the file at the last committed vote.
+
+Layout:
+
+	polls/<poll id>/votes    user -> JSON boltVote
+	polls/<poll id>/results  option -> JSON boltTally
+	polls/<poll id>/history  bucket start (8 bytes, big endian) + option -> int64
+	polls/<poll id>/meta     "settings" -> JSON, "last_vote_at" -> unix nanos
+	polls/<poll id>/vote_ids vote ID -> what the vote first applied with it was, see appliedVoteID
+	voter_weights            user -> float64 bits
+	velocity/<key>           member -> unix nanos it was last seen
+	quarantine               vote ID -> JSON QuarantinedVote
+	reviews                  sequence (8 bytes, big endian) -> JSON ReviewRecord
+
+That's the default tenant. Every other tenant has the same layout under
+tenants/<tenant id>/, created with its first write.
+*/
+type BoltStore struct {
+	db     *bolt.DB
+	opts   options
+	tenant string
+}
+
+var (
+	bucketPolls        = []byte("polls")
+	bucketVoterWeights = []byte("voter_weights")
+	bucketTenants      = []byte("tenants")
+	bucketVelocity     = []byte("velocity")
+	bucketQuarantine   = []byte("quarantine")
+	bucketReviews      = []byte("reviews")
+	bucketLeases       = []byte("leases")
+	bucketVotes        = []byte("votes")
+	bucketResults      = []byte("results")
+	bucketHistory      = []byte("history")
+	bucketMeta         = []byte("meta")
+	bucketVoteIDs      = []byte("vote_ids")
+	settingsKey        = []byte("settings")
+	lastVoteAtKey      = []byte("last_vote_at")
+)
+
+type boltVote struct {
+	OptionIDs []string           `json:"option_ids"`
+	Weight    float64            `json:"weight"`
+	CastAt    time.Time          `json:"cast_at"`
+	Metadata  model.VoteMetadata `json:"metadata,omitzero"`
+}
+
+type boltTally struct {
+	Votes  int     `json:"votes"`
+	Weight float64 `json:"weight"`
+}
+
+type boltLease struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func NewBoltStore(path string, opts ...Option) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening bolt database: %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketPolls, bucketVoterWeights, bucketTenants, bucketVelocity, bucketQuarantine, bucketReviews, bucketLeases} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating bolt buckets: %v", err)
+	}
+
+	return &BoltStore{db: db, opts: newOptions(opts)}, nil
+}
+
+func (bs *BoltStore) ForTenant(tenantID string) VoteStore {
+	return &BoltStore{db: bs.db, opts: bs.opts, tenant: tenantID}
+}
+
+// rootBucket returns one of the tenant's top-level buckets, polls or
+// voter_weights. It's nil if the tenant has none yet and create is false
+func (bs *BoltStore) rootBucket(tx *bolt.Tx, name []byte, create bool) (*bolt.Bucket, error) {
+	if bs.tenant == "" {
+		return tx.Bucket(name), nil
+	}
+
+	tenants := tx.Bucket(bucketTenants)
+	if !create {
+		if t := tenants.Bucket([]byte(bs.tenant)); t != nil {
+			return t.Bucket(name), nil
+		}
+		return nil, nil
+	}
+
+	t, err := tenants.CreateBucketIfNotExists([]byte(bs.tenant))
+	if err != nil {
+		return nil, err
+	}
+	return t.CreateBucketIfNotExists(name)
+}
+
+// pollBucket returns the bucket of a poll, or nil if the poll doesn't exist
+// and create is false
+func (bs *BoltStore) pollBucket(tx *bolt.Tx, pollID string, create bool) (*bolt.Bucket, error) {
+	polls, err := bs.rootBucket(tx, bucketPolls, create)
+	if err != nil || polls == nil {
+		return nil, err
+	}
+	if !create {
+		return polls.Bucket([]byte(pollID)), nil
+	}
+
+	p, err := polls.CreateBucketIfNotExists([]byte(pollID))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range [][]byte{bucketVotes, bucketResults, bucketHistory, bucketMeta, bucketVoteIDs} {
+		if _, err := p.CreateBucketIfNotExists(name); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// updatePoll runs fn in a write transaction with the poll's bucket, creating it if needed
+func (bs *BoltStore) updatePoll(ctx context.Context, pollID string, fn func(p *bolt.Bucket) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		p, err := bs.pollBucket(tx, pollID, true)
+		if err != nil {
+			return err
+		}
+		return fn(p)
+	})
+}
+
+// viewPoll runs fn in a read transaction with the poll's bucket. fn isn't
+// called when the poll doesn't exist
+func (bs *BoltStore) viewPoll(ctx context.Context, pollID string, fn func(p *bolt.Bucket) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return bs.db.View(func(tx *bolt.Tx) error {
+		p, err := bs.pollBucket(tx, pollID, false)
+		if err != nil || p == nil {
+			return err
+		}
+		return fn(p)
+	})
+}
+
+func (bs *BoltStore) RegisterVote(ctx context.Context, vote model.Vote) (VoteResult, error) {
+	kind := vote.KindOrDefault()
+	cur := boltVote{OptionIDs: vote.Options(), Weight: vote.WeightOrDefault(), CastAt: vote.CastAt(), Metadata: vote.Metadata}
+	user := []byte(vote.UserID)
+
+	copyKey, err := voteCopyKey(vote)
+	if err != nil {
+		return VoteResult{}, err
+	}
+
+	var res VoteResult
+	err = bs.updatePoll(ctx, vote.PollID, func(p *bolt.Bucket) error {
+		votes := p.Bucket(bucketVotes)
+
+		var prev *boltVote
+		if b := votes.Get(user); b != nil {
+			prev = &boltVote{}
+			if err := json.Unmarshal(b, prev); err != nil {
+				return fmt.Errorf("error unmarshalling stored vote: %v", err)
+			}
+			res.PreviousOptionIDs = prev.OptionIDs
+		}
+
+		ids := p.Bucket(bucketVoteIDs)
+		if vote.VoteID != "" {
+			if first := ids.Get([]byte(vote.VoteID)); first != nil {
+				res.Outcome = replayOutcome(string(first), copyKey)
+				if res.Outcome != VoteDuplicate {
+					res.PreviousOptionIDs = nil
+				}
+				return nil
+			}
+		}
+		// keeps the vote ID once the outcome is known, it's all one transaction
+		putID := func() error {
+			if vote.VoteID == "" {
+				return nil
+			}
+			return ids.Put([]byte(vote.VoteID), []byte(appliedVoteID(res.Outcome, copyKey)))
+		}
+
+		var settings model.PollSettings
+		if b := p.Bucket(bucketMeta).Get(settingsKey); b != nil {
+			if err := json.Unmarshal(b, &settings); err != nil {
+				return fmt.Errorf("error unmarshalling poll settings: %v", err)
+			}
+		}
+		ranked := settings.ModeOrDefault() == model.PollModeRanked
+
+		deltas := make(map[string]tallyDelta)
+		tally := func(choice []string, sign int, w float64) {
+			for i, option := range choice {
+				if ranked && i > 0 {
+					break // ranked polls only tally the first preference
+				}
+				d := deltas[option]
+				d.votes += int64(sign)
+				d.weight += float64(sign) * w
+				deltas[option] = d
+			}
+		}
+
+		switch kind {
+		case model.VoteKindCast:
+			if prev != nil {
+				res.Outcome = VoteDuplicate
+				return putID()
+			}
+			res.Outcome = VoteCounted
+			tally(cur.OptionIDs, 1, cur.Weight)
+
+		case model.VoteKindRetract:
+			if prev == nil {
+				res.Outcome = VoteNotFound
+				return putID()
+			}
+			if err := votes.Delete(user); err != nil {
+				return err
+			}
+			res.Outcome = VoteRetracted
+			tally(prev.OptionIDs, -1, prev.Weight)
+
+		case model.VoteKindChange:
+			if prev == nil {
+				res.Outcome = VoteNotFound
+				return putID()
+			}
+			if slices.Equal(prev.OptionIDs, cur.OptionIDs) && prev.Weight == cur.Weight {
+				res.Outcome = VoteUnchanged
+				return putID()
+			}
+			res.Outcome = VoteChanged
+			tally(prev.OptionIDs, -1, prev.Weight)
+			tally(cur.OptionIDs, 1, cur.Weight)
+
+		default:
+			return fmt.Errorf("unknown vote kind %q", kind)
+		}
+
+		if kind != model.VoteKindRetract {
+			b, err := json.Marshal(cur)
+			if err != nil {
+				return fmt.Errorf("error marshalling vote: %v", err)
+			}
+			if err := votes.Put(user, b); err != nil {
+				return err
+			}
+		}
+
+		if err := putID(); err != nil {
+			return err
+		}
+		return bs.applyDeltas(p, cur.CastAt, vote.ReceivedAtOrNow(), deltas)
+	})
+	if err != nil {
+		return VoteResult{}, fmt.Errorf("error registering vote in bolt: %v", err)
+	}
+
+	return res, nil
+}
+
+// applyDeltas moves the results and history of a vote and bumps the poll's
+// last vote time to when the vote was received
+func (bs *BoltStore) applyDeltas(p *bolt.Bucket, castAt, receivedAt time.Time, deltas map[string]tallyDelta) error {
+	results := p.Bucket(bucketResults)
+	for option, d := range deltas {
+		var t boltTally
+		if b := results.Get([]byte(option)); b != nil {
+			if err := json.Unmarshal(b, &t); err != nil {
+				return fmt.Errorf("error unmarshalling tally: %v", err)
+			}
+		}
+		t.Votes += int(d.votes)
+		t.Weight += d.weight
+
+		b, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Errorf("error marshalling tally: %v", err)
+		}
+		if err := results.Put([]byte(option), b); err != nil {
+			return err
+		}
+	}
+
+	history := p.Bucket(bucketHistory)
+	if start, ok := bs.opts.historyBucket(castAt); ok {
+		for option, d := range deltas {
+			key := historyKey(start, option)
+			var count int64
+			if b := history.Get(key); b != nil {
+				count = int64(binary.BigEndian.Uint64(b))
+			}
+			if err := history.Put(key, binary.BigEndian.AppendUint64(nil, uint64(count+d.votes))); err != nil {
+				return err
+			}
+		}
+	}
+
+	// keys sort by bucket start, so everything past retention is at the front.
+	// Deleting through the cursor while iterating skips keys, so collect them first
+	cutoff := historyKey(bs.opts.historyCutoff(), "")
+	var expired [][]byte
+	c := history.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.Next() {
+		expired = append(expired, bytes.Clone(k))
+	}
+	for _, k := range expired {
+		if err := history.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	meta := p.Bucket(bucketMeta)
+	last := int64(0)
+	if b := meta.Get(lastVoteAtKey); b != nil {
+		last = int64(binary.BigEndian.Uint64(b))
+	}
+	if receivedAt.UnixNano() > last {
+		return meta.Put(lastVoteAtKey, binary.BigEndian.AppendUint64(nil, uint64(receivedAt.UnixNano())))
+	}
+	return nil
+}
+
+func historyKey(start time.Time, option string) []byte {
+	return append(binary.BigEndian.AppendUint64(nil, uint64(start.Unix())), option...)
+}
+
+func (bs *BoltStore) readTally(ctx context.Context, pollID string, fn func(option string, t boltTally)) error {
+	return bs.viewPoll(ctx, pollID, func(p *bolt.Bucket) error {
+		return p.Bucket(bucketResults).ForEach(func(k, v []byte) error {
+			var t boltTally
+			if err := json.Unmarshal(v, &t); err != nil {
+				return fmt.Errorf("error unmarshalling tally: %v", err)
+			}
+			fn(string(k), t)
+			return nil
+		})
+	})
+}
+
+func (bs *BoltStore) GetResults(ctx context.Context, pollID string) (map[string]int, error) {
+	result := make(map[string]int)
+	err := bs.readTally(ctx, pollID, func(option string, t boltTally) {
+		if t.Votes != 0 {
+			result[option] = t.Votes
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting results from bolt: %v", err)
+	}
+	return result, nil
+}
+
+func (bs *BoltStore) GetWeightedResults(ctx context.Context, pollID string) (map[string]float64, error) {
+	result := make(map[string]float64)
+	err := bs.readTally(ctx, pollID, func(option string, t boltTally) {
+		if t.Weight != 0 {
+			result[option] = t.Weight
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting weighted results from bolt: %v", err)
+	}
+	return result, nil
+}
+
+func lastVoteAt(p *bolt.Bucket) (time.Time, bool) {
+	b := p.Bucket(bucketMeta).Get(lastVoteAtKey)
+	if b == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b))).UTC(), true
+}
+
+func (bs *BoltStore) ListPolls(ctx context.Context, activeSince time.Time) ([]PollInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var polls []PollInfo
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		root, err := bs.rootBucket(tx, bucketPolls, false)
+		if err != nil || root == nil {
+			return err
+		}
+		return root.ForEachBucket(func(k []byte) error {
+			at, ok := lastVoteAt(root.Bucket(k))
+			if ok && !at.Before(activeSince) {
+				polls = append(polls, PollInfo{PollID: string(k), LastVoteAt: at})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing polls from bolt: %v", err)
+	}
+
+	sort.Slice(polls, func(i, j int) bool { return polls[i].LastVoteAt.After(polls[j].LastVoteAt) })
+	return polls, nil
+}
+
+func (bs *BoltStore) GetPoll(ctx context.Context, pollID string) (PollInfo, bool, error) {
+	var info PollInfo
+	var ok bool
+	err := bs.viewPoll(ctx, pollID, func(p *bolt.Bucket) error {
+		info.LastVoteAt, ok = lastVoteAt(p)
+		return nil
+	})
+	if err != nil {
+		return PollInfo{}, false, fmt.Errorf("error getting poll from bolt: %v", err)
+	}
+	if !ok {
+		return PollInfo{}, false, nil
+	}
+	info.PollID = pollID
+	return info, true, nil
+}
+
+func (bs *BoltStore) CountVoters(ctx context.Context, pollID string) (int, error) {
+	var n int
+	err := bs.viewPoll(ctx, pollID, func(p *bolt.Bucket) error {
+		n = p.Bucket(bucketVotes).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error counting voters in bolt: %v", err)
+	}
+	return n, nil
+}
+
+func (bs *BoltStore) CountVotersIn(ctx context.Context, pollIDs []string) (map[string]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(pollIDs))
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		for _, pollID := range pollIDs {
+			counts[pollID] = 0
+			p, err := bs.pollBucket(tx, pollID, false)
+			if err != nil {
+				return err
+			}
+			if p != nil {
+				counts[pollID] = p.Bucket(bucketVotes).Stats().KeyN
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error counting voters in bolt: %v", err)
+	}
+	return counts, nil
+}
+
+func (bs *BoltStore) GetHistory(ctx context.Context, pollID string, from, to time.Time) ([]model.HistoryBucket, error) {
+	if cutoff := bs.opts.historyCutoff(); from.Before(cutoff) {
+		from = cutoff
+	}
+
+	var history []model.HistoryBucket
+	err := bs.viewPoll(ctx, pollID, func(p *bolt.Bucket) error {
+		c := p.Bucket(bucketHistory).Cursor()
+		for k, v := c.Seek(historyKey(from, "")); k != nil; k, v = c.Next() {
+			start := time.Unix(int64(binary.BigEndian.Uint64(k[:8])), 0).UTC()
+			if start.After(to) {
+				break
+			}
+			if n := len(history); n == 0 || !history[n-1].Start.Equal(start) {
+				history = append(history, model.HistoryBucket{Start: start, Counts: make(map[string]int)})
+			}
+			history[len(history)-1].Counts[string(k[8:])] = int(int64(binary.BigEndian.Uint64(v)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting history from bolt: %v", err)
+	}
+	return history, nil
+}
+
+func (bs *BoltStore) GetBallots(ctx context.Context, pollID string) ([][]string, error) {
+	var ballots [][]string
+	err := bs.viewPoll(ctx, pollID, func(p *bolt.Bucket) error {
+		return p.Bucket(bucketVotes).ForEach(func(_, v []byte) error {
+			var bv boltVote
+			if err := json.Unmarshal(v, &bv); err != nil {
+				return fmt.Errorf("error unmarshalling stored vote: %v", err)
+			}
+			ballots = append(ballots, bv.OptionIDs)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting ballots from bolt: %v", err)
+	}
+	return ballots, nil
+}
+
+func (bs *BoltStore) GetVote(ctx context.Context, pollID, userID string) (StoredVote, bool, error) {
+	var bv *boltVote
+	err := bs.viewPoll(ctx, pollID, func(p *bolt.Bucket) error {
+		b := p.Bucket(bucketVotes).Get([]byte(userID))
+		if b == nil {
+			return nil
+		}
+		bv = &boltVote{}
+		return json.Unmarshal(b, bv)
+	})
+	if err != nil {
+		return StoredVote{}, false, fmt.Errorf("error getting vote from bolt: %v", err)
+	}
+	if bv == nil {
+		return StoredVote{}, false, nil
+	}
+	return StoredVote{UserID: userID, OptionIDs: bv.OptionIDs, Weight: bv.Weight, CastAt: bv.CastAt.UTC(), Metadata: bv.Metadata}, true, nil
+}
+
+func (bs *BoltStore) ListVotes(ctx context.Context, pollID string) ([]StoredVote, error) {
+	var votes []StoredVote
+	err := bs.viewPoll(ctx, pollID, func(p *bolt.Bucket) error {
+		return p.Bucket(bucketVotes).ForEach(func(k, v []byte) error {
+			var bv boltVote
+			if err := json.Unmarshal(v, &bv); err != nil {
+				return fmt.Errorf("error unmarshalling stored vote: %v", err)
+			}
+			votes = append(votes, StoredVote{UserID: string(k), OptionIDs: bv.OptionIDs, Weight: bv.Weight, CastAt: bv.CastAt.UTC(), Metadata: bv.Metadata})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing votes from bolt: %v", err)
+	}
+	return votes, nil
+}
+
+// DeletePoll empties the poll's votes, results and history buckets and drops
+// its last vote time, which is what puts it in the poll index
+func (bs *BoltStore) DeletePoll(ctx context.Context, pollID string, readLastVoteAt time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		p, err := bs.pollBucket(tx, pollID, false)
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			return ErrPollChanged
+		}
+		if at, ok := lastVoteAt(p); !ok || !at.Equal(readLastVoteAt) {
+			return ErrPollChanged
+		}
+
+		for _, name := range [][]byte{bucketVotes, bucketResults, bucketHistory, bucketVoteIDs} {
+			n += p.Bucket(name).Stats().KeyN
+			if err := p.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := p.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+
+		n++ // the last vote time
+		return p.Bucket(bucketMeta).Delete(lastVoteAtKey)
+	})
+	if errors.Is(err, ErrPollChanged) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error deleting poll from bolt: %v", err)
+	}
+	return n, nil
+}
+
+func (bs *BoltStore) CheckTally(ctx context.Context, pollID string, repair bool) (TallyCheck, error) {
+	if err := ctx.Err(); err != nil {
+		return TallyCheck{}, err
+	}
+
+	check := newTallyCheck()
+	fn := func(tx *bolt.Tx) error {
+		p, err := bs.pollBucket(tx, pollID, false)
+		if err != nil || p == nil {
+			return err
+		}
+
+		var settings model.PollSettings
+		if b := p.Bucket(bucketMeta).Get(settingsKey); b != nil {
+			if err := json.Unmarshal(b, &settings); err != nil {
+				return fmt.Errorf("error unmarshalling poll settings: %v", err)
+			}
+		}
+		ranked := settings.ModeOrDefault() == model.PollModeRanked
+
+		err = p.Bucket(bucketVotes).ForEach(func(_, v []byte) error {
+			var bv boltVote
+			if err := json.Unmarshal(v, &bv); err != nil {
+				return fmt.Errorf("error unmarshalling stored vote: %v", err)
+			}
+			check.Ballots++
+			for i, option := range bv.OptionIDs {
+				if ranked && i > 0 {
+					break
+				}
+				check.Recount[option]++
+				check.RecountWeight[option] += bv.Weight
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// the votes bucket is both the voter set and the choices
+		check.Voters = check.Ballots
+
+		results := p.Bucket(bucketResults)
+		err = results.ForEach(func(k, v []byte) error {
+			var t boltTally
+			if err := json.Unmarshal(v, &t); err != nil {
+				return fmt.Errorf("error unmarshalling tally: %v", err)
+			}
+			if t.Votes != 0 {
+				check.Stored[string(k)] = t.Votes
+			}
+			if t.Weight != 0 {
+				check.StoredWeight[string(k)] = t.Weight
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		dropZeroWeights(check.RecountWeight)
+
+		if !repair || check.Matches() {
+			return nil
+		}
+
+		if err := p.DeleteBucket(bucketResults); err != nil {
+			return err
+		}
+		results, err = p.CreateBucket(bucketResults)
+		if err != nil {
+			return err
+		}
+		for option, n := range check.Recount {
+			b, err := json.Marshal(boltTally{Votes: n, Weight: check.RecountWeight[option]})
+			if err != nil {
+				return fmt.Errorf("error marshalling tally: %v", err)
+			}
+			if err := results.Put([]byte(option), b); err != nil {
+				return err
+			}
+		}
+		check.Repaired = true
+		return nil
+	}
+
+	var err error
+	if repair {
+		err = bs.db.Update(fn)
+	} else {
+		err = bs.db.View(fn)
+	}
+	if err != nil {
+		return TallyCheck{}, fmt.Errorf("error checking tally in bolt: %v", err)
+	}
+	return check, nil
+}
+
+func (bs *BoltStore) GetPollSettings(ctx context.Context, pollID string) (model.PollSettings, error) {
+	var settings model.PollSettings
+	err := bs.viewPoll(ctx, pollID, func(p *bolt.Bucket) error {
+		if b := p.Bucket(bucketMeta).Get(settingsKey); b != nil {
+			return json.Unmarshal(b, &settings)
+		}
+		return nil
+	})
+	if err != nil {
+		return settings, fmt.Errorf("error getting poll settings from bolt: %v", err)
+	}
+	return settings, nil
+}
+
+func (bs *BoltStore) HasPollSettings(ctx context.Context, pollID string) (bool, error) {
+	var ok bool
+	err := bs.viewPoll(ctx, pollID, func(p *bolt.Bucket) error {
+		ok = p.Bucket(bucketMeta).Get(settingsKey) != nil
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("error checking poll settings in bolt: %v", err)
+	}
+	return ok, nil
+}
+
+func (bs *BoltStore) SavePollSettings(ctx context.Context, pollID string, settings model.PollSettings) error {
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("error marshalling poll settings: %v", err)
+	}
+
+	err = bs.updatePoll(ctx, pollID, func(p *bolt.Bucket) error {
+		return p.Bucket(bucketMeta).Put(settingsKey, b)
+	})
+	if err != nil {
+		return fmt.Errorf("error saving poll settings to bolt: %v", err)
+	}
+	return nil
+}
+
+func (bs *BoltStore) GetVoterWeight(ctx context.Context, userID string) (float64, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, false, err
+	}
+
+	var w float64
+	var ok bool
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		weights, err := bs.rootBucket(tx, bucketVoterWeights, false)
+		if err != nil || weights == nil {
+			return err
+		}
+		if b := weights.Get([]byte(userID)); b != nil {
+			w, ok = math.Float64frombits(binary.BigEndian.Uint64(b)), true
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("error getting voter weight from bolt: %v", err)
+	}
+	return w, ok, nil
+}
+
+func (bs *BoltStore) SetVoterWeight(ctx context.Context, userID string, weight float64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		weights, err := bs.rootBucket(tx, bucketVoterWeights, true)
+		if err != nil {
+			return err
+		}
+		return weights.Put([]byte(userID), binary.BigEndian.AppendUint64(nil, math.Float64bits(weight)))
+	})
+	if err != nil {
+		return fmt.Errorf("error saving voter weight to bolt: %v", err)
+	}
+	return nil
+}
+
+func (bs *BoltStore) RecordVelocity(ctx context.Context, key, member string, at time.Time, window time.Duration) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var n int
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		velocity, err := bs.rootBucket(tx, bucketVelocity, true)
+		if err != nil {
+			return err
+		}
+		b, err := velocity.CreateBucketIfNotExists([]byte(key))
+		if err != nil {
+			return err
+		}
+
+		if prev := b.Get([]byte(member)); prev == nil || int64(binary.BigEndian.Uint64(prev)) < at.UnixNano() {
+			if err := b.Put([]byte(member), binary.BigEndian.AppendUint64(nil, uint64(at.UnixNano()))); err != nil {
+				return err
+			}
+		}
+
+		cutoff := at.Add(-window).UnixNano()
+		var expired [][]byte
+		err = b.ForEach(func(m, v []byte) error {
+			seen := int64(binary.BigEndian.Uint64(v))
+			switch {
+			case seen <= cutoff:
+				expired = append(expired, m)
+			case seen <= at.UnixNano():
+				n++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, m := range expired {
+			if err := b.Delete(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error recording velocity in bolt: %v", err)
+	}
+	return n, nil
+}
+
+func (bs *BoltStore) QuarantineVote(ctx context.Context, q QuarantinedVote) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(q)
+	if err != nil {
+		return fmt.Errorf("error marshalling quarantined vote: %v", err)
+	}
+	err = bs.db.Update(func(tx *bolt.Tx) error {
+		quarantine, err := bs.rootBucket(tx, bucketQuarantine, true)
+		if err != nil {
+			return err
+		}
+		return quarantine.Put([]byte(q.ID), b)
+	})
+	if err != nil {
+		return fmt.Errorf("error quarantining vote in bolt: %v", err)
+	}
+	return nil
+}
+
+func (bs *BoltStore) ListQuarantined(ctx context.Context, pollID string) ([]QuarantinedVote, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	held := []QuarantinedVote{}
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		quarantine, err := bs.rootBucket(tx, bucketQuarantine, false)
+		if err != nil || quarantine == nil {
+			return err
+		}
+		return quarantine.ForEach(func(_, v []byte) error {
+			var q QuarantinedVote
+			if err := json.Unmarshal(v, &q); err != nil {
+				return err
+			}
+			if pollID == "" || q.Vote.PollID == pollID {
+				held = append(held, q)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing quarantined votes from bolt: %v", err)
+	}
+	slices.SortFunc(held, func(a, b QuarantinedVote) int { return a.QuarantinedAt.Compare(b.QuarantinedAt) })
+	return held, nil
+}
+
+func (bs *BoltStore) GetQuarantined(ctx context.Context, id string) (QuarantinedVote, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return QuarantinedVote{}, false, err
+	}
+
+	var q QuarantinedVote
+	var ok bool
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		quarantine, err := bs.rootBucket(tx, bucketQuarantine, false)
+		if err != nil || quarantine == nil {
+			return err
+		}
+		b := quarantine.Get([]byte(id))
+		if b == nil {
+			return nil
+		}
+		ok = true
+		return json.Unmarshal(b, &q)
+	})
+	if err != nil {
+		return QuarantinedVote{}, false, fmt.Errorf("error getting quarantined vote from bolt: %v", err)
+	}
+	return q, ok, nil
+}
+
+func (bs *BoltStore) ResolveQuarantined(ctx context.Context, rec ReviewRecord) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return false, fmt.Errorf("error marshalling review record: %v", err)
+	}
+	var ok bool
+	err = bs.db.Update(func(tx *bolt.Tx) error {
+		quarantine, err := bs.rootBucket(tx, bucketQuarantine, false)
+		if err != nil || quarantine == nil || quarantine.Get([]byte(rec.VoteID)) == nil {
+			return err
+		}
+		if err := quarantine.Delete([]byte(rec.VoteID)); err != nil {
+			return err
+		}
+
+		reviews, err := bs.rootBucket(tx, bucketReviews, true)
+		if err != nil {
+			return err
+		}
+		seq, err := reviews.NextSequence()
+		if err != nil {
+			return err
+		}
+		ok = true
+		return reviews.Put(binary.BigEndian.AppendUint64(nil, seq), b)
+	})
+	if err != nil {
+		return false, fmt.Errorf("error resolving quarantined vote in bolt: %v", err)
+	}
+	return ok, nil
+}
+
+func (bs *BoltStore) ListReviews(ctx context.Context, pollID string) ([]ReviewRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	records := []ReviewRecord{}
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		reviews, err := bs.rootBucket(tx, bucketReviews, false)
+		if err != nil || reviews == nil {
+			return err
+		}
+		return reviews.ForEach(func(_, v []byte) error {
+			var rec ReviewRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			if pollID == "" || rec.PollID == pollID {
+				records = append(records, rec)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing review records from bolt: %v", err)
+	}
+	return records, nil
+}
+
+func (bs *BoltStore) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	acquired := false
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		leases := tx.Bucket(bucketLeases)
+		now := time.Now()
+		if b := leases.Get([]byte(name)); b != nil {
+			var l boltLease
+			if err := json.Unmarshal(b, &l); err != nil {
+				return fmt.Errorf("error unmarshalling lease: %v", err)
+			}
+			if l.Holder != holder && now.Before(l.ExpiresAt) {
+				return nil
+			}
+		}
+
+		b, err := json.Marshal(boltLease{Holder: holder, ExpiresAt: now.Add(ttl)})
+		if err != nil {
+			return fmt.Errorf("error marshalling lease: %v", err)
+		}
+		acquired = true
+		return leases.Put([]byte(name), b)
+	})
+	if err != nil {
+		return false, fmt.Errorf("error acquiring lease in bolt: %v", err)
+	}
+	return acquired, nil
+}
+
+func (bs *BoltStore) Close() error {
+	if err := bs.db.Close(); err != nil {
+		return fmt.Errorf("error closing bolt database: %v", err)
+	}
+	return nil
+}
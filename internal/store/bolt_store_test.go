@@ -0,0 +1,19 @@
+package store_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store/storetest"
+)
+
+func TestBoltStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.VoteStore {
+		s, err := store.NewBoltStore(filepath.Join(t.TempDir(), "votes.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
@@ -0,0 +1,59 @@
+-- polls holds the per-poll settings and the poll index. A poll created by
+-- saving its settings has no last_vote_at until its first vote
+CREATE TABLE polls (
+    poll_id      TEXT PRIMARY KEY,
+    settings     JSONB NOT NULL DEFAULT '{}',
+    last_vote_at TIMESTAMPTZ
+);
+
+CREATE INDEX polls_last_vote_at_idx ON polls (last_vote_at DESC);
+
+-- votes is each user's current vote. The primary key is the dedupe: a user
+-- has at most one vote per poll
+CREATE TABLE votes (
+    poll_id    TEXT NOT NULL,
+    user_id    TEXT NOT NULL,
+    option_ids TEXT[] NOT NULL,
+    weight     DOUBLE PRECISION NOT NULL DEFAULT 1,
+    cast_at    TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (poll_id, user_id)
+);
+
+-- vote_events is the append-only audit trail of every vote the store saw,
+-- including the ones it refused
+CREATE TABLE vote_events (
+    id          BIGSERIAL PRIMARY KEY,
+    poll_id     TEXT NOT NULL,
+    user_id     TEXT NOT NULL,
+    kind        TEXT NOT NULL,
+    option_ids  TEXT[] NOT NULL,
+    weight      DOUBLE PRECISION NOT NULL,
+    cast_at     TIMESTAMPTZ NOT NULL,
+    outcome     TEXT NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX vote_events_poll_user_idx ON vote_events (poll_id, user_id);
+
+-- results is the tally, kept in the same transaction as votes
+CREATE TABLE results (
+    poll_id   TEXT NOT NULL,
+    option_id TEXT NOT NULL,
+    votes     BIGINT NOT NULL DEFAULT 0,
+    weight    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    PRIMARY KEY (poll_id, option_id)
+);
+
+CREATE TABLE history (
+    poll_id      TEXT NOT NULL,
+    bucket_start TIMESTAMPTZ NOT NULL,
+    option_id    TEXT NOT NULL,
+    votes        BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (poll_id, bucket_start, option_id)
+);
+
+CREATE TABLE voter_weights (
+    user_id TEXT PRIMARY KEY,
+    weight  DOUBLE PRECISION NOT NULL
+);
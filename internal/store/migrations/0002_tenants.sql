@@ -0,0 +1,22 @@
+-- tenant_id scopes every row to a tenant. The default tenant is '', so the
+-- rows from before tenants existed stay where they were
+ALTER TABLE polls ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE polls DROP CONSTRAINT polls_pkey, ADD PRIMARY KEY (tenant_id, poll_id);
+DROP INDEX polls_last_vote_at_idx;
+CREATE INDEX polls_last_vote_at_idx ON polls (tenant_id, last_vote_at DESC);
+
+ALTER TABLE votes ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE votes DROP CONSTRAINT votes_pkey, ADD PRIMARY KEY (tenant_id, poll_id, user_id);
+
+ALTER TABLE vote_events ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+DROP INDEX vote_events_poll_user_idx;
+CREATE INDEX vote_events_poll_user_idx ON vote_events (tenant_id, poll_id, user_id);
+
+ALTER TABLE results ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE results DROP CONSTRAINT results_pkey, ADD PRIMARY KEY (tenant_id, poll_id, option_id);
+
+ALTER TABLE history ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE history DROP CONSTRAINT history_pkey, ADD PRIMARY KEY (tenant_id, poll_id, bucket_start, option_id);
+
+ALTER TABLE voter_weights ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE voter_weights DROP CONSTRAINT voter_weights_pkey, ADD PRIMARY KEY (tenant_id, user_id);
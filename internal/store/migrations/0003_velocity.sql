@@ -0,0 +1,9 @@
+-- velocity holds the sliding-window counters of the fraud detector: the last
+-- time each member (a poll/user pair, a poll...) was seen under a key
+CREATE TABLE velocity (
+    tenant_id TEXT NOT NULL DEFAULT '',
+    key       TEXT NOT NULL,
+    member    TEXT NOT NULL,
+    seen_at   TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (tenant_id, key, member)
+);
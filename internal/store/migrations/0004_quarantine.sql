@@ -0,0 +1,20 @@
+-- quarantine holds the flagged votes waiting for review, out of the tally
+CREATE TABLE quarantine (
+    tenant_id      TEXT NOT NULL DEFAULT '',
+    id             TEXT NOT NULL,
+    poll_id        TEXT NOT NULL,
+    vote           JSONB NOT NULL,
+    quarantined_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (tenant_id, id)
+);
+
+-- reviews is the append-only audit trail of the decisions on quarantined votes
+CREATE TABLE reviews (
+    id         BIGSERIAL PRIMARY KEY,
+    tenant_id  TEXT NOT NULL DEFAULT '',
+    poll_id    TEXT NOT NULL,
+    record     JSONB NOT NULL,
+    decided_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX reviews_tenant_poll_idx ON reviews (tenant_id, poll_id);
@@ -0,0 +1,3 @@
+-- metadata is where the vote came from, as ingestion set it
+ALTER TABLE votes ADD COLUMN metadata JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE vote_events ADD COLUMN metadata JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,13 @@
+-- applied_votes holds the vote IDs each poll already applied, so the copies a
+-- producer retry writes are recognized. copy_key is what the ID was first
+-- applied to, see appliedVoteID, so a vote reusing it for another user or
+-- selection isn't taken for a copy. They go with the poll's other rows
+CREATE TABLE applied_votes (
+    tenant_id TEXT NOT NULL DEFAULT '',
+    poll_id   TEXT NOT NULL,
+    vote_id   TEXT NOT NULL,
+    copy_key  TEXT NOT NULL,
+    PRIMARY KEY (tenant_id, poll_id, vote_id)
+);
+
+ALTER TABLE vote_events ADD COLUMN vote_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+-- leases are held by the one consumer that runs a job meant to run once, like
+-- the reconciler, until expires_at unless it renews them
+CREATE TABLE leases (
+    name       TEXT PRIMARY KEY,
+    holder     TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
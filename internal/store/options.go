@@ -0,0 +1,56 @@
+package store
+
+import "time"
+
+// options are the settings shared by every VoteStore implementation
+type options struct {
+	// history buckets are bucketSize wide and kept for historyRetention
+	bucketSize       time.Duration
+	historyRetention time.Duration
+	// rename legacy Redis poll keys on open, see migrateHashTags
+	migrateHashTags bool
+}
+
+type Option func(*options)
+
+// WithHistory sets the width of the history buckets and how long they're kept.
+// The defaults are one minute buckets kept for a day
+func WithHistory(bucketSize, retention time.Duration) Option {
+	return func(o *options) {
+		o.bucketSize = bucketSize
+		o.historyRetention = retention
+	}
+}
+
+// WithHashTagMigration makes a Redis store on a single node or a Sentinel
+// group rename the keys of polls written before hash tags when it opens. It
+// SCANs the whole keyspace, so it's for one process to run once, not for
+// every consumer on every start
+func WithHashTagMigration() Option {
+	return func(o *options) {
+		o.migrateHashTags = true
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		bucketSize:       time.Minute,
+		historyRetention: 24 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// historyBucket returns the start of the history bucket a vote cast at castAt
+// falls in, and false when that bucket is already past the retention window
+func (o options) historyBucket(castAt time.Time) (time.Time, bool) {
+	start := castAt.Truncate(o.bucketSize)
+	return start, !start.Before(o.historyCutoff())
+}
+
+// historyCutoff is the start of the oldest history bucket still kept
+func (o options) historyCutoff() time.Time {
+	return time.Now().Add(-o.historyRetention).Truncate(o.bucketSize)
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the advisory lock taken while migrating, so consumers
+// starting at the same time don't run the same migration twice
+const migrationLockID = 7_340_551
+
+/*
+migrate applies the SQL files in migrations/ that the database hasn't seen yet,
+in order of the number that prefixes their name (0001_init.sql, 0002_...).
+Each file runs in its own transaction together with its row in
+schema_migrations, so a failed migration leaves nothing half applied.
+*/
+func migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("error acquiring connection for migrations: %v", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("error taking migration lock: %v", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %v", err)
+	}
+
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return fmt.Errorf("error listing migrations: %v", err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		base := strings.TrimPrefix(name, "migrations/")
+		version, err := strconv.Atoi(strings.SplitN(base, "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("migration %s has no version prefix: %v", base, err)
+		}
+
+		var applied bool
+		err = conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", version).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("error checking migration %s: %v", base, err)
+		}
+		if applied {
+			continue
+		}
+
+		sql, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("error reading migration %s: %v", base, err)
+		}
+
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, string(sql)); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("error applying migration %s: %v", base, err)
+		}
+		log.Printf("Applied postgres migration %s", base)
+	}
+
+	return nil
+}
@@ -0,0 +1,799 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+/*
+PostgresStore keeps votes in PostgreSQL, for deployments that need durable,
+queryable vote records. The schema lives in migrations/ and is applied when
+the store is created.
+
+Each vote is applied in a single transaction: the (poll_id, user_id) primary
+key of the votes table does the dedupe, and the results, history and poll
+index rows move together with it. Rows are always locked in the same order
+(vote, results by option, history by option, poll) so concurrent votes wait
+on each other instead of deadlocking.
+
+Every row carries the tenant it belongs to, and a store only reads and writes
+the rows of its own tenant; the default tenant is the empty ID.
+*/
+type PostgresStore struct {
+	pool   *pgxpool.Pool
+	opts   options
+	tenant string
+	prune  *pruneState
+}
+
+// pruneState is shared by every tenant scope of a store: old history rows
+// are pruned, for all tenants at once, at most once per bucket
+type pruneState struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+func NewPostgresStore(ctx context.Context, dsn string, opts ...Option) (*PostgresStore, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing postgres DSN: %v", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("error connecting to postgres: %v", err)
+	}
+
+	if err := migrate(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return &PostgresStore{pool: pool, opts: newOptions(opts), prune: &pruneState{}}, nil
+}
+
+func (ps *PostgresStore) ForTenant(tenantID string) VoteStore {
+	return &PostgresStore{pool: ps.pool, opts: ps.opts, tenant: tenantID, prune: ps.prune}
+}
+
+// tallyDelta is how much an option's count and weight sum move with a vote
+type tallyDelta struct {
+	votes  int64
+	weight float64
+}
+
+func (ps *PostgresStore) RegisterVote(ctx context.Context, vote model.Vote) (VoteResult, error) {
+	kind := vote.KindOrDefault()
+	options := vote.Options()
+	if options == nil {
+		options = []string{} // the column is NOT NULL
+	}
+	weight := vote.WeightOrDefault()
+	castAt := vote.CastAt()
+	copyKey, err := voteCopyKey(vote)
+	if err != nil {
+		return VoteResult{}, err
+	}
+
+	var res VoteResult
+	err = pgx.BeginFunc(ctx, ps.pool, func(tx pgx.Tx) error {
+		var mode string
+		err := tx.QueryRow(ctx, "SELECT settings->>'mode' FROM polls WHERE poll_id = $1 AND tenant_id = $2",
+			vote.PollID, ps.tenant).Scan(&mode)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("error getting poll mode: %v", err)
+		}
+
+		deltas := make(map[string]tallyDelta)
+		tally := func(choice []string, sign int64, w float64) {
+			for i, option := range choice {
+				if mode == string(model.PollModeRanked) && i > 0 {
+					break // ranked polls only tally the first preference
+				}
+				d := deltas[option]
+				d.votes += sign
+				d.weight += float64(sign) * w
+				deltas[option] = d
+			}
+		}
+
+		recordEvent := func() error {
+			_, err := tx.Exec(ctx, `INSERT INTO vote_events (poll_id, user_id, kind, option_ids, weight, cast_at, outcome, tenant_id, metadata, vote_id)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+				vote.PollID, vote.UserID, string(kind), options, weight, castAt, string(res.Outcome), ps.tenant, vote.Metadata, vote.VoteID)
+			if err != nil {
+				return fmt.Errorf("error recording vote event: %v", err)
+			}
+			return nil
+		}
+
+		if vote.VoteID != "" {
+			tag, err := tx.Exec(ctx, `INSERT INTO applied_votes (tenant_id, poll_id, vote_id, copy_key) VALUES ($1, $2, $3, $4)
+				ON CONFLICT (tenant_id, poll_id, vote_id) DO NOTHING`, ps.tenant, vote.PollID, vote.VoteID, copyKey)
+			if err != nil {
+				return fmt.Errorf("error recording vote ID: %v", err)
+			}
+			if tag.RowsAffected() == 0 {
+				var first string
+				err := tx.QueryRow(ctx, "SELECT copy_key FROM applied_votes WHERE tenant_id = $1 AND poll_id = $2 AND vote_id = $3",
+					ps.tenant, vote.PollID, vote.VoteID).Scan(&first)
+				if err != nil {
+					return fmt.Errorf("error getting vote ID: %v", err)
+				}
+				res.Outcome = replayOutcome(first, copyKey)
+				if res.Outcome == VoteDuplicate {
+					err := tx.QueryRow(ctx, "SELECT option_ids FROM votes WHERE poll_id = $1 AND user_id = $2 AND tenant_id = $3",
+						vote.PollID, vote.UserID, ps.tenant).Scan(&res.PreviousOptionIDs)
+					if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+						return fmt.Errorf("error getting previous vote: %v", err)
+					}
+				}
+				return recordEvent()
+			}
+		}
+
+		var prev []string
+		var prevWeight float64
+		switch kind {
+		case model.VoteKindCast:
+			tag, err := tx.Exec(ctx, `INSERT INTO votes (poll_id, user_id, option_ids, weight, cast_at, tenant_id, metadata)
+				VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (tenant_id, poll_id, user_id) DO NOTHING`,
+				vote.PollID, vote.UserID, options, weight, castAt, ps.tenant, vote.Metadata)
+			if err != nil {
+				return fmt.Errorf("error inserting vote: %v", err)
+			}
+			if tag.RowsAffected() == 0 {
+				res.Outcome = VoteDuplicate
+				err := tx.QueryRow(ctx, "SELECT option_ids FROM votes WHERE poll_id = $1 AND user_id = $2 AND tenant_id = $3",
+					vote.PollID, vote.UserID, ps.tenant).Scan(&res.PreviousOptionIDs)
+				if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+					return fmt.Errorf("error getting previous vote: %v", err)
+				}
+				break
+			}
+			res.Outcome = VoteCounted
+			tally(options, 1, weight)
+
+		case model.VoteKindRetract:
+			err := tx.QueryRow(ctx, `DELETE FROM votes WHERE poll_id = $1 AND user_id = $2 AND tenant_id = $3
+				RETURNING option_ids, weight`, vote.PollID, vote.UserID, ps.tenant).Scan(&prev, &prevWeight)
+			if errors.Is(err, pgx.ErrNoRows) {
+				res.Outcome = VoteNotFound
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("error deleting vote: %v", err)
+			}
+			res = VoteResult{Outcome: VoteRetracted, PreviousOptionIDs: prev}
+			tally(prev, -1, prevWeight)
+
+		case model.VoteKindChange:
+			err := tx.QueryRow(ctx, `SELECT option_ids, weight FROM votes
+				WHERE poll_id = $1 AND user_id = $2 AND tenant_id = $3 FOR UPDATE`, vote.PollID, vote.UserID, ps.tenant).Scan(&prev, &prevWeight)
+			if errors.Is(err, pgx.ErrNoRows) {
+				res.Outcome = VoteNotFound
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("error getting previous vote: %v", err)
+			}
+			res.PreviousOptionIDs = prev
+			if slices.Equal(prev, options) && prevWeight == weight {
+				res.Outcome = VoteUnchanged
+				break
+			}
+
+			_, err = tx.Exec(ctx, `UPDATE votes SET option_ids = $3, weight = $4, cast_at = $5, metadata = $7, updated_at = now()
+				WHERE poll_id = $1 AND user_id = $2 AND tenant_id = $6`, vote.PollID, vote.UserID, options, weight, castAt, ps.tenant, vote.Metadata)
+			if err != nil {
+				return fmt.Errorf("error updating vote: %v", err)
+			}
+			res.Outcome = VoteChanged
+			tally(prev, -1, prevWeight)
+			tally(options, 1, weight)
+
+		default:
+			return fmt.Errorf("unknown vote kind %q", kind)
+		}
+
+		if vote.VoteID != "" && (res.Outcome == VoteDuplicate || res.Outcome == VoteNotFound) {
+			_, err := tx.Exec(ctx, "UPDATE applied_votes SET copy_key = $4 WHERE tenant_id = $1 AND poll_id = $2 AND vote_id = $3",
+				ps.tenant, vote.PollID, vote.VoteID, appliedVoteID(res.Outcome, copyKey))
+			if err != nil {
+				return fmt.Errorf("error recording vote ID: %v", err)
+			}
+		}
+
+		if err := recordEvent(); err != nil {
+			return err
+		}
+
+		if res.Outcome != VoteCounted && res.Outcome != VoteChanged && res.Outcome != VoteRetracted {
+			return nil // the tally didn't move
+		}
+		return ps.applyDeltas(ctx, tx, vote.PollID, castAt, vote.ReceivedAtOrNow(), deltas)
+	})
+	if err != nil {
+		return VoteResult{}, err
+	}
+
+	ps.pruneHistory(ctx)
+	return res, nil
+}
+
+// applyDeltas moves the results and history rows of a vote and bumps the
+// poll's last vote time to when the vote was received
+func (ps *PostgresStore) applyDeltas(ctx context.Context, tx pgx.Tx, pollID string, castAt, receivedAt time.Time, deltas map[string]tallyDelta) error {
+	optionIDs := make([]string, 0, len(deltas))
+	for option := range deltas {
+		optionIDs = append(optionIDs, option)
+	}
+	slices.Sort(optionIDs)
+
+	batch := &pgx.Batch{}
+	for _, option := range optionIDs {
+		d := deltas[option]
+		batch.Queue(`INSERT INTO results (poll_id, option_id, votes, weight, tenant_id) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (tenant_id, poll_id, option_id)
+			DO UPDATE SET votes = results.votes + EXCLUDED.votes, weight = results.weight + EXCLUDED.weight`,
+			pollID, option, d.votes, d.weight, ps.tenant)
+	}
+
+	if bucket, ok := ps.opts.historyBucket(castAt); ok {
+		for _, option := range optionIDs {
+			batch.Queue(`INSERT INTO history (poll_id, bucket_start, option_id, votes, tenant_id) VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (tenant_id, poll_id, bucket_start, option_id)
+				DO UPDATE SET votes = history.votes + EXCLUDED.votes`,
+				pollID, bucket, option, deltas[option].votes, ps.tenant)
+		}
+	}
+
+	batch.Queue(`INSERT INTO polls (poll_id, last_vote_at, tenant_id) VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id, poll_id) DO UPDATE SET last_vote_at = GREATEST(polls.last_vote_at, EXCLUDED.last_vote_at)`,
+		pollID, receivedAt, ps.tenant)
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("error updating tally: %v", err)
+	}
+	return nil
+}
+
+// pruneHistory deletes history rows past the retention window, at most once per bucket
+func (ps *PostgresStore) pruneHistory(ctx context.Context) {
+	ps.prune.mu.Lock()
+	if time.Since(ps.prune.last) < ps.opts.bucketSize {
+		ps.prune.mu.Unlock()
+		return
+	}
+	ps.prune.last = time.Now()
+	ps.prune.mu.Unlock()
+
+	_, err := ps.pool.Exec(ctx, "DELETE FROM history WHERE bucket_start < $1", ps.opts.historyCutoff())
+	if err != nil {
+		log.Printf("Error pruning postgres history: %v", err)
+	}
+}
+
+func (ps *PostgresStore) GetResults(ctx context.Context, pollID string) (map[string]int, error) {
+	rows, err := ps.pool.Query(ctx, "SELECT option_id, votes FROM results WHERE poll_id = $1 AND tenant_id = $2 AND votes <> 0",
+		pollID, ps.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error getting results from postgres: %v", err)
+	}
+
+	result := make(map[string]int)
+	var optionID string
+	var count int
+	_, err = pgx.ForEachRow(rows, []any{&optionID, &count}, func() error {
+		result[optionID] = count
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading results from postgres: %v", err)
+	}
+	return result, nil
+}
+
+func (ps *PostgresStore) ListPolls(ctx context.Context, activeSince time.Time) ([]PollInfo, error) {
+	rows, err := ps.pool.Query(ctx, `SELECT poll_id, last_vote_at FROM polls
+		WHERE tenant_id = $2 AND last_vote_at >= $1 ORDER BY last_vote_at DESC`, activeSince, ps.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error listing polls from postgres: %v", err)
+	}
+
+	var polls []PollInfo
+	var p PollInfo
+	_, err = pgx.ForEachRow(rows, []any{&p.PollID, &p.LastVoteAt}, func() error {
+		polls = append(polls, p)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading polls from postgres: %v", err)
+	}
+	return polls, nil
+}
+
+func (ps *PostgresStore) GetPoll(ctx context.Context, pollID string) (PollInfo, bool, error) {
+	p := PollInfo{PollID: pollID}
+	err := ps.pool.QueryRow(ctx, `SELECT last_vote_at FROM polls
+		WHERE poll_id = $1 AND tenant_id = $2 AND last_vote_at IS NOT NULL`, pollID, ps.tenant).Scan(&p.LastVoteAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return PollInfo{}, false, nil
+		}
+		return PollInfo{}, false, fmt.Errorf("error getting poll from postgres: %v", err)
+	}
+	return p, true, nil
+}
+
+func (ps *PostgresStore) CountVoters(ctx context.Context, pollID string) (int, error) {
+	var n int
+	if err := ps.pool.QueryRow(ctx, "SELECT count(*) FROM votes WHERE poll_id = $1 AND tenant_id = $2", pollID, ps.tenant).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error counting voters in postgres: %v", err)
+	}
+	return n, nil
+}
+
+func (ps *PostgresStore) CountVotersIn(ctx context.Context, pollIDs []string) (map[string]int, error) {
+	rows, err := ps.pool.Query(ctx, "SELECT poll_id, count(*) FROM votes WHERE poll_id = ANY($1) AND tenant_id = $2 GROUP BY poll_id",
+		pollIDs, ps.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error counting voters in postgres: %v", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int, len(pollIDs))
+	for _, pollID := range pollIDs {
+		counts[pollID] = 0
+	}
+	for rows.Next() {
+		var pollID string
+		var n int
+		if err := rows.Scan(&pollID, &n); err != nil {
+			return nil, fmt.Errorf("error scanning voter count: %v", err)
+		}
+		counts[pollID] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error counting voters in postgres: %v", err)
+	}
+	return counts, nil
+}
+
+func (ps *PostgresStore) GetWeightedResults(ctx context.Context, pollID string) (map[string]float64, error) {
+	rows, err := ps.pool.Query(ctx, "SELECT option_id, weight FROM results WHERE poll_id = $1 AND tenant_id = $2 AND weight <> 0",
+		pollID, ps.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error getting weighted results from postgres: %v", err)
+	}
+
+	result := make(map[string]float64)
+	var optionID string
+	var sum float64
+	_, err = pgx.ForEachRow(rows, []any{&optionID, &sum}, func() error {
+		result[optionID] = sum
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading weighted results from postgres: %v", err)
+	}
+	return result, nil
+}
+
+func (ps *PostgresStore) GetHistory(ctx context.Context, pollID string, from, to time.Time) ([]model.HistoryBucket, error) {
+	if cutoff := ps.opts.historyCutoff(); from.Before(cutoff) {
+		from = cutoff // not pruned yet, but already past retention
+	}
+
+	rows, err := ps.pool.Query(ctx, `SELECT bucket_start, option_id, votes FROM history
+		WHERE poll_id = $1 AND tenant_id = $4 AND bucket_start BETWEEN $2 AND $3 ORDER BY bucket_start`,
+		pollID, from, to, ps.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error getting history from postgres: %v", err)
+	}
+
+	var history []model.HistoryBucket
+	var start time.Time
+	var optionID string
+	var count int
+	_, err = pgx.ForEachRow(rows, []any{&start, &optionID, &count}, func() error {
+		if n := len(history); n == 0 || !history[n-1].Start.Equal(start) {
+			history = append(history, model.HistoryBucket{Start: start.UTC(), Counts: make(map[string]int)})
+		}
+		history[len(history)-1].Counts[optionID] = count
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading history from postgres: %v", err)
+	}
+	return history, nil
+}
+
+func (ps *PostgresStore) GetBallots(ctx context.Context, pollID string) ([][]string, error) {
+	rows, err := ps.pool.Query(ctx, "SELECT option_ids FROM votes WHERE poll_id = $1 AND tenant_id = $2", pollID, ps.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ballots from postgres: %v", err)
+	}
+
+	ballots, err := pgx.CollectRows(rows, pgx.RowTo[[]string])
+	if err != nil {
+		return nil, fmt.Errorf("error reading ballots from postgres: %v", err)
+	}
+	return ballots, nil
+}
+
+func (ps *PostgresStore) GetVote(ctx context.Context, pollID, userID string) (StoredVote, bool, error) {
+	v := StoredVote{UserID: userID}
+	err := ps.pool.QueryRow(ctx, `SELECT option_ids, weight, cast_at, metadata FROM votes
+		WHERE poll_id = $1 AND user_id = $2 AND tenant_id = $3`, pollID, userID, ps.tenant).Scan(&v.OptionIDs, &v.Weight, &v.CastAt, &v.Metadata)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return StoredVote{}, false, nil
+		}
+		return StoredVote{}, false, fmt.Errorf("error getting vote from postgres: %v", err)
+	}
+	v.CastAt = v.CastAt.UTC()
+	return v, true, nil
+}
+
+/*
+CheckTally runs in a repeatable read transaction, so the votes and results it
+reads come from the same snapshot. The repair adds the difference between the
+recount and that snapshot to the results rows instead of overwriting them:
+votes committed meanwhile keep their own increments, and a row one of them
+updated fails the transaction, to be checked again next time.
+*/
+func (ps *PostgresStore) ListVotes(ctx context.Context, pollID string) ([]StoredVote, error) {
+	rows, err := ps.pool.Query(ctx, "SELECT user_id, option_ids, weight, cast_at, metadata FROM votes WHERE poll_id = $1 AND tenant_id = $2",
+		pollID, ps.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error listing votes from postgres: %v", err)
+	}
+
+	var votes []StoredVote
+	var v StoredVote
+	_, err = pgx.ForEachRow(rows, []any{&v.UserID, &v.OptionIDs, &v.Weight, &v.CastAt, &v.Metadata}, func() error {
+		votes = append(votes, StoredVote{UserID: v.UserID, OptionIDs: v.OptionIDs, Weight: v.Weight, CastAt: v.CastAt.UTC(), Metadata: v.Metadata})
+		v.Metadata = model.VoteMetadata{} // a row's extras mustn't leak into the next one
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading votes from postgres: %v", err)
+	}
+	return votes, nil
+}
+
+// DeletePoll deletes the poll's votes, results and history rows and clears its
+// last vote time, which takes it out of the poll index. vote_events is the
+// audit trail and keeps its rows. Clearing the last vote time comes first: it
+// locks the poll's row, which a vote updates too, so none slips in between
+func (ps *PostgresStore) DeletePoll(ctx context.Context, pollID string, lastVoteAt time.Time) (int, error) {
+	n := 0
+	err := pgx.BeginTxFunc(ctx, ps.pool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "UPDATE polls SET last_vote_at = NULL WHERE poll_id = $1 AND tenant_id = $2 AND last_vote_at = $3",
+			pollID, ps.tenant, lastVoteAt)
+		if err != nil {
+			return fmt.Errorf("error removing poll from the index: %v", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrPollChanged
+		}
+
+		for _, table := range []string{"votes", "results", "history", "applied_votes"} {
+			tag, err := tx.Exec(ctx, "DELETE FROM "+table+" WHERE poll_id = $1 AND tenant_id = $2", pollID, ps.tenant)
+			if err != nil {
+				return fmt.Errorf("error deleting %s: %v", table, err)
+			}
+			n += int(tag.RowsAffected())
+		}
+		return nil
+	})
+	if errors.Is(err, ErrPollChanged) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error deleting poll from postgres: %v", err)
+	}
+	return n, nil
+}
+
+func (ps *PostgresStore) CheckTally(ctx context.Context, pollID string, repair bool) (TallyCheck, error) {
+	check := newTallyCheck()
+	err := pgx.BeginTxFunc(ctx, ps.pool, pgx.TxOptions{IsoLevel: pgx.RepeatableRead}, func(tx pgx.Tx) error {
+		var mode string
+		err := tx.QueryRow(ctx, "SELECT settings->>'mode' FROM polls WHERE poll_id = $1 AND tenant_id = $2",
+			pollID, ps.tenant).Scan(&mode)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("error getting poll mode: %v", err)
+		}
+
+		deltas := make(map[string]tallyDelta)
+		rows, err := tx.Query(ctx, "SELECT option_ids, weight FROM votes WHERE poll_id = $1 AND tenant_id = $2", pollID, ps.tenant)
+		if err != nil {
+			return fmt.Errorf("error getting votes: %v", err)
+		}
+		var choice []string
+		var weight float64
+		_, err = pgx.ForEachRow(rows, []any{&choice, &weight}, func() error {
+			check.Ballots++
+			for i, option := range choice {
+				if mode == string(model.PollModeRanked) && i > 0 {
+					break
+				}
+				check.Recount[option]++
+				check.RecountWeight[option] += weight
+				d := deltas[option]
+				d.votes++
+				d.weight += weight
+				deltas[option] = d
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error reading votes: %v", err)
+		}
+		// the votes table is both the voter set and the choices
+		check.Voters = check.Ballots
+
+		rows, err = tx.Query(ctx, "SELECT option_id, votes, weight FROM results WHERE poll_id = $1 AND tenant_id = $2", pollID, ps.tenant)
+		if err != nil {
+			return fmt.Errorf("error getting results: %v", err)
+		}
+		var optionID string
+		var count int64
+		_, err = pgx.ForEachRow(rows, []any{&optionID, &count, &weight}, func() error {
+			if count != 0 {
+				check.Stored[optionID] = int(count)
+			}
+			if weight != 0 {
+				check.StoredWeight[optionID] = weight
+			}
+			d := deltas[optionID]
+			d.votes -= count
+			d.weight -= weight
+			deltas[optionID] = d
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error reading results: %v", err)
+		}
+
+		dropZeroWeights(check.RecountWeight)
+
+		if !repair || check.Matches() {
+			return nil
+		}
+
+		optionIDs := make([]string, 0, len(deltas))
+		for option := range deltas {
+			optionIDs = append(optionIDs, option)
+		}
+		slices.Sort(optionIDs)
+
+		batch := &pgx.Batch{}
+		for _, option := range optionIDs {
+			d := deltas[option]
+			batch.Queue(`INSERT INTO results (poll_id, option_id, votes, weight, tenant_id) VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (tenant_id, poll_id, option_id)
+				DO UPDATE SET votes = results.votes + EXCLUDED.votes, weight = results.weight + EXCLUDED.weight`,
+				pollID, option, d.votes, d.weight, ps.tenant)
+		}
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("error repairing tally: %v", err)
+		}
+		check.Repaired = true
+		return nil
+	})
+	if err != nil {
+		return TallyCheck{}, fmt.Errorf("error checking tally in postgres: %v", err)
+	}
+	return check, nil
+}
+
+func (ps *PostgresStore) GetPollSettings(ctx context.Context, pollID string) (model.PollSettings, error) {
+	var settings model.PollSettings
+	var b []byte
+	err := ps.pool.QueryRow(ctx, "SELECT settings FROM polls WHERE poll_id = $1 AND tenant_id = $2", pollID, ps.tenant).Scan(&b)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return settings, nil
+		}
+		return settings, fmt.Errorf("error getting poll settings from postgres: %v", err)
+	}
+
+	if err := json.Unmarshal(b, &settings); err != nil {
+		return settings, fmt.Errorf("error unmarshalling poll settings: %v", err)
+	}
+	return settings, nil
+}
+
+// HasPollSettings looks for a polls row with settings. A poll's first vote
+// creates its row too, with the empty default, and saved settings are never empty
+func (ps *PostgresStore) HasPollSettings(ctx context.Context, pollID string) (bool, error) {
+	var ok bool
+	err := ps.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM polls
+		WHERE poll_id = $1 AND tenant_id = $2 AND settings <> '{}')`, pollID, ps.tenant).Scan(&ok)
+	if err != nil {
+		return false, fmt.Errorf("error checking poll settings in postgres: %v", err)
+	}
+	return ok, nil
+}
+
+func (ps *PostgresStore) SavePollSettings(ctx context.Context, pollID string, settings model.PollSettings) error {
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("error marshalling poll settings: %v", err)
+	}
+
+	_, err = ps.pool.Exec(ctx, `INSERT INTO polls (poll_id, settings, tenant_id) VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id, poll_id) DO UPDATE SET settings = EXCLUDED.settings`, pollID, b, ps.tenant)
+	if err != nil {
+		return fmt.Errorf("error saving poll settings to postgres: %v", err)
+	}
+	return nil
+}
+
+func (ps *PostgresStore) GetVoterWeight(ctx context.Context, userID string) (float64, bool, error) {
+	var w float64
+	err := ps.pool.QueryRow(ctx, "SELECT weight FROM voter_weights WHERE user_id = $1 AND tenant_id = $2", userID, ps.tenant).Scan(&w)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("error getting voter weight from postgres: %v", err)
+	}
+	return w, true, nil
+}
+
+func (ps *PostgresStore) SetVoterWeight(ctx context.Context, userID string, weight float64) error {
+	_, err := ps.pool.Exec(ctx, `INSERT INTO voter_weights (user_id, weight, tenant_id) VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id, user_id) DO UPDATE SET weight = EXCLUDED.weight`, userID, weight, ps.tenant)
+	if err != nil {
+		return fmt.Errorf("error saving voter weight to postgres: %v", err)
+	}
+	return nil
+}
+
+func (ps *PostgresStore) RecordVelocity(ctx context.Context, key, member string, at time.Time, window time.Duration) (int, error) {
+	var n int
+	err := pgx.BeginFunc(ctx, ps.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `INSERT INTO velocity (tenant_id, key, member, seen_at) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (tenant_id, key, member) DO UPDATE SET seen_at = GREATEST(velocity.seen_at, EXCLUDED.seen_at)`,
+			ps.tenant, key, member, at)
+		if err != nil {
+			return err
+		}
+		cutoff := at.Add(-window)
+		_, err = tx.Exec(ctx, `DELETE FROM velocity WHERE tenant_id = $1 AND key = $2 AND seen_at <= $3`, ps.tenant, key, cutoff)
+		if err != nil {
+			return err
+		}
+		return tx.QueryRow(ctx, `SELECT count(*) FROM velocity WHERE tenant_id = $1 AND key = $2 AND seen_at <= $3`,
+			ps.tenant, key, at).Scan(&n)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error recording velocity in postgres: %v", err)
+	}
+	return n, nil
+}
+
+func (ps *PostgresStore) QuarantineVote(ctx context.Context, q QuarantinedVote) error {
+	v, err := json.Marshal(q.Vote)
+	if err != nil {
+		return fmt.Errorf("error marshalling quarantined vote: %v", err)
+	}
+	_, err = ps.pool.Exec(ctx, `INSERT INTO quarantine (tenant_id, id, poll_id, vote, quarantined_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant_id, id) DO UPDATE SET poll_id = EXCLUDED.poll_id, vote = EXCLUDED.vote, quarantined_at = EXCLUDED.quarantined_at`,
+		ps.tenant, q.ID, q.Vote.PollID, v, q.QuarantinedAt)
+	if err != nil {
+		return fmt.Errorf("error quarantining vote in postgres: %v", err)
+	}
+	return nil
+}
+
+func (ps *PostgresStore) ListQuarantined(ctx context.Context, pollID string) ([]QuarantinedVote, error) {
+	rows, err := ps.pool.Query(ctx, `SELECT id, vote, quarantined_at FROM quarantine
+		WHERE tenant_id = $1 AND ($2 = '' OR poll_id = $2) ORDER BY quarantined_at`, ps.tenant, pollID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing quarantined votes from postgres: %v", err)
+	}
+	defer rows.Close()
+
+	held := []QuarantinedVote{}
+	for rows.Next() {
+		var q QuarantinedVote
+		if err := rows.Scan(&q.ID, &q.Vote, &q.QuarantinedAt); err != nil {
+			return nil, fmt.Errorf("error scanning quarantined vote: %v", err)
+		}
+		held = append(held, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing quarantined votes from postgres: %v", err)
+	}
+	return held, nil
+}
+
+func (ps *PostgresStore) GetQuarantined(ctx context.Context, id string) (QuarantinedVote, bool, error) {
+	q := QuarantinedVote{ID: id}
+	err := ps.pool.QueryRow(ctx, `SELECT vote, quarantined_at FROM quarantine WHERE tenant_id = $1 AND id = $2`,
+		ps.tenant, id).Scan(&q.Vote, &q.QuarantinedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return QuarantinedVote{}, false, nil
+		}
+		return QuarantinedVote{}, false, fmt.Errorf("error getting quarantined vote from postgres: %v", err)
+	}
+	return q, true, nil
+}
+
+func (ps *PostgresStore) ResolveQuarantined(ctx context.Context, rec ReviewRecord) (bool, error) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return false, fmt.Errorf("error marshalling review record: %v", err)
+	}
+
+	var ok bool
+	err = pgx.BeginFunc(ctx, ps.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `DELETE FROM quarantine WHERE tenant_id = $1 AND id = $2`, ps.tenant, rec.VoteID)
+		if err != nil || tag.RowsAffected() == 0 {
+			return err
+		}
+		ok = true
+		_, err = tx.Exec(ctx, `INSERT INTO reviews (tenant_id, poll_id, record, decided_at) VALUES ($1, $2, $3, $4)`,
+			ps.tenant, rec.PollID, b, rec.DecidedAt)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("error resolving quarantined vote in postgres: %v", err)
+	}
+	return ok, nil
+}
+
+func (ps *PostgresStore) ListReviews(ctx context.Context, pollID string) ([]ReviewRecord, error) {
+	rows, err := ps.pool.Query(ctx, `SELECT record FROM reviews
+		WHERE tenant_id = $1 AND ($2 = '' OR poll_id = $2) ORDER BY id`, ps.tenant, pollID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing review records from postgres: %v", err)
+	}
+	defer rows.Close()
+
+	records := []ReviewRecord{}
+	for rows.Next() {
+		var rec ReviewRecord
+		if err := rows.Scan(&rec); err != nil {
+			return nil, fmt.Errorf("error scanning review record: %v", err)
+		}
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing review records from postgres: %v", err)
+	}
+	return records, nil
+}
+
+func (ps *PostgresStore) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	// the row is only updated when it's holder's already or it ran out
+	tag, err := ps.pool.Exec(ctx, `INSERT INTO leases (name, holder, expires_at) VALUES ($1, $2, now() + $3 * interval '1 millisecond')
+		ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+		WHERE leases.holder = EXCLUDED.holder OR leases.expires_at < now()`,
+		name, holder, ttl.Milliseconds())
+	if err != nil {
+		return false, fmt.Errorf("error acquiring lease in postgres: %v", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (ps *PostgresStore) Close() error {
+	ps.pool.Close()
+	return nil
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const hashTagMigrationLease = "hash-tag-migration"
+
+// legacyPollKey matches the keys written before poll keys were hash tagged,
+// poll:<id>:<name>. Poll IDs can hold colons, so the name has to be a known one
+var legacyPollKey = regexp.MustCompile(`^poll:([^{].*):(votes|results|choices|settings|weights|weighted|history|history:\d+|cast_at)$`)
+
+/*
+migrateHashTags renames the keys of polls written before the hash tags to
+poll:{<id>}:<name>. It only runs against a single node or a Sentinel group,
+where every key lives in the same place; a cluster could never run the
+multi-key scripts without the tags, so it has nothing to migrate.
+
+The renames don't overwrite: when the tagged key already exists, a new
+consumer got to the poll first and the legacy key is left for a look by hand.
+A legacy key that's gone by the time it's renamed was renamed by someone else,
+and counts as migrated. Stop the consumers of the old version before starting
+the new one, or they keep writing legacy keys.
+
+It only runs with WithHashTagMigration, and while holding a lease, so two
+processes started with it don't scan and rename at the same time.
+*/
+func (rs *RedisStore) migrateHashTags(ctx context.Context) error {
+	holder := fmt.Sprintf("migration-%d", time.Now().UnixNano())
+	ok, err := rs.AcquireLease(ctx, hashTagMigrationLease, holder, time.Hour)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		log.Println("Not migrating redis keys to hash tagged poll keys, another process is at it")
+		return nil
+	}
+
+	keys, err := rs.scanKeys(ctx, "poll:*")
+	if err != nil {
+		return err
+	}
+
+	renamed, conflicts := 0, 0
+	for _, k := range keys {
+		m := legacyPollKey.FindStringSubmatch(k)
+		if m == nil {
+			continue
+		}
+
+		dst := fmt.Sprintf("poll:{%s}:%s", m[1], m[2])
+		ok, err := rs.client.RenameNX(ctx, k, dst).Result()
+		if err != nil && strings.Contains(err.Error(), "no such key") {
+			continue // renamed since the scan
+		}
+		if err != nil {
+			return fmt.Errorf("error migrating key %s: %v", k, err)
+		}
+		if !ok {
+			log.Printf("Not migrating redis key %s, %s already exists", k, dst)
+			conflicts++
+			continue
+		}
+		renamed++
+	}
+
+	log.Printf("Migrated %d redis keys to hash tagged poll keys, %d left behind", renamed, conflicts)
+	return nil
+}
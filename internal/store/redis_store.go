@@ -2,57 +2,396 @@ package store
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
 	"github.com/redis/go-redis/v9"
 )
 
+// decodeChoiceLua reads a stored choice, either a JSON array of options or a
+// legacy plain string holding a single option
+const decodeChoiceLua = `
+local function decode(choice)
+	if string.sub(choice, 1, 1) == '[' then
+		return cjson.decode(choice)
+	end
+	return {choice}
+end
+`
+
+/*
+registerVoteScript applies a vote atomically. Besides the voter set (dedupe)
+and the results hash (tally) we keep a choices hash with each user's current
+options, a weights hash with the weight their vote was counted with and a
+cast_at hash with when they cast it, so a change or retraction knows exactly
+what to take back and a user's vote can be looked up later. Choices are JSON arrays;
+a plain string is a single option written before multi-choice polls existed,
+a voter with no stored weight counted with weight 1, and one with no cast_at
+voted before it was kept. The metadata hash keeps where each current vote
+came from, when ingestion said. In ranked polls the
+choice is the ballot, and only its first preference is tallied.
+
+Every change to the tally is also added to the history bucket the vote's
+timestamp falls in, and the bucket is indexed by its start time. Buckets
+expire on their own once they're older than the retention window.
+
+KEYS[1] = poll:{<id>}:votes    (set of users that currently have a vote)
+KEYS[2] = poll:{<id>}:results  (option -> count)
+KEYS[3] = poll:{<id>}:choices  (user -> JSON array of options)
+KEYS[4] = poll:{<id>}:settings (JSON poll settings, read for the mode)
+KEYS[5] = poll:{<id>}:weights  (user -> weight)
+KEYS[6] = poll:{<id>}:weighted (option -> sum of weights)
+KEYS[7] = poll:{<id>}:history  (sorted set of bucket start times)
+KEYS[8] = poll:{<id>}:history:<bucket start> (option -> net count in the bucket)
+KEYS[9] = poll:{<id>}:cast_at  (user -> unix nanos the current vote was cast at)
+KEYS[10] = poll:{<id>}:metadata (user -> JSON vote metadata)
+KEYS[11] = poll:{<id>}:applied_votes (vote ID -> what the vote first applied with it was, see appliedVoteID)
+ARGV[1] = kind, ARGV[2] = user, ARGV[3] = JSON array of options, ARGV[4] = weight
+ARGV[5] = bucket start (unix seconds, empty to skip the history)
+ARGV[6] = unix time the bucket expires at
+ARGV[7] = start of the oldest bucket still kept, older ones leave the index
+ARGV[8] = unix nanos the vote was cast at
+ARGV[9] = JSON vote metadata, empty when the vote has none
+ARGV[10] = vote ID, empty when the vote has none
+ARGV[11] = the vote's copy key, see voteCopyKey
+
+Returns {outcome, previous choice}
+*/
+var registerVoteScript = redis.NewScript(decodeChoiceLua + `
+local settings = redis.call('GET', KEYS[4])
+local ranked = settings and cjson.decode(settings).mode == 'ranked'
+
+local function tally(choice, sign, weight)
+	for i, option in ipairs(decode(choice)) do
+		if ranked and i > 1 then
+			break
+		end
+		redis.call('HINCRBY', KEYS[2], option, sign)
+		redis.call('HINCRBYFLOAT', KEYS[6], option, sign * weight)
+		if ARGV[5] ~= '' then
+			redis.call('HINCRBY', KEYS[8], option, sign)
+		end
+	end
+	if ARGV[5] ~= '' then
+		redis.call('ZADD', KEYS[7], ARGV[5], ARGV[5])
+		redis.call('ZREMRANGEBYSCORE', KEYS[7], '-inf', '(' .. ARGV[7])
+		redis.call('EXPIREAT', KEYS[8], ARGV[6])
+	end
+end
+
+local function setMetadata()
+	if ARGV[9] ~= '' then
+		redis.call('HSET', KEYS[10], ARGV[2], ARGV[9])
+	else
+		redis.call('HDEL', KEYS[10], ARGV[2])
+	end
+end
+
+local prev = redis.call('HGET', KEYS[3], ARGV[2]) or ''
+
+-- the same replayOutcome and appliedVoteID as the other stores
+local function rejected(outcome)
+	if ARGV[10] ~= '' then
+		redis.call('HSET', KEYS[11], ARGV[10], outcome .. ':' .. ARGV[11])
+	end
+	if outcome == 'not_found' then
+		return {outcome, ''}
+	end
+	return {outcome, prev}
+end
+
+if ARGV[10] ~= '' then
+	local first = redis.call('HGET', KEYS[11], ARGV[10])
+	if first == ARGV[11] then
+		return {'replayed', ''}
+	elseif first == 'not_found:' .. ARGV[11] then
+		return {'not_found', ''}
+	elseif first then
+		return {'duplicate', prev}
+	end
+	redis.call('HSET', KEYS[11], ARGV[10], ARGV[11])
+end
+
+local prevWeight = tonumber(redis.call('HGET', KEYS[5], ARGV[2]) or '1')
+local weight = tonumber(ARGV[4])
+
+if ARGV[1] == 'cast' then
+	if redis.call('SADD', KEYS[1], ARGV[2]) == 0 then
+		return rejected('duplicate')
+	end
+	redis.call('HSET', KEYS[3], ARGV[2], ARGV[3])
+	redis.call('HSET', KEYS[5], ARGV[2], ARGV[4])
+	redis.call('HSET', KEYS[9], ARGV[2], ARGV[8])
+	setMetadata()
+	tally(ARGV[3], 1, weight)
+	return {'counted', ''}
+end
+
+if prev == '' then
+	return rejected('not_found')
+end
+
+if ARGV[1] == 'retract' then
+	redis.call('SREM', KEYS[1], ARGV[2])
+	redis.call('HDEL', KEYS[3], ARGV[2])
+	redis.call('HDEL', KEYS[5], ARGV[2])
+	redis.call('HDEL', KEYS[9], ARGV[2])
+	redis.call('HDEL', KEYS[10], ARGV[2])
+	tally(prev, -1, prevWeight)
+	return {'retracted', prev}
+end
+
+if prev == ARGV[3] and prevWeight == weight then
+	return {'unchanged', prev}
+end
+tally(prev, -1, prevWeight)
+tally(ARGV[3], 1, weight)
+redis.call('HSET', KEYS[3], ARGV[2], ARGV[3])
+redis.call('HSET', KEYS[5], ARGV[2], ARGV[4])
+redis.call('HSET', KEYS[9], ARGV[2], ARGV[8])
+setMetadata()
+return {'changed', prev}
+`)
+
+/*
+RedisStore keeps the tally in Redis: a single node, a Sentinel-managed
+failover group or a Redis Cluster. The state derived from votes (voters,
+choices, results, history and the poll index) can live under a namespace, a
+prefix added to its keys, so a rebuild can replay votes next to the live state
+and swap it in when it's done. Poll settings and the voter-weight table are
+configuration rather than derived state, so every namespace shares them.
+
+Each tenant but the default one has its keys under tenant:<id>:, after the
+namespace, so two teams can use the same poll IDs and user IDs.
+
+Every key of a poll carries the poll ID as a hash tag, poll:{<id>}:<name>, so
+in a cluster they all land in the same slot and the scripts that touch
+several of them can run. The poll index and the voter-weight table are shared
+by every poll and only ever touched on their own, outside the scripts.
+*/
 type RedisStore struct {
-	client *redis.Client
+	client redis.UniversalClient
+	opts   options
+	ns     string
+	tenant string
 }
 
-func NewRedisStore(ctx context.Context, addr string) (*RedisStore, error) {
-	opts, err := redis.ParseURL(addr)
+// NewRedisStore connects to a single Redis node, e.g. redis://localhost:6379/0
+func NewRedisStore(ctx context.Context, addr string, opts ...Option) (*RedisStore, error) {
+	copts, err := redis.ParseURL(addr)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing redis URL: %v", err)
 	}
 
-	c := redis.NewClient(opts)
+	return newRedisStore(ctx, redis.NewClient(copts), true, opts)
+}
+
+// NewRedisClusterStore connects to a Redis Cluster. The URL names one node
+// and the others are added as addr parameters:
+// redis://node1:6379?addr=node2:6379&addr=node3:6379
+func NewRedisClusterStore(ctx context.Context, addr string, opts ...Option) (*RedisStore, error) {
+	copts, err := redis.ParseClusterURL(addr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing redis cluster URL: %v", err)
+	}
+
+	// a cluster never ran the store before hash tags, the scripts can't run there without them
+	return newRedisStore(ctx, redis.NewClusterClient(copts), false, opts)
+}
 
+// NewRedisSentinelStore connects to the master of a Sentinel-managed group.
+// The URL names one sentinel, the others are added as addr parameters and the
+// group as master_name: redis://sentinel1:26379?master_name=mymaster&addr=sentinel2:26379
+func NewRedisSentinelStore(ctx context.Context, addr string, opts ...Option) (*RedisStore, error) {
+	copts, err := redis.ParseFailoverURL(addr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing redis sentinel URL: %v", err)
+	}
+
+	return newRedisStore(ctx, redis.NewFailoverClient(copts), true, opts)
+}
+
+// OpenRedisStore connects with the constructor of the given mode: "single",
+// "cluster" or "sentinel"
+func OpenRedisStore(ctx context.Context, mode, addr string, opts ...Option) (*RedisStore, error) {
+	switch mode {
+	case "single":
+		return NewRedisStore(ctx, addr, opts...)
+	case "cluster":
+		return NewRedisClusterStore(ctx, addr, opts...)
+	case "sentinel":
+		return NewRedisSentinelStore(ctx, addr, opts...)
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q", mode)
+	}
+}
+
+func newRedisStore(ctx context.Context, c redis.UniversalClient, migrate bool, opts []Option) (*RedisStore, error) {
 	if err := c.Ping(ctx).Err(); err != nil {
+		c.Close()
 		return nil, fmt.Errorf("error connecting to redis: %v", err)
 	}
 
-	return &RedisStore{client: c}, nil
+	rs := &RedisStore{client: c, opts: newOptions(opts)}
+	if migrate && rs.opts.migrateHashTags {
+		if err := rs.migrateHashTags(ctx); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+// WithNamespace returns a store sharing this store's connection that keeps its
+// derived state under the given key prefix
+func (rs *RedisStore) WithNamespace(ns string) *RedisStore {
+	return &RedisStore{client: rs.client, opts: rs.opts, ns: ns, tenant: rs.tenant}
 }
 
-func (rs *RedisStore) RegisterVote(ctx context.Context, vote model.Vote) (bool, error) {
-	vkey := fmt.Sprintf("poll:%s:votes", vote.PollID)
-	rkey := fmt.Sprintf("poll:%s:results", vote.PollID)
+func (rs *RedisStore) ForTenant(tenantID string) VoteStore {
+	return rs.Tenant(tenantID)
+}
 
-	pipe := rs.client.Pipeline()
-	saddR := pipe.SAdd(ctx, vkey, vote.UserID)
-	pipe.HIncrBy(ctx, rkey, vote.OptionID, 1)
+// Tenant is ForTenant for callers that need the RedisStore itself
+func (rs *RedisStore) Tenant(tenantID string) *RedisStore {
+	return &RedisStore{client: rs.client, opts: rs.opts, ns: rs.ns, tenant: tenantID}
+}
+
+func (rs *RedisStore) tenantPrefix() string {
+	if rs.tenant == "" {
+		return ""
+	}
+	return "tenant:" + rs.tenant + ":"
+}
+
+// pollKey is the key of one of the poll's derived structures, e.g. "results"
+func (rs *RedisStore) pollKey(pollID, name string) string {
+	return fmt.Sprintf("%s%spoll:{%s}:%s", rs.ns, rs.tenantPrefix(), pollID, name)
+}
+
+func (rs *RedisStore) pollsKey() string {
+	return rs.ns + rs.tenantPrefix() + "polls"
+}
 
-	_, err := pipe.Exec(ctx)
+// settings live outside the namespace so a rebuild reads the live config
+func (rs *RedisStore) settingsKey(pollID string) string {
+	return fmt.Sprintf("%spoll:{%s}:settings", rs.tenantPrefix(), pollID)
+}
+
+func (rs *RedisStore) voterWeightsKey() string {
+	return rs.tenantPrefix() + "voter_weights"
+}
+
+/*
+quarantine keys are review state rather than derived state, so like settings
+they live outside the namespace. They share a hash tag so resolving a vote
+can move it to the audit log in one script
+*/
+func (rs *RedisStore) quarantineKey(name string) string {
+	return rs.tenantPrefix() + "{quarantine}:" + name
+}
+
+// velocity counters are derived from votes, so they live in the namespace
+func (rs *RedisStore) velocityKey(key string) string {
+	return fmt.Sprintf("%s%svelocity:{%s}", rs.ns, rs.tenantPrefix(), key)
+}
+
+func (rs *RedisStore) RegisterVote(ctx context.Context, vote model.Vote) (VoteResult, error) {
+	keys := []string{
+		rs.pollKey(vote.PollID, "votes"),
+		rs.pollKey(vote.PollID, "results"),
+		rs.pollKey(vote.PollID, "choices"),
+		rs.settingsKey(vote.PollID),
+		rs.pollKey(vote.PollID, "weights"),
+		rs.pollKey(vote.PollID, "weighted"),
+		rs.pollKey(vote.PollID, "history"),
+	}
+
+	// votes older than the retention window are still counted, they just
+	// don't make it into the history
+	var bucket, expireAt string
+	castAt := vote.CastAt()
+	if start, ok := rs.opts.historyBucket(castAt); ok {
+		bucket = strconv.FormatInt(start.Unix(), 10)
+		expireAt = strconv.FormatInt(start.Add(rs.opts.bucketSize+rs.opts.historyRetention).Unix(), 10)
+	}
+	keys = append(keys, rs.pollKey(vote.PollID, "history:"+bucket), rs.pollKey(vote.PollID, "cast_at"), rs.pollKey(vote.PollID, "metadata"), rs.pollKey(vote.PollID, "applied_votes"))
+
+	options := vote.Options()
+	if options == nil {
+		options = []string{} // encode as [] rather than null
+	}
+	choice, err := json.Marshal(options)
+	if err != nil {
+		return VoteResult{}, fmt.Errorf("error marshalling vote options: %v", err)
+	}
+	copyKey, err := voteCopyKey(vote)
 	if err != nil {
-		return false, fmt.Errorf("error executing redis pipeline: %v", err)
+		return VoteResult{}, err
+	}
+	var metadata []byte
+	if !vote.Metadata.IsZero() {
+		if metadata, err = json.Marshal(vote.Metadata); err != nil {
+			return VoteResult{}, fmt.Errorf("error marshalling vote metadata: %v", err)
+		}
 	}
 
-	r, err := saddR.Result()
+	r, err := registerVoteScript.Run(ctx, rs.client, keys,
+		string(vote.KindOrDefault()), vote.UserID, choice, vote.WeightOrDefault(),
+		bucket, expireAt, rs.opts.historyCutoff().Unix(), castAt.UnixNano(), metadata, vote.VoteID, copyKey).StringSlice()
 	if err != nil {
-		return false, fmt.Errorf("error getting SAdd result: %v", err)
+		return VoteResult{}, fmt.Errorf("error running register vote script: %v", err)
+	}
+
+	res := VoteResult{Outcome: VoteOutcome(r[0])}
+	switch res.Outcome {
+	case VoteCounted, VoteChanged, VoteRetracted, VoteReplayed:
+		// The poll index is shared by every poll, so it stays out of the script.
+		// GT keeps the latest vote time when votes arrive out of order. The vote
+		// is applied by now, so a failure here is only logged: returning it
+		// would get the vote retried, and the retry comes back replayed. That's
+		// why a replayed vote updates the index too, in case its first copy
+		// didn't get to. It goes by when the vote was received, a producer's
+		// clock ahead would keep the poll active for good
+		err = rs.client.ZAddGT(ctx, rs.pollsKey(), redis.Z{Score: float64(vote.ReceivedAtOrNow().Unix()), Member: vote.PollID}).Err()
+		if err != nil {
+			log.Printf("Error updating poll index for PollID %s: %v", vote.PollID, err)
+		}
+	}
+
+	if res.PreviousOptionIDs, err = decodeChoice(r[1]); err != nil {
+		return VoteResult{}, err
 	}
 
-	isNewVote := r > 0
+	return res, nil
+}
+
+// decodeChoice parses a value of the choices hash, the same way registerVoteScript does
+func decodeChoice(choice string) ([]string, error) {
+	if choice == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(choice, "[") {
+		return []string{choice}, nil
+	}
 
-	return isNewVote, nil
+	var options []string
+	if err := json.Unmarshal([]byte(choice), &options); err != nil {
+		return nil, fmt.Errorf("error unmarshalling stored choice: %v", err)
+	}
+	return options, nil
 }
 
 func (rs *RedisStore) GetResults(ctx context.Context, pollID string) (map[string]int, error) {
-	vkey := fmt.Sprintf("poll:%s:results", pollID)
+	vkey := rs.pollKey(pollID, "results")
 
 	rstr, err := rs.client.HGetAll(ctx, vkey).Result()
 	if err != nil {
@@ -65,12 +404,788 @@ func (rs *RedisStore) GetResults(ctx context.Context, pollID string) (map[string
 		if err != nil {
 			return nil, fmt.Errorf("error converting count to int: %v", err)
 		}
+		// an option can drop to zero after changes and retractions
+		if count == 0 {
+			continue
+		}
 		result[optionID] = count
 	}
 
 	return result, nil
 }
 
+func (rs *RedisStore) ListPolls(ctx context.Context, activeSince time.Time) ([]PollInfo, error) {
+	min := "-inf"
+	if !activeSince.IsZero() {
+		min = strconv.FormatInt(activeSince.Unix(), 10)
+	}
+
+	zs, err := rs.client.ZRevRangeByScoreWithScores(ctx, rs.pollsKey(), &redis.ZRangeBy{Min: min, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error listing polls from redis: %v", err)
+	}
+
+	polls := make([]PollInfo, 0, len(zs))
+	for _, z := range zs {
+		polls = append(polls, PollInfo{
+			PollID:     z.Member.(string),
+			LastVoteAt: time.Unix(int64(z.Score), 0).UTC(),
+		})
+	}
+	return polls, nil
+}
+
+func (rs *RedisStore) GetPoll(ctx context.Context, pollID string) (PollInfo, bool, error) {
+	score, err := rs.client.ZScore(ctx, rs.pollsKey(), pollID).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return PollInfo{}, false, nil
+		}
+		return PollInfo{}, false, fmt.Errorf("error getting poll from redis: %v", err)
+	}
+	return PollInfo{PollID: pollID, LastVoteAt: time.Unix(int64(score), 0).UTC()}, true, nil
+}
+
+func (rs *RedisStore) CountVoters(ctx context.Context, pollID string) (int, error) {
+	vkey := rs.pollKey(pollID, "votes")
+
+	n, err := rs.client.SCard(ctx, vkey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error counting voters in redis: %v", err)
+	}
+	return int(n), nil
+}
+
+func (rs *RedisStore) CountVotersIn(ctx context.Context, pollIDs []string) (map[string]int, error) {
+	cmds := make([]*redis.IntCmd, len(pollIDs))
+	_, err := rs.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, pollID := range pollIDs {
+			cmds[i] = pipe.SCard(ctx, rs.pollKey(pollID, "votes"))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error counting voters in redis: %v", err)
+	}
+
+	counts := make(map[string]int, len(pollIDs))
+	for i, pollID := range pollIDs {
+		counts[pollID] = int(cmds[i].Val())
+	}
+	return counts, nil
+}
+
+func (rs *RedisStore) GetWeightedResults(ctx context.Context, pollID string) (map[string]float64, error) {
+	wkey := rs.pollKey(pollID, "weighted")
+
+	rstr, err := rs.client.HGetAll(ctx, wkey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting weighted results from redis: %v", err)
+	}
+
+	result := make(map[string]float64, len(rstr))
+	for optionID, sumStr := range rstr {
+		sum, err := strconv.ParseFloat(sumStr, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error converting weight sum to float: %v", err)
+		}
+		if sum == 0 {
+			continue
+		}
+		result[optionID] = sum
+	}
+
+	return result, nil
+}
+
+// GetHistory returns the history buckets of a poll that start within [from, to],
+// oldest first. Each bucket holds the net change of every option's count
+func (rs *RedisStore) GetHistory(ctx context.Context, pollID string, from, to time.Time) ([]model.HistoryBucket, error) {
+	hkey := rs.pollKey(pollID, "history")
+
+	starts, err := rs.client.ZRangeByScore(ctx, hkey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.Unix(), 10),
+		Max: strconv.FormatInt(to.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting history index from redis: %v", err)
+	}
+
+	pipe := rs.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(starts))
+	for i, start := range starts {
+		cmds[i] = pipe.HGetAll(ctx, rs.pollKey(pollID, "history:"+start))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("error getting history buckets from redis: %v", err)
+	}
+
+	history := make([]model.HistoryBucket, 0, len(starts))
+	for i, start := range starts {
+		unix, err := strconv.ParseInt(start, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error converting bucket start to int: %v", err)
+		}
+
+		rstr := cmds[i].Val()
+		if len(rstr) == 0 {
+			continue // expired, but not yet pruned from the index
+		}
+
+		b := model.HistoryBucket{
+			Start:  time.Unix(unix, 0).UTC(),
+			Counts: make(map[string]int, len(rstr)),
+		}
+		for optionID, countStr := range rstr {
+			count, err := strconv.Atoi(countStr)
+			if err != nil {
+				return nil, fmt.Errorf("error converting count to int: %v", err)
+			}
+			b.Counts[optionID] = count
+		}
+		history = append(history, b)
+	}
+
+	return history, nil
+}
+
+// GetBallots returns the current choice of every voter in the poll, which for
+// ranked polls are the ballots in order of preference
+func (rs *RedisStore) GetBallots(ctx context.Context, pollID string) ([][]string, error) {
+	ckey := rs.pollKey(pollID, "choices")
+
+	choices, err := rs.client.HVals(ctx, ckey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting choices from redis: %v", err)
+	}
+
+	ballots := make([][]string, 0, len(choices))
+	for _, c := range choices {
+		b, err := decodeChoice(c)
+		if err != nil {
+			return nil, err
+		}
+		ballots = append(ballots, b)
+	}
+
+	return ballots, nil
+}
+
+func (rs *RedisStore) GetVote(ctx context.Context, pollID, userID string) (StoredVote, bool, error) {
+	pipe := rs.client.Pipeline()
+	choiceCmd := pipe.HGet(ctx, rs.pollKey(pollID, "choices"), userID)
+	weightCmd := pipe.HGet(ctx, rs.pollKey(pollID, "weights"), userID)
+	castAtCmd := pipe.HGet(ctx, rs.pollKey(pollID, "cast_at"), userID)
+	metadataCmd := pipe.HGet(ctx, rs.pollKey(pollID, "metadata"), userID)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return StoredVote{}, false, fmt.Errorf("error getting vote from redis: %v", err)
+	}
+
+	choice, err := choiceCmd.Result()
+	if errors.Is(err, redis.Nil) {
+		return StoredVote{}, false, nil
+	}
+	v := StoredVote{UserID: userID, Weight: 1}
+	if v.OptionIDs, err = decodeChoice(choice); err != nil {
+		return StoredVote{}, false, err
+	}
+
+	// votes cast before weights and timestamps were kept have neither
+	if w, err := weightCmd.Float64(); err == nil {
+		v.Weight = w
+	}
+	if nanos, err := castAtCmd.Int64(); err == nil {
+		v.CastAt = time.Unix(0, nanos).UTC()
+	}
+	if b, err := metadataCmd.Bytes(); err == nil {
+		if err := json.Unmarshal(b, &v.Metadata); err != nil {
+			return StoredVote{}, false, fmt.Errorf("error unmarshalling vote metadata: %v", err)
+		}
+	}
+	return v, true, nil
+}
+
+func (rs *RedisStore) ListVotes(ctx context.Context, pollID string) ([]StoredVote, error) {
+	pipe := rs.client.Pipeline()
+	choicesCmd := pipe.HGetAll(ctx, rs.pollKey(pollID, "choices"))
+	weightsCmd := pipe.HGetAll(ctx, rs.pollKey(pollID, "weights"))
+	castAtCmd := pipe.HGetAll(ctx, rs.pollKey(pollID, "cast_at"))
+	metadataCmd := pipe.HGetAll(ctx, rs.pollKey(pollID, "metadata"))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("error listing votes from redis: %v", err)
+	}
+
+	weights, castAt, metadata := weightsCmd.Val(), castAtCmd.Val(), metadataCmd.Val()
+	votes := make([]StoredVote, 0, len(choicesCmd.Val()))
+	for userID, choice := range choicesCmd.Val() {
+		v := StoredVote{UserID: userID, Weight: 1}
+		var err error
+		if v.OptionIDs, err = decodeChoice(choice); err != nil {
+			return nil, err
+		}
+		if w, err := strconv.ParseFloat(weights[userID], 64); err == nil {
+			v.Weight = w
+		}
+		if nanos, err := strconv.ParseInt(castAt[userID], 10, 64); err == nil {
+			v.CastAt = time.Unix(0, nanos).UTC()
+		}
+		if m, ok := metadata[userID]; ok {
+			if err := json.Unmarshal([]byte(m), &v.Metadata); err != nil {
+				return nil, fmt.Errorf("error unmarshalling vote metadata: %v", err)
+			}
+		}
+		votes = append(votes, v)
+	}
+	return votes, nil
+}
+
+// deletedSettingsTTL is how long a deleted poll's settings are kept, so the
+// late votes it still gets are turned away as closed
+const deletedSettingsTTL = 30 * 24 * time.Hour
+
+/*
+DeletePoll deletes every key of the poll by name: the fixed ones and the
+history buckets its history index points to. They all share the poll's hash
+tag, so a single DEL takes them even in a cluster. The settings aren't
+deleted but expire after deletedSettingsTTL, unless they're saved again.
+
+The poll index is in another slot than the poll's keys, so its last vote time
+is checked before the DEL rather than with it, and only to the second the
+index keeps.
+*/
+func (rs *RedisStore) DeletePoll(ctx context.Context, pollID string, lastVoteAt time.Time) (int, error) {
+	p, ok, err := rs.GetPoll(ctx, pollID)
+	if err != nil {
+		return 0, err
+	}
+	if !ok || p.LastVoteAt.Unix() != lastVoteAt.Unix() {
+		return 0, ErrPollChanged
+	}
+
+	starts, err := rs.client.ZRange(ctx, rs.pollKey(pollID, "history"), 0, -1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error getting history index from redis: %v", err)
+	}
+
+	keys := make([]string, 0, 9+len(starts))
+	for _, name := range []string{"votes", "results", "choices", "weights", "weighted", "history", "cast_at", "metadata", "applied_votes"} {
+		keys = append(keys, rs.pollKey(pollID, name))
+	}
+	for _, start := range starts {
+		keys = append(keys, rs.pollKey(pollID, "history:"+start))
+	}
+
+	n, err := rs.client.Del(ctx, keys...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error deleting poll %s from redis: %v", pollID, err)
+	}
+	if err := rs.client.Expire(ctx, rs.settingsKey(pollID), deletedSettingsTTL).Err(); err != nil {
+		return int(n), fmt.Errorf("error expiring settings of poll %s: %v", pollID, err)
+	}
+	if err := rs.client.ZRem(ctx, rs.pollsKey(), pollID).Err(); err != nil {
+		return int(n), fmt.Errorf("error removing poll %s from the poll index: %v", pollID, err)
+	}
+	return int(n), nil
+}
+
+func (rs *RedisStore) GetPollSettings(ctx context.Context, pollID string) (model.PollSettings, error) {
+	skey := rs.settingsKey(pollID)
+
+	var settings model.PollSettings
+	b, err := rs.client.Get(ctx, skey).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return settings, nil
+		}
+		return settings, fmt.Errorf("error getting poll settings from redis: %v", err)
+	}
+
+	if err := json.Unmarshal(b, &settings); err != nil {
+		return settings, fmt.Errorf("error unmarshalling poll settings: %v", err)
+	}
+	return settings, nil
+}
+
+func (rs *RedisStore) HasPollSettings(ctx context.Context, pollID string) (bool, error) {
+	n, err := rs.client.Exists(ctx, rs.settingsKey(pollID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("error checking poll settings in redis: %v", err)
+	}
+	return n > 0, nil
+}
+
+func (rs *RedisStore) SavePollSettings(ctx context.Context, pollID string, settings model.PollSettings) error {
+	skey := rs.settingsKey(pollID)
+
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("error marshalling poll settings: %v", err)
+	}
+
+	if err := rs.client.Set(ctx, skey, b, 0).Err(); err != nil {
+		return fmt.Errorf("error saving poll settings to redis: %v", err)
+	}
+	return nil
+}
+
+// GetVoterWeight looks a user up in the voter-weight table, shared by every poll
+func (rs *RedisStore) GetVoterWeight(ctx context.Context, userID string) (float64, bool, error) {
+	w, err := rs.client.HGet(ctx, rs.voterWeightsKey(), userID).Float64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("error getting voter weight from redis: %v", err)
+	}
+	return w, true, nil
+}
+
+func (rs *RedisStore) SetVoterWeight(ctx context.Context, userID string, weight float64) error {
+	if err := rs.client.HSet(ctx, rs.voterWeightsKey(), userID, weight).Err(); err != nil {
+		return fmt.Errorf("error saving voter weight to redis: %v", err)
+	}
+	return nil
+}
+
+/*
+recordVelocityScript keeps a sliding window as a sorted set of members scored
+by when they were last seen, and expires it once the window has gone by.
+
+KEYS[1] = velocity:{<key>}
+ARGV[1] = member, ARGV[2] = unix millis it was seen at, ARGV[3] = window in millis
+
+Returns how many members are in the window
+*/
+var recordVelocityScript = redis.NewScript(`
+local at = tonumber(ARGV[2])
+local prev = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not prev or tonumber(prev) < at then
+	redis.call('ZADD', KEYS[1], at, ARGV[1])
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', at - tonumber(ARGV[3]))
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return redis.call('ZCOUNT', KEYS[1], '(' .. (at - tonumber(ARGV[3])), at)
+`)
+
+func (rs *RedisStore) RecordVelocity(ctx context.Context, key, member string, at time.Time, window time.Duration) (int, error) {
+	n, err := recordVelocityScript.Run(ctx, rs.client, []string{rs.velocityKey(key)},
+		member, at.UnixMilli(), window.Milliseconds()).Int()
+	if err != nil {
+		return 0, fmt.Errorf("error recording velocity in redis: %v", err)
+	}
+	return n, nil
+}
+
+func (rs *RedisStore) QuarantineVote(ctx context.Context, q QuarantinedVote) error {
+	b, err := json.Marshal(q)
+	if err != nil {
+		return fmt.Errorf("error marshalling quarantined vote: %v", err)
+	}
+	if err := rs.client.HSet(ctx, rs.quarantineKey("votes"), q.ID, b).Err(); err != nil {
+		return fmt.Errorf("error quarantining vote in redis: %v", err)
+	}
+	return nil
+}
+
+func (rs *RedisStore) ListQuarantined(ctx context.Context, pollID string) ([]QuarantinedVote, error) {
+	raw, err := rs.client.HVals(ctx, rs.quarantineKey("votes")).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error listing quarantined votes from redis: %v", err)
+	}
+
+	held := make([]QuarantinedVote, 0, len(raw))
+	for _, r := range raw {
+		var q QuarantinedVote
+		if err := json.Unmarshal([]byte(r), &q); err != nil {
+			return nil, fmt.Errorf("error unmarshalling quarantined vote: %v", err)
+		}
+		if pollID == "" || q.Vote.PollID == pollID {
+			held = append(held, q)
+		}
+	}
+	slices.SortFunc(held, func(a, b QuarantinedVote) int { return a.QuarantinedAt.Compare(b.QuarantinedAt) })
+	return held, nil
+}
+
+func (rs *RedisStore) GetQuarantined(ctx context.Context, id string) (QuarantinedVote, bool, error) {
+	b, err := rs.client.HGet(ctx, rs.quarantineKey("votes"), id).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return QuarantinedVote{}, false, nil
+		}
+		return QuarantinedVote{}, false, fmt.Errorf("error getting quarantined vote from redis: %v", err)
+	}
+
+	var q QuarantinedVote
+	if err := json.Unmarshal(b, &q); err != nil {
+		return QuarantinedVote{}, false, fmt.Errorf("error unmarshalling quarantined vote: %v", err)
+	}
+	return q, true, nil
+}
+
+/*
+resolveQuarantinedScript releases a held vote and appends the decision to the
+audit log, unless the vote was already released.
+
+KEYS[1] = {quarantine}:votes (id -> JSON QuarantinedVote)
+KEYS[2] = {quarantine}:audit (list of JSON ReviewRecords, oldest first)
+ARGV[1] = id, ARGV[2] = JSON ReviewRecord
+
+Returns 1 if the vote was held
+*/
+var resolveQuarantinedScript = redis.NewScript(`
+if redis.call('HDEL', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('RPUSH', KEYS[2], ARGV[2])
+return 1
+`)
+
+func (rs *RedisStore) ResolveQuarantined(ctx context.Context, rec ReviewRecord) (bool, error) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return false, fmt.Errorf("error marshalling review record: %v", err)
+	}
+	keys := []string{rs.quarantineKey("votes"), rs.quarantineKey("audit")}
+	n, err := resolveQuarantinedScript.Run(ctx, rs.client, keys, rec.VoteID, b).Int()
+	if err != nil {
+		return false, fmt.Errorf("error resolving quarantined vote in redis: %v", err)
+	}
+	return n == 1, nil
+}
+
+func (rs *RedisStore) ListReviews(ctx context.Context, pollID string) ([]ReviewRecord, error) {
+	raw, err := rs.client.LRange(ctx, rs.quarantineKey("audit"), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error listing review records from redis: %v", err)
+	}
+
+	records := make([]ReviewRecord, 0, len(raw))
+	for _, r := range raw {
+		var rec ReviewRecord
+		if err := json.Unmarshal([]byte(r), &rec); err != nil {
+			return nil, fmt.Errorf("error unmarshalling review record: %v", err)
+		}
+		if pollID == "" || rec.PollID == pollID {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
+
+/*
+CheckTally recounts a poll from its choices and weights hashes in chunks of
+tallyCheckChunk voters, so even a big poll never holds Redis up for long. The
+poll's keys are watched meanwhile: a vote landing halfway through would make a
+recount that matches nothing, so when one does the check starts over, up to
+tallyCheckAttempts times. A repair is written in the same MULTI that confirms
+nothing changed, so it never overwrites a vote it didn't count.
+*/
+const (
+	tallyCheckChunk    = 500
+	tallyCheckAttempts = 3
+)
+
+func (rs *RedisStore) CheckTally(ctx context.Context, pollID string, repair bool) (TallyCheck, error) {
+	votesKey := rs.pollKey(pollID, "votes")
+	resultsKey := rs.pollKey(pollID, "results")
+	choicesKey := rs.pollKey(pollID, "choices")
+	settingsKey := rs.settingsKey(pollID)
+	weightsKey := rs.pollKey(pollID, "weights")
+	weightedKey := rs.pollKey(pollID, "weighted")
+
+	var check TallyCheck
+	fn := func(tx *redis.Tx) error {
+		check = newTallyCheck()
+
+		settings, err := tx.Get(ctx, settingsKey).Bytes()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return fmt.Errorf("error getting poll settings: %v", err)
+		}
+		var ps model.PollSettings
+		if settings != nil {
+			if err := json.Unmarshal(settings, &ps); err != nil {
+				return fmt.Errorf("error unmarshalling poll settings: %v", err)
+			}
+		}
+		ranked := ps.ModeOrDefault() == model.PollModeRanked
+
+		voters, err := tx.SCard(ctx, votesKey).Result()
+		if err != nil {
+			return fmt.Errorf("error counting voters: %v", err)
+		}
+		check.Voters = int(voters)
+
+		var cursor uint64
+		for {
+			// HSCAN returns field, value, field, value...
+			kv, next, err := tx.HScan(ctx, choicesKey, cursor, "*", tallyCheckChunk).Result()
+			if err != nil {
+				return fmt.Errorf("error scanning choices: %v", err)
+			}
+			if err := rs.recountChunk(ctx, tx, weightsKey, kv, ranked, &check); err != nil {
+				return err
+			}
+			if cursor = next; cursor == 0 {
+				break
+			}
+		}
+		dropZeroWeights(check.RecountWeight)
+
+		if err := readTally(ctx, tx, resultsKey, weightedKey, &check); err != nil {
+			return err
+		}
+
+		// the MULTI fails if any watched key changed since the WATCH
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if !repair || check.Matches() || !check.VotersMatch() {
+				pipe.Exists(ctx, votesKey)
+				return nil
+			}
+			pipe.Del(ctx, resultsKey, weightedKey)
+			for option, n := range check.Recount {
+				pipe.HSet(ctx, resultsKey, option, n)
+				pipe.HSet(ctx, weightedKey, option, strconv.FormatFloat(check.RecountWeight[option], 'f', -1, 64))
+			}
+			check.Repaired = true
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := rs.client.Watch(ctx, fn, votesKey, resultsKey, choicesKey, settingsKey, weightsKey, weightedKey)
+		if err == nil {
+			return check, nil
+		}
+		if !errors.Is(err, redis.TxFailedErr) {
+			return TallyCheck{}, fmt.Errorf("error checking tally in redis: %v", err)
+		}
+		if attempt == tallyCheckAttempts {
+			return TallyCheck{}, fmt.Errorf("error checking tally in redis: poll %s kept taking votes during %d checks", pollID, attempt)
+		}
+	}
+}
+
+// recountChunk adds a chunk of HSCAN's field, value pairs of the choices hash
+// to the recount, with the weights of its voters
+func (rs *RedisStore) recountChunk(ctx context.Context, tx *redis.Tx, weightsKey string, kv []string, ranked bool, check *TallyCheck) error {
+	if len(kv) == 0 {
+		return nil
+	}
+	users := make([]string, 0, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		users = append(users, kv[i])
+	}
+	weights, err := tx.HMGet(ctx, weightsKey, users...).Result()
+	if err != nil {
+		return fmt.Errorf("error getting voter weights: %v", err)
+	}
+
+	for i := 0; i < len(kv); i += 2 {
+		choice, err := decodeChoice(kv[i+1])
+		if err != nil {
+			return err
+		}
+		weight := 1.0
+		if w, ok := weights[i/2].(string); ok {
+			if weight, err = strconv.ParseFloat(w, 64); err != nil {
+				return fmt.Errorf("error parsing weight of UserID %s: %v", kv[i], err)
+			}
+		}
+
+		check.Ballots++
+		for j, option := range choice {
+			if ranked && j > 0 {
+				break
+			}
+			check.Recount[option]++
+			check.RecountWeight[option] += weight
+		}
+	}
+	return nil
+}
+
+// readTally reads the stored tally and weighted tally into the check
+func readTally(ctx context.Context, tx *redis.Tx, resultsKey, weightedKey string, check *TallyCheck) error {
+	results, err := tx.HGetAll(ctx, resultsKey).Result()
+	if err != nil {
+		return fmt.Errorf("error getting results: %v", err)
+	}
+	for option, v := range results {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("error parsing count of option %s: %v", option, err)
+		}
+		if n != 0 {
+			check.Stored[option] = n
+		}
+	}
+
+	weighted, err := tx.HGetAll(ctx, weightedKey).Result()
+	if err != nil {
+		return fmt.Errorf("error getting weighted results: %v", err)
+	}
+	for option, v := range weighted {
+		w, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing weight of option %s: %v", option, err)
+		}
+		if w != 0 {
+			check.StoredWeight[option] = w
+		}
+	}
+	return nil
+}
+
+/*
+swapPollScript replaces the derived state of one poll with the state rebuilt
+in another namespace. Keys of both namespaces carry the same poll hash tag,
+so even in a cluster they share a slot and a single script can swap them
+atomically: readers see either the old or the new poll, never a mix of both.
+
+KEYS[1..ARGV[1]]   = live keys to delete
+KEYS[ARGV[1]+1..]  = pairs of rebuilt key, live key to rename it to
+*/
+var swapPollScript = redis.NewScript(`
+local n = tonumber(ARGV[1])
+for i = 1, n do
+	redis.call('DEL', KEYS[i])
+end
+for i = n + 1, #KEYS, 2 do
+	redis.call('RENAME', KEYS[i], KEYS[i + 1])
+end
+return #KEYS - n
+`)
+
+// SwapNamespace moves the derived state rebuilt under ns into this store's
+// key space, replacing it one poll at a time. Polls that weren't rebuilt are
+// left untouched. It returns the IDs of the polls that were swapped
+func (rs *RedisStore) SwapNamespace(ctx context.Context, ns string) ([]string, error) {
+	from := rs.WithNamespace(ns)
+
+	polls, err := from.ListPolls(ctx, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	swapped := make([]string, 0, len(polls))
+	for _, p := range polls {
+		live, err := rs.scanKeys(ctx, escapeGlob(rs.pollKey(p.PollID, ""))+"*")
+		if err != nil {
+			return swapped, err
+		}
+		rebuilt, err := rs.scanKeys(ctx, escapeGlob(from.pollKey(p.PollID, ""))+"*")
+		if err != nil {
+			return swapped, err
+		}
+
+		keys := make([]string, 0, len(live)+2*len(rebuilt))
+		for _, k := range live {
+			if k != rs.settingsKey(p.PollID) {
+				keys = append(keys, k)
+			}
+		}
+		toDelete := len(keys)
+		for _, k := range rebuilt {
+			keys = append(keys, k, rs.ns+strings.TrimPrefix(k, ns))
+		}
+
+		if err := swapPollScript.Run(ctx, rs.client, keys, toDelete).Err(); err != nil {
+			return swapped, fmt.Errorf("error swapping poll %s: %v", p.PollID, err)
+		}
+
+		// the poll index is shared by every poll, so it's updated outside the script
+		err = rs.client.ZAddGT(ctx, rs.pollsKey(), redis.Z{Score: float64(p.LastVoteAt.Unix()), Member: p.PollID}).Err()
+		if err != nil {
+			return swapped, fmt.Errorf("error updating poll index: %v", err)
+		}
+		swapped = append(swapped, p.PollID)
+	}
+
+	if err := rs.client.Del(ctx, from.pollsKey()).Err(); err != nil {
+		return swapped, fmt.Errorf("error deleting rebuilt poll index: %v", err)
+	}
+	return swapped, nil
+}
+
+// DropNamespace deletes every key under ns, returning how many were deleted
+func (rs *RedisStore) DropNamespace(ctx context.Context, ns string) (int, error) {
+	keys, err := rs.scanKeys(ctx, escapeGlob(ns)+"*")
+	if err != nil {
+		return 0, err
+	}
+
+	// keys of different polls can live in different cluster slots, so no multi-key DEL
+	for _, k := range keys {
+		if err := rs.client.Del(ctx, k).Err(); err != nil {
+			return 0, fmt.Errorf("error deleting key %s: %v", k, err)
+		}
+	}
+	return len(keys), nil
+}
+
+// scanKeys returns every key matching the pattern. A cluster spreads its keys
+// over the masters, so each of them is scanned
+func (rs *RedisStore) scanKeys(ctx context.Context, pattern string) ([]string, error) {
+	cc, ok := rs.client.(*redis.ClusterClient)
+	if !ok {
+		return scanNode(ctx, rs.client, pattern)
+	}
+
+	var mu sync.Mutex
+	var keys []string
+	err := cc.ForEachMaster(ctx, func(ctx context.Context, c *redis.Client) error {
+		k, err := scanNode(ctx, c, pattern)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		keys = append(keys, k...)
+		mu.Unlock()
+		return nil
+	})
+	return keys, err
+}
+
+func scanNode(ctx context.Context, c redis.Cmdable, pattern string) ([]string, error) {
+	var keys []string
+	iter := c.Scan(ctx, 0, pattern, 1000).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning redis keys: %v", err)
+	}
+	return keys, nil
+}
+
+// escapeGlob escapes the characters SCAN patterns treat as wildcards
+func escapeGlob(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+	return r.Replace(s)
+}
+
+// acquireLeaseScript sets the lease KEYS[1] to ARGV[1] for ARGV[2]
+// milliseconds, unless someone else holds it. Returns 1 when ARGV[1] holds it
+var acquireLeaseScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder and holder ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+func (rs *RedisStore) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	// leases are shared by every tenant and namespace
+	n, err := acquireLeaseScript.Run(ctx, rs.client, []string{"lease:" + name}, holder, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("error acquiring lease in redis: %v", err)
+	}
+	return n == 1, nil
+}
+
 func (rs *RedisStore) Close() error {
 	if err := rs.client.Close(); err != nil {
 		return fmt.Errorf("error closing redis client: %v", err)
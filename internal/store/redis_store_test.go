@@ -0,0 +1,167 @@
+package store_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store/storetest"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// TestRedisStore runs the suite against miniredis, which runs the Lua
+// scripts like Redis does
+func TestRedisStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.VoteStore {
+		mr := miniredis.RunT(t)
+		// miniredis only expires keys when it's told time went by
+		done := make(chan struct{})
+		t.Cleanup(func() { close(done) })
+		go func() {
+			ticker := time.NewTicker(10 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					mr.FastForward(10 * time.Millisecond)
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		s, err := store.NewRedisStore(context.Background(), "redis://"+mr.Addr()+"/0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+// TestRedisCheckTallyDrift edits the tallies behind the store's back, which
+// is the drift the reconciler is there to catch
+func TestRedisCheckTallyDrift(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	s, err := store.NewRedisStore(ctx, "redis://"+mr.Addr()+"/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, v := range []model.Vote{
+		{PollID: "p1", UserID: "u1", OptionID: "a", Weight: 2},
+		{PollID: "p1", UserID: "u2", OptionID: "a"},
+		{PollID: "p1", UserID: "u3", OptionID: "b"},
+	} {
+		if _, err := s.RegisterVote(ctx, v); err != nil {
+			t.Fatalf("RegisterVote: %v", err)
+		}
+	}
+
+	check := func(repair bool) store.TallyCheck {
+		t.Helper()
+		c, err := s.CheckTally(ctx, "p1", repair)
+		if err != nil {
+			t.Fatalf("CheckTally: %v", err)
+		}
+		return c
+	}
+
+	// only the weights are off
+	mr.HSet("poll:{p1}:weighted", "a", "7")
+	c := check(false)
+	if !c.TallyMatches() || c.WeightsMatch() || c.Repaired {
+		t.Fatalf("CheckTally = %+v, want only the weights to drift", c)
+	}
+
+	mr.HSet("poll:{p1}:results", "b", "5")
+	c = check(true)
+	if c.Matches() || !c.Repaired {
+		t.Fatalf("CheckTally = %+v, want drift that got repaired", c)
+	}
+
+	c = check(false)
+	if !c.Matches() || c.Repaired {
+		t.Fatalf("CheckTally after the repair = %+v, want tallies that add up", c)
+	}
+	if c.StoredWeight["a"] != 3 || c.Stored["b"] != 1 {
+		t.Fatalf("CheckTally after the repair = %+v, want a weighing 3 and b counting 1", c)
+	}
+}
+
+func TestRedisHashTagMigration(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	mr.HSet("poll:p1:results", "a", "2")
+	mr.SAdd("poll:p1:votes", "u1", "u2")
+	addr := "redis://" + mr.Addr() + "/0"
+
+	// without the option nothing is touched
+	s, err := store.NewRedisStore(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if !mr.Exists("poll:p1:results") {
+		t.Fatal("legacy key migrated without WithHashTagMigration")
+	}
+
+	s, err = store.NewRedisStore(ctx, addr, store.WithHashTagMigration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if mr.Exists("poll:p1:results") || mr.Exists("poll:p1:votes") {
+		t.Fatal("legacy keys left behind")
+	}
+	results, err := s.GetResults(ctx, "p1")
+	if err != nil || results["a"] != 2 {
+		t.Fatalf("GetResults after the migration = %v, %v, want a: 2", results, err)
+	}
+}
+
+func TestRedisDeletePollKeys(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	s, err := store.NewRedisStore(ctx, "redis://"+mr.Addr()+"/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.SavePollSettings(ctx, "p1", model.PollSettings{}); err != nil {
+		t.Fatalf("SavePollSettings: %v", err)
+	}
+	for _, v := range []model.Vote{
+		{VoteID: "v1", PollID: "p1", UserID: "u1", OptionID: "a", Timestamp: time.Now(), Metadata: model.VoteMetadata{Channel: "web"}},
+		{VoteID: "v2", PollID: "p1", UserID: "u2", OptionID: "b", Timestamp: time.Now().Add(-time.Hour)},
+		{PollID: "p2", UserID: "u1", OptionID: "a"},
+	} {
+		if _, err := s.RegisterVote(ctx, v); err != nil {
+			t.Fatalf("RegisterVote: %v", err)
+		}
+	}
+
+	p, _, err := s.GetPoll(ctx, "p1")
+	if err != nil {
+		t.Fatalf("GetPoll: %v", err)
+	}
+	if _, err := s.DeletePoll(ctx, "p1", p.LastVoteAt); err != nil {
+		t.Fatalf("DeletePoll: %v", err)
+	}
+	for _, k := range mr.Keys() {
+		if strings.HasPrefix(k, "poll:{p1}:") && k != "poll:{p1}:settings" {
+			t.Errorf("DeletePoll left %s behind", k)
+		}
+	}
+	if ttl := mr.TTL("poll:{p1}:settings"); ttl <= 0 {
+		t.Errorf("settings of a deleted poll have no expiry")
+	}
+	if !mr.Exists("poll:{p2}:votes") {
+		t.Error("DeletePoll deleted another poll's keys")
+	}
+}
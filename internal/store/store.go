@@ -2,12 +2,271 @@ package store
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"time"
 
 	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
 )
 
+// VoteOutcome describes what RegisterVote did with a vote
+type VoteOutcome string
+
+const (
+	// VoteCounted is the user's first vote in the poll
+	VoteCounted VoteOutcome = "counted"
+	// VoteDuplicate is a cast from a user that already voted, or a vote reusing
+	// the ID of one that was for another user or selection
+	VoteDuplicate VoteOutcome = "duplicate"
+	// VoteChanged moved the user's vote from PreviousOptionIDs to the new options
+	VoteChanged VoteOutcome = "changed"
+	// VoteUnchanged is a change to the options the user already had
+	VoteUnchanged VoteOutcome = "unchanged"
+	// VoteRetracted removed the user's vote from the tally
+	VoteRetracted VoteOutcome = "retracted"
+	// VoteNotFound is a change or retraction from a user with no current vote
+	VoteNotFound VoteOutcome = "not_found"
+	// VoteReplayed is another copy of a vote the store already applied, same
+	// ID, user, kind and options; it changed nothing. Copies of a vote that
+	// came back VoteDuplicate or VoteNotFound come back that way again
+	VoteReplayed VoteOutcome = "replayed"
+)
+
+type VoteResult struct {
+	Outcome           VoteOutcome
+	PreviousOptionIDs []string
+}
+
+// voteCopyKey is what a vote ID was first applied to, compared to tell a
+// copy of the vote from another vote reusing its ID. The weight is left out,
+// it's looked up again for every copy and may have changed in between
+func voteCopyKey(vote model.Vote) (string, error) {
+	options := vote.Options()
+	if options == nil {
+		options = []string{}
+	}
+	b, err := json.Marshal([]any{vote.KindOrDefault(), vote.UserID, options})
+	if err != nil {
+		return "", fmt.Errorf("error marshalling vote copy key: %v", err)
+	}
+	return string(b), nil
+}
+
+// appliedVoteID is what a store keeps for a vote ID once the vote's outcome
+// is known: its copy key, behind the outcome when the vote was rejected
+func appliedVoteID(outcome VoteOutcome, copyKey string) string {
+	if outcome == VoteDuplicate || outcome == VoteNotFound {
+		return string(outcome) + ":" + copyKey
+	}
+	return copyKey
+}
+
+// replayOutcome is what a vote comes back as when its ID was already applied,
+// given what the store kept for the ID
+func replayOutcome(first, copyKey string) VoteOutcome {
+	switch first {
+	case copyKey:
+		return VoteReplayed
+	case appliedVoteID(VoteDuplicate, copyKey):
+		return VoteDuplicate
+	case appliedVoteID(VoteNotFound, copyKey):
+		return VoteNotFound
+	}
+	return VoteDuplicate
+}
+
+// ErrPollChanged is returned by DeletePoll for a poll that was voted in, or
+// deleted, since its last vote time was read
+var ErrPollChanged = errors.New("poll changed since it was read")
+
+// PollInfo is what the store knows about a poll without reading its tally
+type PollInfo struct {
+	PollID     string    `json:"poll_id"`
+	LastVoteAt time.Time `json:"last_vote_at"`
+}
+
+// StoredVote is a user's current vote in a poll, as the store keeps it
+type StoredVote struct {
+	UserID    string   `json:"user_id"`
+	OptionIDs []string `json:"option_ids"`
+	Weight    float64  `json:"weight"`
+	// CastAt is zero for votes stored before their time was kept
+	CastAt time.Time `json:"cast_at,omitzero"`
+	// Metadata is where the vote came from, empty when ingestion didn't say
+	Metadata model.VoteMetadata `json:"metadata,omitzero"`
+}
+
+/*
+TallyCheck compares the tally a store keeps with a recount of its voters'
+current choices, both the vote counts and the weighted tally. All of them only
+hold options with a non-zero count or weight.
+
+Voters is the number of users that currently have a vote, and Ballots the
+number of them with a stored choice. They only differ for voters whose choice
+was never recorded, which a recount can't bring back.
+*/
+type TallyCheck struct {
+	Voters        int
+	Ballots       int
+	Stored        map[string]int
+	Recount       map[string]int
+	StoredWeight  map[string]float64
+	RecountWeight map[string]float64
+	Repaired      bool
+}
+
+func newTallyCheck() TallyCheck {
+	return TallyCheck{
+		Stored:        make(map[string]int),
+		Recount:       make(map[string]int),
+		StoredWeight:  make(map[string]float64),
+		RecountWeight: make(map[string]float64),
+	}
+}
+
+// VotersMatch reports whether every voter has a stored choice
+func (c TallyCheck) VotersMatch() bool {
+	return c.Voters == c.Ballots
+}
+
+// TallyMatches reports whether the stored tally is what the choices add up to
+func (c TallyCheck) TallyMatches() bool {
+	return maps.Equal(c.Stored, c.Recount)
+}
+
+// WeightsMatch reports whether the stored weighted tally is what the choices
+// and their weights add up to. The sums are floats added up in whatever order
+// the votes came in, so they only have to be close
+func (c TallyCheck) WeightsMatch() bool {
+	if len(c.StoredWeight) != len(c.RecountWeight) {
+		return false
+	}
+	for option, stored := range c.StoredWeight {
+		recount, ok := c.RecountWeight[option]
+		if !ok || math.Abs(stored-recount) > 1e-9*max(1, math.Abs(stored), math.Abs(recount)) {
+			return false
+		}
+	}
+	return true
+}
+
+// dropZeroWeights takes the options whose weights add up to nothing out of a
+// recount, like the stored tallies leave them out
+func dropZeroWeights(weights map[string]float64) {
+	maps.DeleteFunc(weights, func(_ string, w float64) bool { return w == 0 })
+}
+
+// Matches reports whether both the tally and the weighted tally add up
+func (c TallyCheck) Matches() bool {
+	return c.TallyMatches() && c.WeightsMatch()
+}
+
+// QuarantinedVote is a flagged vote held out of the tally until someone reviews it
+type QuarantinedVote struct {
+	ID            string     `json:"id"`
+	Vote          model.Vote `json:"vote"`
+	QuarantinedAt time.Time  `json:"quarantined_at"`
+}
+
+type ReviewDecision string
+
+const (
+	ReviewApproved ReviewDecision = "approved"
+	ReviewRejected ReviewDecision = "rejected"
+)
+
+// ReviewRecord is the audit record of a decision on a quarantined vote
+type ReviewRecord struct {
+	VoteID   string         `json:"vote_id"`
+	PollID   string         `json:"poll_id"`
+	UserID   string         `json:"user_id"`
+	Flags    []string       `json:"flags,omitempty"`
+	Decision ReviewDecision `json:"decision"`
+	Reviewer string         `json:"reviewer"`
+	Note     string         `json:"note,omitempty"`
+	// Outcome is what counting an approved vote did. The decision is recorded
+	// before the vote is counted, so only the answer to the reviewer has it
+	Outcome   VoteOutcome `json:"outcome,omitempty"`
+	DecidedAt time.Time   `json:"decided_at"`
+}
+
 type VoteStore interface {
-	RegisterVote(ctx context.Context, vote model.Vote) (bool, error)
+	// ForTenant returns the store scoped to a tenant: its polls, voters, settings
+	// and voter weights, apart from every other tenant's. The store itself is
+	// scoped to the default tenant, whose ID is empty and which holds the data
+	// from before tenants existed. Closing any scope closes the whole store
+	ForTenant(tenantID string) VoteStore
+	// RegisterVote applies a vote. A vote with a VoteID is applied once: the
+	// store keeps the poll's vote IDs until the poll is deleted, and their
+	// copies come back as VoteReplayed, or rejected again when the first copy
+	// was, so a consumer that died before it published the rejection still
+	// gets to. Only a vote matching the first copy is one of its copies,
+	// anything else reusing the ID comes back as VoteDuplicate
+	RegisterVote(ctx context.Context, vote model.Vote) (VoteResult, error)
 	GetResults(ctx context.Context, pollID string) (map[string]int, error)
+	// ListPolls returns every poll with a vote received since activeSince, most
+	// recently voted first. A zero activeSince lists every poll the store knows
+	// about. A poll's LastVoteAt goes by Vote.ReceivedAt, not the producer's time
+	ListPolls(ctx context.Context, activeSince time.Time) ([]PollInfo, error)
+	// GetPoll reports false for a poll that never received a vote
+	GetPoll(ctx context.Context, pollID string) (PollInfo, bool, error)
+	// CountVoters returns how many users currently have a vote in the poll
+	CountVoters(ctx context.Context, pollID string) (int, error)
+	// CountVotersIn is CountVoters for several polls in one go. Polls without
+	// votes count 0
+	CountVotersIn(ctx context.Context, pollIDs []string) (map[string]int, error)
+	GetWeightedResults(ctx context.Context, pollID string) (map[string]float64, error)
+	GetHistory(ctx context.Context, pollID string, from, to time.Time) ([]model.HistoryBucket, error)
+	GetBallots(ctx context.Context, pollID string) ([][]string, error)
+	// GetVote reports false when the user has no current vote in the poll
+	GetVote(ctx context.Context, pollID, userID string) (StoredVote, bool, error)
+	// ListVotes returns every user's current vote in the poll
+	ListVotes(ctx context.Context, pollID string) ([]StoredVote, error)
+	// CheckTally recounts a poll from its voters' choices and compares it with the
+	// stored tally and weighted tally. With repair set, tallies that don't match
+	// are rewritten from the recount, unless some voter has no stored choice.
+	// History is never rewritten
+	CheckTally(ctx context.Context, pollID string, repair bool) (TallyCheck, error)
+	// DeletePoll drops a poll's votes, tally and history and takes it out of the
+	// poll index, returning how many keys (or rows) it removed. The settings
+	// stay, so a closed poll stays closed and late votes are still turned away;
+	// Redis only keeps them for another 30 days. It deletes nothing and returns
+	// ErrPollChanged unless the poll's last vote is still at lastVoteAt, as
+	// GetPoll or ListPolls had it
+	DeletePoll(ctx context.Context, pollID string, lastVoteAt time.Time) (int, error)
+	GetPollSettings(ctx context.Context, pollID string) (model.PollSettings, error)
+	// HasPollSettings reports whether the poll's settings were ever saved, which
+	// GetPollSettings can't tell apart from saved defaults
+	HasPollSettings(ctx context.Context, pollID string) (bool, error)
+	SavePollSettings(ctx context.Context, pollID string, settings model.PollSettings) error
+	// GetVoterWeight reports false when the user has no entry in the voter-weight table
+	GetVoterWeight(ctx context.Context, userID string) (float64, bool, error)
+	SetVoterWeight(ctx context.Context, userID string, weight float64) error
+	// RecordVelocity notes member under key at the given time and returns how
+	// many distinct members the key has in the window ending then. Seeing a
+	// member again only moves its time, and older members are dropped
+	RecordVelocity(ctx context.Context, key, member string, at time.Time, window time.Duration) (int, error)
+	// QuarantineVote holds a vote for review, replacing any held under the same ID
+	QuarantineVote(ctx context.Context, q QuarantinedVote) error
+	// ListQuarantined returns the votes held for review in a poll, or in every
+	// poll when pollID is empty, oldest first
+	ListQuarantined(ctx context.Context, pollID string) ([]QuarantinedVote, error)
+	// GetQuarantined reports false when no vote is held under the ID
+	GetQuarantined(ctx context.Context, id string) (QuarantinedVote, bool, error)
+	// ResolveQuarantined releases a held vote and keeps the record of the
+	// decision, both at once. It reports false, and records nothing, when no
+	// vote is held under the record's VoteID anymore
+	ResolveQuarantined(ctx context.Context, rec ReviewRecord) (bool, error)
+	// ListReviews returns the review records of a poll, or of every poll when
+	// pollID is empty, oldest first. They're kept even after the poll is deleted
+	ListReviews(ctx context.Context, pollID string) ([]ReviewRecord, error)
+	// AcquireLease takes the named lease for holder, or extends it when holder
+	// already has it, until ttl from now. It reports false while someone else
+	// holds it. Leases belong to no tenant, they're for jobs only one consumer
+	// should run, like the reconciler
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
 	Close() error
 }
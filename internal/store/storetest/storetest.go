@@ -0,0 +1,772 @@
+/*
+Package storetest is the behavioural test suite every store.VoteStore
+implementation has to pass. A backend runs it from its own test file:
+
+	func TestBoltStore(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) store.VoteStore {
+			s, err := store.NewBoltStore(filepath.Join(t.TempDir(), "votes.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		})
+	}
+
+newStore is called once per test and the suite closes the store itself.
+Every test uses its own poll IDs, so backends that can't be wiped between
+tests (a shared Redis or Postgres) still get independent tests.
+*/
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/model"
+	"github.com/Guizzs26/real_time_voting_analysis_system/internal/store"
+)
+
+// Run runs the whole suite against the stores built by newStore
+func Run(t *testing.T, newStore func(t *testing.T) store.VoteStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.VoteStore, pollID string)
+	}{
+		{"Dedupe", testDedupe},
+		{"VoteIDs", testVoteIDs},
+		{"ConcurrentRegistration", testConcurrentRegistration},
+		{"Results", testResults},
+		{"ChangeAndRetract", testChangeAndRetract},
+		{"MultiChoice", testMultiChoice},
+		{"RankedTalliesFirstPreference", testRanked},
+		{"Weights", testWeights},
+		{"History", testHistory},
+		{"PollIndex", testPollIndex},
+		{"PollSettings", testPollSettings},
+		{"GetVote", testGetVote},
+		{"TallyCheck", testTallyCheck},
+		{"TenantIsolation", testTenantIsolation},
+		{"DeletePoll", testDeletePoll},
+		{"UnknownPoll", testUnknownPoll},
+		{"Velocity", testVelocity},
+		{"Quarantine", testQuarantine},
+		{"Lease", testLease},
+		{"ContextCancellation", testContextCancellation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStore(t)
+			t.Cleanup(func() { s.Close() })
+			tt.fn(t, s, fmt.Sprintf("storetest-%s-%d", tt.name, time.Now().UnixNano()))
+		})
+	}
+
+	t.Run("Close", func(t *testing.T) {
+		testClose(t, newStore(t))
+	})
+}
+
+func register(t *testing.T, s store.VoteStore, v model.Vote, want store.VoteOutcome) store.VoteResult {
+	t.Helper()
+	res, err := s.RegisterVote(context.Background(), v)
+	if err != nil {
+		t.Fatalf("RegisterVote(%+v): %v", v, err)
+	}
+	if res.Outcome != want {
+		t.Fatalf("RegisterVote(%+v) outcome = %q, want %q", v, res.Outcome, want)
+	}
+	return res
+}
+
+func assertResults(t *testing.T, s store.VoteStore, pollID string, want map[string]int) {
+	t.Helper()
+	got, err := s.GetResults(context.Background(), pollID)
+	if err != nil {
+		t.Fatalf("GetResults: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("GetResults = %v, want %v", got, want)
+	}
+	for option, count := range want {
+		if got[option] != count {
+			t.Fatalf("GetResults = %v, want %v", got, want)
+		}
+	}
+}
+
+func assertVoters(t *testing.T, s store.VoteStore, pollID string, want int) {
+	t.Helper()
+	got, err := s.CountVoters(context.Background(), pollID)
+	if err != nil {
+		t.Fatalf("CountVoters: %v", err)
+	}
+	if got != want {
+		t.Fatalf("CountVoters = %d, want %d", got, want)
+	}
+
+	// the batched count has to agree, and count 0 for a poll nobody voted in
+	counts, err := s.CountVotersIn(context.Background(), []string{pollID, pollID + "-none"})
+	if err != nil {
+		t.Fatalf("CountVotersIn: %v", err)
+	}
+	if counts[pollID] != want || counts[pollID+"-none"] != 0 || len(counts) != 2 {
+		t.Fatalf("CountVotersIn = %v, want %s: %d and %s-none: 0", counts, pollID, want, pollID)
+	}
+}
+
+func testDedupe(t *testing.T, s store.VoteStore, pollID string) {
+	register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionID: "a"}, store.VoteCounted)
+
+	res := register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionID: "b"}, store.VoteDuplicate)
+	if !slices.Equal(res.PreviousOptionIDs, []string{"a"}) {
+		t.Fatalf("duplicate PreviousOptionIDs = %v, want [a]", res.PreviousOptionIDs)
+	}
+
+	// the same user is a different voter in another poll
+	register(t, s, model.Vote{PollID: pollID + "-other", UserID: "u1", OptionID: "a"}, store.VoteCounted)
+
+	assertResults(t, s, pollID, map[string]int{"a": 1})
+	assertVoters(t, s, pollID, 1)
+}
+
+func testVoteIDs(t *testing.T, s store.VoteStore, pollID string) {
+	ctx := context.Background()
+	if err := s.SavePollSettings(ctx, pollID, model.PollSettings{AllowVoteChanges: true}); err != nil {
+		t.Fatalf("SavePollSettings: %v", err)
+	}
+
+	register(t, s, model.Vote{VoteID: "v1", PollID: pollID, UserID: "u1", OptionID: "a"}, store.VoteCounted)
+	// a retry's copy changes nothing, a new submission from the same user is a
+	// duplicate, and so are its copies, in case the first one's rejection was lost
+	register(t, s, model.Vote{VoteID: "v1", PollID: pollID, UserID: "u1", OptionID: "a"}, store.VoteReplayed)
+	register(t, s, model.Vote{VoteID: "v2", PollID: pollID, UserID: "u1", OptionID: "b"}, store.VoteDuplicate)
+	register(t, s, model.Vote{VoteID: "v2", PollID: pollID, UserID: "u1", OptionID: "b"}, store.VoteDuplicate)
+	register(t, s, model.Vote{VoteID: "v5", PollID: pollID, UserID: "u3", Kind: model.VoteKindRetract}, store.VoteNotFound)
+	register(t, s, model.Vote{VoteID: "v5", PollID: pollID, UserID: "u3", Kind: model.VoteKindRetract}, store.VoteNotFound)
+
+	register(t, s, model.Vote{VoteID: "v3", PollID: pollID, UserID: "u1", OptionID: "b", Kind: model.VoteKindChange}, store.VoteChanged)
+	register(t, s, model.Vote{VoteID: "v3", PollID: pollID, UserID: "u1", OptionID: "b", Kind: model.VoteKindChange}, store.VoteReplayed)
+	assertResults(t, s, pollID, map[string]int{"b": 1})
+
+	// reusing an ID for another user or selection isn't a copy of the first vote
+	register(t, s, model.Vote{VoteID: "v1", PollID: pollID, UserID: "u2", OptionID: "a"}, store.VoteDuplicate)
+	register(t, s, model.Vote{VoteID: "v3", PollID: pollID, UserID: "u1", OptionID: "a", Kind: model.VoteKindChange}, store.VoteDuplicate)
+	register(t, s, model.Vote{VoteID: "v3", PollID: pollID, UserID: "u1", Kind: model.VoteKindRetract}, store.VoteDuplicate)
+	register(t, s, model.Vote{VoteID: "v4", PollID: pollID, UserID: "u2", OptionID: "a"}, store.VoteCounted)
+	assertResults(t, s, pollID, map[string]int{"a": 1, "b": 1})
+
+	// vote IDs are per poll
+	register(t, s, model.Vote{VoteID: "v1", PollID: pollID + "-other", UserID: "u1", OptionID: "a"}, store.VoteCounted)
+}
+
+func testConcurrentRegistration(t *testing.T, s store.VoteStore, pollID string) {
+	const users, copies = 20, 5
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	outcomes := make(map[store.VoteOutcome]int)
+	for i := 0; i < users*copies; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user := i % users
+			res, err := s.RegisterVote(context.Background(), model.Vote{
+				PollID:   pollID,
+				UserID:   fmt.Sprintf("user-%d", user),
+				OptionID: fmt.Sprintf("option-%d", user%2),
+			})
+			if err != nil {
+				t.Errorf("RegisterVote: %v", err)
+				return
+			}
+			mu.Lock()
+			outcomes[res.Outcome]++
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	if outcomes[store.VoteCounted] != users || outcomes[store.VoteDuplicate] != users*(copies-1) {
+		t.Fatalf("outcomes = %v, want %d counted and %d duplicates", outcomes, users, users*(copies-1))
+	}
+	assertResults(t, s, pollID, map[string]int{"option-0": users / 2, "option-1": users / 2})
+	assertVoters(t, s, pollID, users)
+}
+
+func testResults(t *testing.T, s store.VoteStore, pollID string) {
+	for i, option := range []string{"a", "a", "b", "a", "c"} {
+		register(t, s, model.Vote{PollID: pollID, UserID: fmt.Sprintf("u%d", i), OptionID: option}, store.VoteCounted)
+	}
+	assertResults(t, s, pollID, map[string]int{"a": 3, "b": 1, "c": 1})
+	assertVoters(t, s, pollID, 5)
+}
+
+func testChangeAndRetract(t *testing.T, s store.VoteStore, pollID string) {
+	register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionID: "a"}, store.VoteCounted)
+	register(t, s, model.Vote{PollID: pollID, UserID: "u2", OptionID: "a"}, store.VoteCounted)
+
+	res := register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionID: "b", Kind: model.VoteKindChange}, store.VoteChanged)
+	if !slices.Equal(res.PreviousOptionIDs, []string{"a"}) {
+		t.Fatalf("change PreviousOptionIDs = %v, want [a]", res.PreviousOptionIDs)
+	}
+	register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionID: "b", Kind: model.VoteKindChange}, store.VoteUnchanged)
+	assertResults(t, s, pollID, map[string]int{"a": 1, "b": 1})
+
+	register(t, s, model.Vote{PollID: pollID, UserID: "u2", Kind: model.VoteKindRetract}, store.VoteRetracted)
+	assertResults(t, s, pollID, map[string]int{"b": 1})
+	assertVoters(t, s, pollID, 1)
+
+	register(t, s, model.Vote{PollID: pollID, UserID: "u3", OptionID: "b", Kind: model.VoteKindChange}, store.VoteNotFound)
+	register(t, s, model.Vote{PollID: pollID, UserID: "u3", Kind: model.VoteKindRetract}, store.VoteNotFound)
+
+	// a retracted user can vote again
+	register(t, s, model.Vote{PollID: pollID, UserID: "u2", OptionID: "c"}, store.VoteCounted)
+	assertResults(t, s, pollID, map[string]int{"b": 1, "c": 1})
+}
+
+func testMultiChoice(t *testing.T, s store.VoteStore, pollID string) {
+	ctx := context.Background()
+	if err := s.SavePollSettings(ctx, pollID, model.PollSettings{Mode: model.PollModeApproval, AllowVoteChanges: true}); err != nil {
+		t.Fatalf("SavePollSettings: %v", err)
+	}
+
+	register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionIDs: []string{"a", "b"}}, store.VoteCounted)
+	register(t, s, model.Vote{PollID: pollID, UserID: "u2", OptionIDs: []string{"b", "c"}}, store.VoteCounted)
+	assertResults(t, s, pollID, map[string]int{"a": 1, "b": 2, "c": 1})
+
+	register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionIDs: []string{"c"}, Kind: model.VoteKindChange}, store.VoteChanged)
+	assertResults(t, s, pollID, map[string]int{"b": 1, "c": 2})
+	assertVoters(t, s, pollID, 2)
+}
+
+func testRanked(t *testing.T, s store.VoteStore, pollID string) {
+	ctx := context.Background()
+	if err := s.SavePollSettings(ctx, pollID, model.PollSettings{Mode: model.PollModeRanked}); err != nil {
+		t.Fatalf("SavePollSettings: %v", err)
+	}
+
+	register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionIDs: []string{"a", "b", "c"}}, store.VoteCounted)
+	register(t, s, model.Vote{PollID: pollID, UserID: "u2", OptionIDs: []string{"b", "a"}}, store.VoteCounted)
+	assertResults(t, s, pollID, map[string]int{"a": 1, "b": 1})
+
+	ballots, err := s.GetBallots(ctx, pollID)
+	if err != nil {
+		t.Fatalf("GetBallots: %v", err)
+	}
+	slices.SortFunc(ballots, slices.Compare)
+	if len(ballots) != 2 || !slices.Equal(ballots[0], []string{"a", "b", "c"}) || !slices.Equal(ballots[1], []string{"b", "a"}) {
+		t.Fatalf("GetBallots = %v, want the ballots in order of preference", ballots)
+	}
+}
+
+func testWeights(t *testing.T, s store.VoteStore, pollID string) {
+	ctx := context.Background()
+
+	register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionID: "a", Weight: 2.5}, store.VoteCounted)
+	register(t, s, model.Vote{PollID: pollID, UserID: "u2", OptionID: "a"}, store.VoteCounted)
+	register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionID: "b", Weight: 2.5, Kind: model.VoteKindChange}, store.VoteChanged)
+
+	got, err := s.GetWeightedResults(ctx, pollID)
+	if err != nil {
+		t.Fatalf("GetWeightedResults: %v", err)
+	}
+	if len(got) != 2 || got["a"] != 1 || got["b"] != 2.5 {
+		t.Fatalf("GetWeightedResults = %v, want map[a:1 b:2.5]", got)
+	}
+
+	user := pollID + "-voter"
+	if _, ok, err := s.GetVoterWeight(ctx, user); err != nil || ok {
+		t.Fatalf("GetVoterWeight of unknown voter = %v, %v, want false, nil", ok, err)
+	}
+	if err := s.SetVoterWeight(ctx, user, 10); err != nil {
+		t.Fatalf("SetVoterWeight: %v", err)
+	}
+	if w, ok, err := s.GetVoterWeight(ctx, user); err != nil || !ok || w != 10 {
+		t.Fatalf("GetVoterWeight = %v, %v, %v, want 10, true, nil", w, ok, err)
+	}
+}
+
+func testHistory(t *testing.T, s store.VoteStore, pollID string) {
+	now := time.Now()
+	register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionID: "a", Timestamp: now.Add(-5 * time.Minute)}, store.VoteCounted)
+	register(t, s, model.Vote{PollID: pollID, UserID: "u2", OptionID: "a", Timestamp: now}, store.VoteCounted)
+	register(t, s, model.Vote{PollID: pollID, UserID: "u3", OptionID: "b", Timestamp: now}, store.VoteCounted)
+
+	history, err := s.GetHistory(context.Background(), pollID, now.Add(-time.Hour), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("GetHistory returned %d buckets, want 2: %v", len(history), history)
+	}
+	if !history[0].Start.Before(history[1].Start) {
+		t.Fatalf("GetHistory buckets aren't oldest first: %v", history)
+	}
+	if history[0].Counts["a"] != 1 || history[1].Counts["a"] != 1 || history[1].Counts["b"] != 1 {
+		t.Fatalf("GetHistory = %v, want 1 a in the first bucket and 1 a and 1 b in the second", history)
+	}
+}
+
+func testPollIndex(t *testing.T, s store.VoteStore, pollID string) {
+	ctx := context.Background()
+	older, newer := pollID+"-older", pollID+"-newer"
+	now := time.Now()
+
+	// the index goes by when votes were received, whatever their producer says
+	register(t, s, model.Vote{PollID: older, UserID: "u1", OptionID: "a", Timestamp: now.Add(24 * time.Hour), ReceivedAt: now.Add(-2 * time.Hour)}, store.VoteCounted)
+	register(t, s, model.Vote{PollID: newer, UserID: "u1", OptionID: "a", Timestamp: now.Add(-24 * time.Hour), ReceivedAt: now}, store.VoteCounted)
+
+	// a poll with settings but no votes isn't listed
+	if err := s.SavePollSettings(ctx, pollID, model.PollSettings{AllowVoteChanges: true}); err != nil {
+		t.Fatalf("SavePollSettings: %v", err)
+	}
+	if _, ok, err := s.GetPoll(ctx, pollID); err != nil || ok {
+		t.Fatalf("GetPoll of a poll without votes = %v, %v, want false, nil", ok, err)
+	}
+
+	info, ok, err := s.GetPoll(ctx, newer)
+	if err != nil || !ok {
+		t.Fatalf("GetPoll = %v, %v, want true, nil", ok, err)
+	}
+	if d := info.LastVoteAt.Sub(now); d < -time.Second || d > time.Second {
+		t.Fatalf("GetPoll LastVoteAt = %v, want about %v", info.LastVoteAt, now)
+	}
+
+	polls, err := s.ListPolls(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("ListPolls: %v", err)
+	}
+	if !containsPoll(polls, newer) || containsPoll(polls, older) || containsPoll(polls, pollID) {
+		t.Fatalf("ListPolls(last hour) = %v, want %s and not %s", polls, newer, older)
+	}
+
+	polls, err = s.ListPolls(ctx, time.Time{})
+	if err != nil {
+		t.Fatalf("ListPolls: %v", err)
+	}
+	if !containsPoll(polls, newer) || !containsPoll(polls, older) {
+		t.Fatalf("ListPolls(all) = %v, want both %s and %s", polls, newer, older)
+	}
+	for i := 1; i < len(polls); i++ {
+		if polls[i].LastVoteAt.After(polls[i-1].LastVoteAt) {
+			t.Fatalf("ListPolls isn't most recent first: %v", polls)
+		}
+	}
+}
+
+func containsPoll(polls []store.PollInfo, pollID string) bool {
+	return slices.ContainsFunc(polls, func(p store.PollInfo) bool { return p.PollID == pollID })
+}
+
+func testPollSettings(t *testing.T, s store.VoteStore, pollID string) {
+	ctx := context.Background()
+
+	want := model.PollSettings{
+		AllowVoteChanges: true,
+		Mode:             model.PollModeUpToK,
+		MaxSelections:    2,
+		ClosesAt:         time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if err := s.SavePollSettings(ctx, pollID, want); err != nil {
+		t.Fatalf("SavePollSettings: %v", err)
+	}
+	got, err := s.GetPollSettings(ctx, pollID)
+	if err != nil {
+		t.Fatalf("GetPollSettings: %v", err)
+	}
+	if !got.ClosesAt.Equal(want.ClosesAt) {
+		t.Fatalf("GetPollSettings = %+v, want %+v", got, want)
+	}
+	got.ClosesAt = want.ClosesAt
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetPollSettings = %+v, want %+v", got, want)
+	}
+}
+
+func testGetVote(t *testing.T, s store.VoteStore, pollID string) {
+	ctx := context.Background()
+	if err := s.SavePollSettings(ctx, pollID, model.PollSettings{AllowVoteChanges: true}); err != nil {
+		t.Fatalf("SavePollSettings: %v", err)
+	}
+
+	// whole seconds, so backends that keep less than nanoseconds round-trip it
+	castAt := time.Now().Add(-time.Minute).Truncate(time.Second).UTC()
+	register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionID: "a", Weight: 2, Timestamp: castAt}, store.VoteCounted)
+
+	assertVote := func(userID string, wantOptions []string, wantWeight float64, wantCastAt time.Time) {
+		t.Helper()
+		v, ok, err := s.GetVote(ctx, pollID, userID)
+		if err != nil {
+			t.Fatalf("GetVote(%s): %v", userID, err)
+		}
+		if !ok {
+			t.Fatalf("GetVote(%s) found no vote", userID)
+		}
+		if v.UserID != userID || !slices.Equal(v.OptionIDs, wantOptions) || v.Weight != wantWeight || !v.CastAt.Equal(wantCastAt) {
+			t.Fatalf("GetVote(%s) = %+v, want options %v, weight %v, cast at %v", userID, v, wantOptions, wantWeight, wantCastAt)
+		}
+	}
+	assertVote("u1", []string{"a"}, 2, castAt)
+
+	changedAt := castAt.Add(30 * time.Second)
+	register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionID: "b", Weight: 2, Kind: model.VoteKindChange, Timestamp: changedAt}, store.VoteChanged)
+	assertVote("u1", []string{"b"}, 2, changedAt)
+
+	// the metadata is the current vote's, in GetVote and ListVotes alike
+	metadata := model.VoteMetadata{SourceIP: "10.0.0.1", Channel: "web", GeoBucket: "BR", Extra: map[string]string{"campaign": "spring"}}
+	register(t, s, model.Vote{PollID: pollID, UserID: "u2", OptionID: "a", Timestamp: castAt, Metadata: metadata}, store.VoteCounted)
+	if v, _, err := s.GetVote(ctx, pollID, "u2"); err != nil || !reflect.DeepEqual(v.Metadata, metadata) {
+		t.Fatalf("GetVote(u2).Metadata = %+v, %v, want %+v", v.Metadata, err, metadata)
+	}
+	votes, err := s.ListVotes(ctx, pollID)
+	if err != nil {
+		t.Fatalf("ListVotes: %v", err)
+	}
+	for _, v := range votes {
+		if want := map[string]model.VoteMetadata{"u2": metadata}[v.UserID]; !reflect.DeepEqual(v.Metadata, want) {
+			t.Fatalf("ListVotes metadata of %s = %+v, want %+v", v.UserID, v.Metadata, want)
+		}
+	}
+
+	register(t, s, model.Vote{PollID: pollID, UserID: "u1", Kind: model.VoteKindRetract}, store.VoteRetracted)
+	for _, userID := range []string{"u1", "never-voted"} {
+		if v, ok, err := s.GetVote(ctx, pollID, userID); err != nil || ok {
+			t.Fatalf("GetVote(%s) = %+v, %v, %v, want no vote", userID, v, ok, err)
+		}
+	}
+}
+
+func testTallyCheck(t *testing.T, s store.VoteStore, pollID string) {
+	ctx := context.Background()
+	if err := s.SavePollSettings(ctx, pollID, model.PollSettings{AllowVoteChanges: true, Mode: model.PollModeApproval}); err != nil {
+		t.Fatalf("SavePollSettings: %v", err)
+	}
+
+	register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionIDs: []string{"a", "b"}}, store.VoteCounted)
+	register(t, s, model.Vote{PollID: pollID, UserID: "u2", OptionIDs: []string{"b"}, Weight: 2}, store.VoteCounted)
+	register(t, s, model.Vote{PollID: pollID, UserID: "u3", OptionIDs: []string{"c"}}, store.VoteCounted)
+	register(t, s, model.Vote{PollID: pollID, UserID: "u2", OptionIDs: []string{"a"}, Kind: model.VoteKindChange}, store.VoteChanged)
+	register(t, s, model.Vote{PollID: pollID, UserID: "u3", Kind: model.VoteKindRetract}, store.VoteRetracted)
+
+	// a consistent tally is left alone even when asked to repair
+	check, err := s.CheckTally(ctx, pollID, true)
+	if err != nil {
+		t.Fatalf("CheckTally: %v", err)
+	}
+	want := map[string]int{"a": 2, "b": 1}
+	if !check.VotersMatch() || check.Voters != 2 {
+		t.Fatalf("CheckTally voters = %d, ballots = %d, want 2 and 2", check.Voters, check.Ballots)
+	}
+	if !check.TallyMatches() || !maps.Equal(check.Recount, want) {
+		t.Fatalf("CheckTally stored = %v, recount = %v, want both %v", check.Stored, check.Recount, want)
+	}
+	wantWeight := map[string]float64{"a": 2, "b": 1}
+	if !check.WeightsMatch() || !maps.Equal(check.RecountWeight, wantWeight) {
+		t.Fatalf("CheckTally stored weights = %v, recount = %v, want both %v", check.StoredWeight, check.RecountWeight, wantWeight)
+	}
+	if check.Repaired {
+		t.Fatal("CheckTally repaired a tally that matched")
+	}
+	assertResults(t, s, pollID, want)
+
+	check, err = s.CheckTally(ctx, "storetest-never-voted", false)
+	if err != nil {
+		t.Fatalf("CheckTally of an unknown poll: %v", err)
+	}
+	if check.Voters != 0 || !check.TallyMatches() {
+		t.Fatalf("CheckTally of an unknown poll = %+v, want an empty check", check)
+	}
+}
+
+func testDeletePoll(t *testing.T, s store.VoteStore, pollID string) {
+	ctx := context.Background()
+	settings := model.PollSettings{AllowVoteChanges: true, ClosesAt: time.Now().Add(-time.Hour).UTC().Truncate(time.Second)}
+	if err := s.SavePollSettings(ctx, pollID, settings); err != nil {
+		t.Fatalf("SavePollSettings: %v", err)
+	}
+	register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionID: "a", Weight: 2}, store.VoteCounted)
+	register(t, s, model.Vote{PollID: pollID, UserID: "u2", OptionIDs: []string{"b"}}, store.VoteCounted)
+	register(t, s, model.Vote{PollID: pollID + "-other", UserID: "u1", OptionID: "a"}, store.VoteCounted)
+
+	votes, err := s.ListVotes(ctx, pollID)
+	if err != nil {
+		t.Fatalf("ListVotes: %v", err)
+	}
+	slices.SortFunc(votes, func(a, b store.StoredVote) int { return strings.Compare(a.UserID, b.UserID) })
+	if len(votes) != 2 || votes[0].UserID != "u1" || !slices.Equal(votes[0].OptionIDs, []string{"a"}) || votes[0].Weight != 2 ||
+		votes[1].UserID != "u2" || !slices.Equal(votes[1].OptionIDs, []string{"b"}) || votes[1].Weight != 1 {
+		t.Fatalf("ListVotes = %+v, want u1 on a with weight 2 and u2 on b", votes)
+	}
+
+	p, ok, err := s.GetPoll(ctx, pollID)
+	if err != nil || !ok {
+		t.Fatalf("GetPoll = %v, %v, want the poll", ok, err)
+	}
+	// a vote after the poll was read keeps it, the reader's copy is stale
+	later := p.LastVoteAt.Add(time.Minute)
+	register(t, s, model.Vote{PollID: pollID, UserID: "u3", OptionID: "a", Timestamp: later, ReceivedAt: later}, store.VoteCounted)
+	if n, err := s.DeletePoll(ctx, pollID, p.LastVoteAt); !errors.Is(err, store.ErrPollChanged) {
+		t.Fatalf("DeletePoll after another vote = %d, %v, want ErrPollChanged", n, err)
+	}
+	assertVoters(t, s, pollID, 3)
+
+	p, _, err = s.GetPoll(ctx, pollID)
+	if err != nil {
+		t.Fatalf("GetPoll: %v", err)
+	}
+	n, err := s.DeletePoll(ctx, pollID, p.LastVoteAt)
+	if err != nil {
+		t.Fatalf("DeletePoll: %v", err)
+	}
+	if n == 0 {
+		t.Fatalf("DeletePoll removed nothing")
+	}
+	if _, err := s.DeletePoll(ctx, pollID, p.LastVoteAt); !errors.Is(err, store.ErrPollChanged) {
+		t.Fatalf("DeletePoll of a deleted poll = %v, want ErrPollChanged", err)
+	}
+
+	assertResults(t, s, pollID, map[string]int{})
+	assertVoters(t, s, pollID, 0)
+	if votes, err := s.ListVotes(ctx, pollID); err != nil || len(votes) != 0 {
+		t.Fatalf("ListVotes after DeletePoll = %v, %v, want none", votes, err)
+	}
+	if _, ok, err := s.GetPoll(ctx, pollID); err != nil || ok {
+		t.Fatalf("GetPoll after DeletePoll = %v, %v, want false, nil", ok, err)
+	}
+	polls, err := s.ListPolls(ctx, time.Time{})
+	if err != nil {
+		t.Fatalf("ListPolls: %v", err)
+	}
+	if containsPoll(polls, pollID) || !containsPoll(polls, pollID+"-other") {
+		t.Fatalf("ListPolls after DeletePoll = %v, want only %s-other", polls, pollID)
+	}
+
+	// the settings outlive the data, so the poll stays closed
+	got, err := s.GetPollSettings(ctx, pollID)
+	if err != nil || !got.ClosesAt.Equal(settings.ClosesAt) {
+		t.Fatalf("GetPollSettings after DeletePoll = %+v, %v, want %+v", got, err, settings)
+	}
+	assertVoters(t, s, pollID+"-other", 1)
+}
+
+// the same poll ID in two tenants is two polls that share nothing
+func testTenantIsolation(t *testing.T, s store.VoteStore, pollID string) {
+	ctx := context.Background()
+	acme, globex := s.ForTenant(pollID+"-acme"), s.ForTenant(pollID+"-globex")
+
+	if err := acme.SavePollSettings(ctx, pollID, model.PollSettings{AllowVoteChanges: true}); err != nil {
+		t.Fatalf("SavePollSettings: %v", err)
+	}
+	register(t, acme, model.Vote{PollID: pollID, UserID: "u1", OptionID: "a"}, store.VoteCounted)
+	register(t, acme, model.Vote{PollID: pollID, UserID: "u1", OptionID: "b", Kind: model.VoteKindChange}, store.VoteChanged)
+
+	// u1 hasn't voted in globex, and globex's poll has no settings of its own
+	register(t, globex, model.Vote{PollID: pollID, UserID: "u1", OptionID: "a"}, store.VoteCounted)
+	register(t, globex, model.Vote{PollID: pollID, UserID: "u1", OptionID: "a"}, store.VoteDuplicate)
+	register(t, globex, model.Vote{PollID: pollID, UserID: "u2", OptionID: "a"}, store.VoteCounted)
+	if settings, err := globex.GetPollSettings(ctx, pollID); err != nil || settings.AllowVoteChanges {
+		t.Fatalf("GetPollSettings of the other tenant = %+v, %v, want the defaults", settings, err)
+	}
+
+	assertResults(t, acme, pollID, map[string]int{"b": 1})
+	assertVoters(t, acme, pollID, 1)
+	assertResults(t, globex, pollID, map[string]int{"a": 2})
+	assertVoters(t, globex, pollID, 2)
+
+	// and none of it is visible from the default tenant
+	assertVoters(t, s, pollID, 0)
+	if _, ok, err := s.GetPoll(ctx, pollID); err != nil || ok {
+		t.Fatalf("GetPoll from the default tenant = %v, %v, want false, nil", ok, err)
+	}
+	polls, err := globex.ListPolls(ctx, time.Time{})
+	if err != nil {
+		t.Fatalf("ListPolls: %v", err)
+	}
+	if len(polls) != 1 || polls[0].PollID != pollID {
+		t.Fatalf("ListPolls of a tenant = %v, want only %s", polls, pollID)
+	}
+}
+
+func testUnknownPoll(t *testing.T, s store.VoteStore, pollID string) {
+	ctx := context.Background()
+
+	assertResults(t, s, pollID, map[string]int{})
+	assertVoters(t, s, pollID, 0)
+
+	if w, err := s.GetWeightedResults(ctx, pollID); err != nil || len(w) != 0 {
+		t.Fatalf("GetWeightedResults = %v, %v, want empty, nil", w, err)
+	}
+	if b, err := s.GetBallots(ctx, pollID); err != nil || len(b) != 0 {
+		t.Fatalf("GetBallots = %v, %v, want empty, nil", b, err)
+	}
+	if h, err := s.GetHistory(ctx, pollID, time.Now().Add(-time.Hour), time.Now()); err != nil || len(h) != 0 {
+		t.Fatalf("GetHistory = %v, %v, want empty, nil", h, err)
+	}
+	if _, ok, err := s.GetPoll(ctx, pollID); err != nil || ok {
+		t.Fatalf("GetPoll = %v, %v, want false, nil", ok, err)
+	}
+	if settings, err := s.GetPollSettings(ctx, pollID); err != nil || settings.ModeOrDefault() != model.PollModeSingle || settings.AllowVoteChanges {
+		t.Fatalf("GetPollSettings = %+v, %v, want the zero settings", settings, err)
+	}
+	if ok, err := s.HasPollSettings(ctx, pollID); err != nil || ok {
+		t.Fatalf("HasPollSettings = %v, %v, want false, nil", ok, err)
+	}
+
+	// a vote doesn't save settings, but saving the defaults does
+	register(t, s, model.Vote{PollID: pollID, UserID: "u1", OptionID: "a"}, store.VoteCounted)
+	if ok, err := s.HasPollSettings(ctx, pollID); err != nil || ok {
+		t.Fatalf("HasPollSettings after a vote = %v, %v, want false, nil", ok, err)
+	}
+	if err := s.SavePollSettings(ctx, pollID, model.PollSettings{}); err != nil {
+		t.Fatalf("SavePollSettings: %v", err)
+	}
+	if ok, err := s.HasPollSettings(ctx, pollID); err != nil || !ok {
+		t.Fatalf("HasPollSettings after saving them = %v, %v, want true, nil", ok, err)
+	}
+}
+
+func testVelocity(t *testing.T, s store.VoteStore, pollID string) {
+	ctx := context.Background()
+	key := "ip:" + pollID
+	start := time.Now().Truncate(time.Second)
+
+	record := func(member string, at time.Time, want int) {
+		t.Helper()
+		n, err := s.RecordVelocity(ctx, key, member, at, time.Minute)
+		if err != nil {
+			t.Fatalf("RecordVelocity(%s): %v", member, err)
+		}
+		if n != want {
+			t.Fatalf("RecordVelocity(%s) = %d, want %d", member, n, want)
+		}
+	}
+
+	record("u1", start, 1)
+	record("u2", start.Add(10*time.Second), 2)
+	// the same member again isn't a new one
+	record("u1", start.Add(20*time.Second), 2)
+	// u2 has left the window, u1 was seen again since
+	record("u3", start.Add(75*time.Second), 2)
+
+	// other tenants count apart
+	if n, err := s.ForTenant("storetest-other").RecordVelocity(ctx, key, "u1", start.Add(75*time.Second), time.Minute); err != nil || n != 1 {
+		t.Fatalf("RecordVelocity in another tenant = %d, %v, want 1, nil", n, err)
+	}
+}
+
+func testLease(t *testing.T, s store.VoteStore, pollID string) {
+	ctx := context.Background()
+	name := "storetest-" + pollID
+	acquire := func(s store.VoteStore, holder string, ttl time.Duration, want bool) {
+		t.Helper()
+		ok, err := s.AcquireLease(ctx, name, holder, ttl)
+		if err != nil {
+			t.Fatalf("AcquireLease(%s): %v", holder, err)
+		}
+		if ok != want {
+			t.Fatalf("AcquireLease(%s) = %v, want %v", holder, ok, want)
+		}
+	}
+
+	acquire(s, "c1", time.Minute, true)
+	acquire(s, "c2", time.Minute, false)
+	// the holder renews it, and it's the same lease in every tenant
+	acquire(s, "c1", 100*time.Millisecond, true)
+	acquire(s.ForTenant("storetest-other"), "c2", time.Minute, false)
+
+	// once it runs out anyone can take it
+	time.Sleep(300 * time.Millisecond)
+	acquire(s, "c2", time.Minute, true)
+	acquire(s, "c1", time.Minute, false)
+}
+
+func testQuarantine(t *testing.T, s store.VoteStore, pollID string) {
+	ctx := context.Background()
+	start := time.Now().Truncate(time.Second)
+
+	for i, user := range []string{"u1", "u2"} {
+		q := store.QuarantinedVote{
+			ID:            pollID + "-" + user,
+			Vote:          model.Vote{PollID: pollID, UserID: user, OptionID: "a", Flags: []string{"source_ip"}},
+			QuarantinedAt: start.Add(time.Duration(i) * time.Second),
+		}
+		if err := s.QuarantineVote(ctx, q); err != nil {
+			t.Fatalf("QuarantineVote: %v", err)
+		}
+	}
+	if err := s.QuarantineVote(ctx, store.QuarantinedVote{ID: "other", Vote: model.Vote{PollID: pollID + "-other", UserID: "u1"}, QuarantinedAt: start}); err != nil {
+		t.Fatalf("QuarantineVote: %v", err)
+	}
+	// held votes aren't counted
+	assertResults(t, s, pollID, map[string]int{})
+
+	held, err := s.ListQuarantined(ctx, pollID)
+	if err != nil || len(held) != 2 || held[0].Vote.UserID != "u1" || held[1].Vote.UserID != "u2" {
+		t.Fatalf("ListQuarantined = %+v, %v, want u1 then u2", held, err)
+	}
+	if !slices.Equal(held[0].Vote.Flags, []string{"source_ip"}) || !held[0].QuarantinedAt.Equal(start) {
+		t.Fatalf("ListQuarantined()[0] = %+v, want its flags and time kept", held[0])
+	}
+	if all, err := s.ListQuarantined(ctx, ""); err != nil || len(all) != 3 {
+		t.Fatalf("ListQuarantined(all) = %d votes, %v, want 3", len(all), err)
+	}
+
+	rec := store.ReviewRecord{VoteID: pollID + "-u1", PollID: pollID, UserID: "u1", Decision: store.ReviewApproved, Reviewer: "alice", DecidedAt: start}
+	if ok, err := s.ResolveQuarantined(ctx, rec); err != nil || !ok {
+		t.Fatalf("ResolveQuarantined = %v, %v, want true, nil", ok, err)
+	}
+	// resolving twice keeps a single record
+	if ok, err := s.ResolveQuarantined(ctx, rec); err != nil || ok {
+		t.Fatalf("second ResolveQuarantined = %v, %v, want false, nil", ok, err)
+	}
+	if _, ok, err := s.GetQuarantined(ctx, pollID+"-u1"); err != nil || ok {
+		t.Fatalf("GetQuarantined(resolved) = %v, %v, want false, nil", ok, err)
+	}
+	if q, ok, err := s.GetQuarantined(ctx, pollID+"-u2"); err != nil || !ok || q.Vote.UserID != "u2" {
+		t.Fatalf("GetQuarantined(held) = %+v, %v, %v, want u2's vote", q, ok, err)
+	}
+
+	reviews, err := s.ListReviews(ctx, pollID)
+	if err != nil || len(reviews) != 1 || reviews[0].Reviewer != "alice" || reviews[0].Decision != store.ReviewApproved {
+		t.Fatalf("ListReviews = %+v, %v, want alice's approval", reviews, err)
+	}
+
+	if held, err := s.ForTenant("storetest-other").ListQuarantined(ctx, ""); err != nil || len(held) != 0 {
+		t.Fatalf("ListQuarantined in another tenant = %+v, %v, want none", held, err)
+	}
+}
+
+func testContextCancellation(t *testing.T, s store.VoteStore, pollID string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := s.RegisterVote(ctx, model.Vote{PollID: pollID, UserID: "u1", OptionID: "a"}); err == nil {
+		t.Fatal("RegisterVote with a canceled context succeeded")
+	}
+	if _, err := s.GetResults(ctx, pollID); err == nil {
+		t.Fatal("GetResults with a canceled context succeeded")
+	}
+
+	// the canceled vote must not have been counted
+	assertResults(t, s, pollID, map[string]int{})
+	assertVoters(t, s, pollID, 0)
+}
+
+func testClose(t *testing.T, s store.VoteStore) {
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if _, err := s.RegisterVote(context.Background(), model.Vote{PollID: "closed", UserID: "u1", OptionID: "a"}); err == nil {
+		t.Fatal("RegisterVote after Close succeeded")
+	}
+}
@@ -0,0 +1,109 @@
+package tally
+
+import "sort"
+
+// RunoffRound is one counting round of an instant-runoff tabulation
+type RunoffRound struct {
+	Round int `json:"round"`
+	// Counts holds the votes of every option still in the race this round
+	Counts map[string]int `json:"counts"`
+	// Exhausted counts ballots with no continuing option left
+	Exhausted  int      `json:"exhausted"`
+	Eliminated []string `json:"eliminated,omitempty"`
+}
+
+type RunoffResult struct {
+	Rounds []RunoffRound `json:"rounds"`
+	Winner string        `json:"winner,omitempty"`
+	// Tied is set instead of Winner when the last options standing can't be separated
+	Tied []string `json:"tied,omitempty"`
+}
+
+/*
+InstantRunoff tabulates ranked ballots, each one listing option IDs from the
+most to the least preferred.
+
+Every round each ballot counts for its highest ranked option still in the race.
+An option with more than half of the continuing ballots wins; otherwise the
+option(s) with the fewest votes are eliminated and their ballots move on to
+their next preference. When every remaining option is tied for last place,
+nobody can be eliminated fairly and the result is a tie between them.
+*/
+func InstantRunoff(ballots [][]string) RunoffResult {
+	continuing := make(map[string]bool)
+	for _, b := range ballots {
+		for _, option := range b {
+			continuing[option] = true
+		}
+	}
+
+	var result RunoffResult
+	for round := 1; len(continuing) > 0; round++ {
+		r := RunoffRound{Round: round, Counts: make(map[string]int, len(continuing))}
+		for option := range continuing {
+			r.Counts[option] = 0
+		}
+
+		active := 0
+		for _, b := range ballots {
+			if option, ok := topChoice(b, continuing); ok {
+				r.Counts[option]++
+				active++
+			} else {
+				r.Exhausted++
+			}
+		}
+
+		for option, count := range r.Counts {
+			if count*2 > active {
+				result.Winner = option
+				result.Rounds = append(result.Rounds, r)
+				return result
+			}
+		}
+
+		lowest := lowestOptions(r.Counts)
+		if len(lowest) == len(continuing) {
+			if len(lowest) == 1 {
+				result.Winner = lowest[0]
+			} else {
+				result.Tied = lowest
+			}
+			result.Rounds = append(result.Rounds, r)
+			return result
+		}
+
+		for _, option := range lowest {
+			delete(continuing, option)
+		}
+		r.Eliminated = lowest
+		result.Rounds = append(result.Rounds, r)
+	}
+
+	return result
+}
+
+func topChoice(ballot []string, continuing map[string]bool) (string, bool) {
+	for _, option := range ballot {
+		if continuing[option] {
+			return option, true
+		}
+	}
+	return "", false
+}
+
+func lowestOptions(counts map[string]int) []string {
+	var lowest []string
+	min := -1
+	for option, count := range counts {
+		switch {
+		case min == -1 || count < min:
+			min = count
+			lowest = []string{option}
+		case count == min:
+			lowest = append(lowest, option)
+		}
+	}
+	sort.Strings(lowest) // map order is random, keep the output stable
+	return lowest
+}
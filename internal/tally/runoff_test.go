@@ -0,0 +1,93 @@
+package tally
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInstantRunoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		ballots    [][]string
+		winner     string
+		tied       []string
+		rounds     int
+		eliminated [][]string
+		exhausted  []int
+	}{
+		{
+			name:      "majority in the first round",
+			ballots:   [][]string{{"a"}, {"a", "b"}, {"b"}},
+			winner:    "a",
+			rounds:    1,
+			exhausted: []int{0},
+		},
+		{
+			name: "transfers decide the winner",
+			ballots: [][]string{
+				{"a"}, {"a"}, {"a"},
+				{"b"}, {"b"}, {"b"},
+				{"c", "b"},
+			},
+			winner:     "b",
+			rounds:     2,
+			eliminated: [][]string{{"c"}, nil},
+			exhausted:  []int{0, 0},
+		},
+		{
+			name: "options tied for last are eliminated together",
+			ballots: [][]string{
+				{"a"}, {"a"},
+				{"b", "a"}, {"c", "b"},
+			},
+			winner:     "a",
+			rounds:     2,
+			eliminated: [][]string{{"b", "c"}, nil},
+			exhausted:  []int{0, 1},
+		},
+		{
+			name: "exhausted ballots leave the count",
+			ballots: [][]string{
+				{"a"}, {"a"},
+				{"b"}, {"b"},
+				{"c"},
+			},
+			tied:       []string{"a", "b"},
+			rounds:     2,
+			eliminated: [][]string{{"c"}, nil},
+			exhausted:  []int{0, 1},
+		},
+		{
+			name:      "a tie of the last options standing",
+			ballots:   [][]string{{"a", "b"}, {"b", "a"}},
+			tied:      []string{"a", "b"},
+			rounds:    1,
+			exhausted: []int{0},
+		},
+		{
+			name:    "no ballots",
+			ballots: nil,
+			rounds:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := InstantRunoff(tt.ballots)
+			if r.Winner != tt.winner || !reflect.DeepEqual(r.Tied, tt.tied) {
+				t.Fatalf("got winner %q tied %v, want winner %q tied %v", r.Winner, r.Tied, tt.winner, tt.tied)
+			}
+			if len(r.Rounds) != tt.rounds {
+				t.Fatalf("got %d rounds, want %d", len(r.Rounds), tt.rounds)
+			}
+			for i, round := range r.Rounds {
+				if i < len(tt.eliminated) && !reflect.DeepEqual(round.Eliminated, tt.eliminated[i]) {
+					t.Errorf("round %d eliminated %v, want %v", round.Round, round.Eliminated, tt.eliminated[i])
+				}
+				if round.Exhausted != tt.exhausted[i] {
+					t.Errorf("round %d has %d exhausted ballots, want %d", round.Round, round.Exhausted, tt.exhausted[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package tenant
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+/*
+Admin credentials are apart from the API keys: producers publish votes with
+their API key, so an API key can't be what lets someone change a poll's
+settings, read a ballot or review a quarantined vote. Admin keys are sent in
+the X-Admin-Key header, each belongs to one tenant and names the person
+holding it, which is who the audit records say made a decision.
+
+A nil Admins table means no admin keys were configured, and every admin
+request is turned away.
+*/
+
+// Admin is who holds an admin key, and the tenant it's for
+type Admin struct {
+	Name     string `json:"name"`
+	TenantID string `json:"tenant_id"`
+}
+
+// Admins resolves admin keys from a fixed table
+type Admins struct {
+	keys map[string]Admin
+}
+
+func NewAdmins(keys map[string]Admin) *Admins {
+	return &Admins{keys: keys}
+}
+
+// LoadAdmins reads a JSON object of admin key -> {"name", "tenant_id"}. An
+// empty tenant_id is the default tenant
+func LoadAdmins(path string) (*Admins, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading admins file: %v", err)
+	}
+
+	keys := make(map[string]Admin)
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("error parsing admins file: %v", err)
+	}
+	for key, a := range keys {
+		if key == "" || a.Name == "" {
+			return nil, fmt.Errorf("error parsing admins file: every admin needs a key and a name")
+		}
+	}
+	return NewAdmins(keys), nil
+}
+
+// Lookup returns who holds an admin key, always false on a nil table
+func (a *Admins) Lookup(key string) (Admin, bool) {
+	if a == nil || key == "" {
+		return Admin{}, false
+	}
+	admin, ok := a.keys[key]
+	return admin, ok
+}
+
+// AdminFromRequest resolves the admin of an HTTP request from its X-Admin-Key header
+func AdminFromRequest(a *Admins, req *http.Request) (Admin, error) {
+	key := req.Header.Get("X-Admin-Key")
+	if key == "" {
+		return Admin{}, ErrMissingCredentials
+	}
+	admin, ok := a.Lookup(key)
+	if !ok {
+		return Admin{}, ErrUnknownCredentials
+	}
+	return admin, nil
+}
@@ -0,0 +1,109 @@
+/*
+Package tenant maps the credentials clients present to the tenant they act
+for. Producers publish votes with an API key in the "api-key" Kafka header,
+and HTTP and WebSocket clients send theirs in the X-API-Key header (or the
+api_key query parameter, since browsers can't set WebSocket headers).
+
+A nil Resolver means a single-tenant deployment: every vote and request
+belongs to the default tenant, whose ID is empty, and credentials are ignored.
+*/
+package tenant
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+)
+
+var (
+	ErrMissingCredentials = errors.New("missing API key")
+	ErrUnknownCredentials = errors.New("unknown API key")
+)
+
+type Resolver interface {
+	// Lookup returns the tenant an API key belongs to
+	Lookup(apiKey string) (string, bool)
+	// Tenants returns every tenant the resolver knows about
+	Tenants() []string
+}
+
+// Resolve returns the tenant of an API key, or the default tenant when r is nil
+func Resolve(r Resolver, apiKey string) (string, error) {
+	if r == nil {
+		return "", nil
+	}
+	if apiKey == "" {
+		return "", ErrMissingCredentials
+	}
+	tenantID, ok := r.Lookup(apiKey)
+	if !ok {
+		return "", ErrUnknownCredentials
+	}
+	return tenantID, nil
+}
+
+// All returns the tenants of r, always including the default one, which
+// holds the polls from before tenants existed
+func All(r Resolver) []string {
+	if r == nil {
+		return []string{""}
+	}
+	tenants := r.Tenants()
+	if !slices.Contains(tenants, "") {
+		tenants = append([]string{""}, tenants...)
+	}
+	return tenants
+}
+
+// StaticResolver resolves API keys from a fixed table
+type StaticResolver struct {
+	keys map[string]string
+}
+
+func NewStaticResolver(keys map[string]string) *StaticResolver {
+	return &StaticResolver{keys: keys}
+}
+
+// LoadFile reads a JSON object of API key -> tenant ID. Mapping a key to ""
+// gives it access to the default tenant
+func LoadFile(path string) (*StaticResolver, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tenants file: %v", err)
+	}
+
+	keys := make(map[string]string)
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("error parsing tenants file: %v", err)
+	}
+	return NewStaticResolver(keys), nil
+}
+
+func (sr *StaticResolver) Lookup(apiKey string) (string, bool) {
+	tenantID, ok := sr.keys[apiKey]
+	return tenantID, ok
+}
+
+func (sr *StaticResolver) Tenants() []string {
+	var tenants []string
+	for _, tenantID := range sr.keys {
+		if !slices.Contains(tenants, tenantID) {
+			tenants = append(tenants, tenantID)
+		}
+	}
+	slices.Sort(tenants)
+	return tenants
+}
+
+// FromRequest resolves the tenant of an HTTP request, from its X-API-Key
+// header or its api_key query parameter
+func FromRequest(r Resolver, req *http.Request) (string, error) {
+	apiKey := req.Header.Get("X-API-Key")
+	if apiKey == "" {
+		apiKey = req.URL.Query().Get("api_key")
+	}
+	return Resolve(r, apiKey)
+}
@@ -0,0 +1,84 @@
+package tenant
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFromRequest(t *testing.T) {
+	r := NewStaticResolver(map[string]string{"acme-key": "acme", "default-key": ""})
+
+	for _, tt := range []struct {
+		name   string
+		target string
+		header string
+		want   string
+		err    error
+	}{
+		{"header", "/polls", "acme-key", "acme", nil},
+		{"query parameter", "/ws/votes/p1?api_key=acme-key", "", "acme", nil},
+		{"default tenant key", "/polls", "default-key", "", nil},
+		{"no key", "/polls", "", "", ErrMissingCredentials},
+		{"unknown key", "/polls", "guess", "", ErrUnknownCredentials},
+	} {
+		req := httptest.NewRequest("GET", tt.target, nil)
+		if tt.header != "" {
+			req.Header.Set("X-API-Key", tt.header)
+		}
+		got, err := FromRequest(r, req)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %q, %v, want %q, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+
+	// without a resolver everything is the default tenant
+	if got, err := FromRequest(nil, httptest.NewRequest("GET", "/polls", nil)); got != "" || err != nil {
+		t.Errorf("nil resolver: got %q, %v", got, err)
+	}
+}
+
+func TestAll(t *testing.T) {
+	r := NewStaticResolver(map[string]string{"k1": "globex", "k2": "acme", "k3": "acme"})
+	if got := All(r); len(got) != 3 || got[0] != "" || got[1] != "acme" || got[2] != "globex" {
+		t.Errorf("All = %q, want the default tenant, acme and globex", got)
+	}
+	if got := All(nil); len(got) != 1 || got[0] != "" {
+		t.Errorf("All(nil) = %q, want only the default tenant", got)
+	}
+}
+
+func TestAdmins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admins.json")
+	if err := os.WriteFile(path, []byte(`{"k1": {"name": "alice", "tenant_id": "acme"}, "k2": {"name": "bob"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	admins, err := LoadAdmins(path)
+	if err != nil {
+		t.Fatalf("LoadAdmins: %v", err)
+	}
+
+	req := httptest.NewRequest("PUT", "/polls/p1/settings", nil)
+	req.Header.Set("X-Admin-Key", "k1")
+	if a, err := AdminFromRequest(admins, req); err != nil || a != (Admin{Name: "alice", TenantID: "acme"}) {
+		t.Errorf("AdminFromRequest = %+v, %v, want alice of acme", a, err)
+	}
+	req.Header.Set("X-Admin-Key", "guess")
+	if _, err := AdminFromRequest(admins, req); !errors.Is(err, ErrUnknownCredentials) {
+		t.Errorf("unknown admin key: %v", err)
+	}
+	// no admins configured turns everyone away
+	req.Header.Set("X-Admin-Key", "k1")
+	if _, err := AdminFromRequest(nil, req); !errors.Is(err, ErrUnknownCredentials) {
+		t.Errorf("nil admins: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"k1": {"tenant_id": "acme"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAdmins(path); err == nil {
+		t.Error("LoadAdmins accepted an admin without a name")
+	}
+}